@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/pkg/errors"
+)
+
+// config is the desired state of a workspace as described by the files of a
+// config directory. Every file holds a partial config; they are merged by
+// loadConfig.
+//
+// Only the resources listed in the config are managed: plan and apply never
+// delete sources, destinations, filters or tracking plans that are absent.
+type config struct {
+	Sources       []sourceSpec       `json:"sources,omitempty"`
+	TrackingPlans []trackingPlanSpec `json:"tracking_plans,omitempty"`
+}
+
+// sourceSpec describes a source and the destinations attached to it.
+type sourceSpec struct {
+	Name         string            `json:"name"`
+	CatalogName  string            `json:"catalog_name"`
+	SchemaConfig *sourceConfigSpec `json:"schema_config,omitempty"`
+	Destinations []destinationSpec `json:"destinations,omitempty"`
+}
+
+// destinationSpec describes a destination of a source. Config maps short
+// setting names (e.g. "apiKey") to their values; settings that are not
+// listed are left untouched, and so is the enabled flag when it is omitted.
+// Filters are matched to existing ones by title.
+type destinationSpec struct {
+	Name           string                 `json:"name"`
+	ConnectionMode string                 `json:"connection_mode,omitempty"`
+	Enabled        *bool                  `json:"enabled,omitempty"`
+	Config         map[string]interface{} `json:"config,omitempty"`
+	Filters        []filterSpec           `json:"filters,omitempty"`
+}
+
+// sourceConfigSpec is the schema config of a source. Only the settings listed
+// in the spec are managed; the others are left as they are.
+type sourceConfigSpec struct {
+	segment.SourceConfig
+	fields []segment.SourceConfigField
+}
+
+func (s *sourceConfigSpec) UnmarshalJSON(data []byte) error {
+	keys, err := objectKeys(data)
+	if err != nil {
+		return err
+	}
+	s.fields = nil
+	for _, field := range segment.SourceConfigFields {
+		if keys[string(field)] {
+			s.fields = append(s.fields, field)
+		}
+	}
+	return json.Unmarshal(data, &s.SourceConfig)
+}
+
+// filterSpec is a destination filter. Only the fields listed in the spec are
+// managed; the others are left as they are.
+type filterSpec struct {
+	segment.DestinationFilter
+	fields []segment.DestinationFilterField
+}
+
+func (s *filterSpec) UnmarshalJSON(data []byte) error {
+	keys, err := objectKeys(data)
+	if err != nil {
+		return err
+	}
+	s.fields = nil
+	for _, field := range segment.DestinationFilterFields {
+		if keys[string(field)] {
+			s.fields = append(s.fields, field)
+		}
+	}
+	return json.Unmarshal(data, &s.DestinationFilter)
+}
+
+// objectKeys returns the keys of a JSON object.
+func objectKeys(data []byte) (map[string]bool, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(raw))
+	for k := range raw {
+		keys[k] = true
+	}
+	return keys, nil
+}
+
+// trackingPlanSpec describes a tracking plan, matched to existing ones by
+// display name. When Sources is set, it is the exact list of sources
+// connected to the plan.
+type trackingPlanSpec struct {
+	DisplayName string          `json:"display_name"`
+	Rules       segment.RuleSet `json:"rules"`
+	Sources     []string        `json:"sources,omitempty"`
+}
+
+// loadConfig reads and merges every JSON and YAML file below dir. A path to
+// a single file is accepted as well.
+func loadConfig(dir string) (config, error) {
+	var cfg config
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+			if !info.IsDir() {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return cfg, errors.Wrapf(err, "reading config directory %s failed", dir)
+	}
+	if len(files) == 0 {
+		return cfg, fmt.Errorf("no .yaml, .yml or .json files found in %s", dir)
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return cfg, err
+		}
+		var part config
+		if err := segment.UnmarshalYAML(data, &part); err != nil {
+			return cfg, errors.Wrapf(err, "decoding %s failed", file)
+		}
+		cfg.Sources = append(cfg.Sources, part.Sources...)
+		cfg.TrackingPlans = append(cfg.TrackingPlans, part.TrackingPlans...)
+	}
+
+	return cfg, cfg.validate()
+}
+
+// validate reports missing names and resources declared more than once.
+func (cfg config) validate() error {
+	sources := map[string]bool{}
+	for _, src := range cfg.Sources {
+		if src.Name == "" {
+			return fmt.Errorf("source without a name")
+		}
+		if sources[src.Name] {
+			return fmt.Errorf("source %s is declared more than once", src.Name)
+		}
+		sources[src.Name] = true
+
+		destinations := map[string]bool{}
+		for _, dest := range src.Destinations {
+			if dest.Name == "" {
+				return fmt.Errorf("destination without a name in source %s", src.Name)
+			}
+			if destinations[dest.Name] {
+				return fmt.Errorf("destination %s/%s is declared more than once", src.Name, dest.Name)
+			}
+			destinations[dest.Name] = true
+
+			filters := map[string]bool{}
+			for _, f := range dest.Filters {
+				if f.Title == "" {
+					return fmt.Errorf("filter without a title in destination %s/%s", src.Name, dest.Name)
+				}
+				if filters[f.Title] {
+					return fmt.Errorf("filter %q of destination %s/%s is declared more than once", f.Title, src.Name, dest.Name)
+				}
+				filters[f.Title] = true
+			}
+		}
+	}
+
+	plans := map[string]bool{}
+	for _, tp := range cfg.TrackingPlans {
+		if tp.DisplayName == "" {
+			return fmt.Errorf("tracking plan without a display_name")
+		}
+		if plans[tp.DisplayName] {
+			return fmt.Errorf("tracking plan %q is declared more than once", tp.DisplayName)
+		}
+		plans[tp.DisplayName] = true
+	}
+
+	return nil
+}
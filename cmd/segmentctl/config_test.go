@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, dir, name, content string) {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestConfig_LoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "sources.yaml", `
+sources:
+  - name: js
+    catalog_name: catalog/sources/javascript
+    schema_config:
+      allow_unplanned_track_events: false
+    destinations:
+      - name: google-analytics
+        enabled: true
+        config:
+          trackingId: UA-1
+        filters:
+          - title: Drop identify
+            if: type = "identify"
+            enabled: true
+            actions:
+              - type: drop_event
+`)
+	writeConfigFile(t, dir, "plans/web.json", `{"tracking_plans": [{"display_name": "Web", "sources": ["js"]}]}`)
+	writeConfigFile(t, dir, "README.md", "not a config file")
+
+	cfg, err := loadConfig(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, config{
+		Sources: []sourceSpec{{
+			Name:        "js",
+			CatalogName: "catalog/sources/javascript",
+			SchemaConfig: &sourceConfigSpec{
+				fields: []segment.SourceConfigField{segment.SourceConfigAllowUnplannedTrackEvents},
+			},
+			Destinations: []destinationSpec{{
+				Name:    "google-analytics",
+				Enabled: boolPtr(true),
+				Config:  map[string]interface{}{"trackingId": "UA-1"},
+				Filters: []filterSpec{{
+					DestinationFilter: segment.DestinationFilter{
+						Title:      "Drop identify",
+						Conditions: `type = "identify"`,
+						IsEnabled:  true,
+						Actions:    segment.DestinationFilterActions{segment.NewDropEventAction()},
+					},
+					fields: []segment.DestinationFilterField{
+						segment.DestinationFilterFieldConditions,
+						segment.DestinationFilterFieldActions,
+						segment.DestinationFilterFieldTitle,
+						segment.DestinationFilterFieldEnabled,
+					},
+				}},
+			}},
+		}},
+		TrackingPlans: []trackingPlanSpec{{DisplayName: "Web", Sources: []string{"js"}}},
+	}, cfg)
+}
+
+func TestConfig_EmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	_, err := loadConfig(dir)
+	assert.EqualError(t, err, "no .yaml, .yml or .json files found in "+dir)
+}
+
+func TestConfig_Duplicates(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "a.yaml", "sources:\n  - name: js\n")
+	writeConfigFile(t, dir, "b.yaml", "sources:\n  - name: js\n")
+
+	_, err := loadConfig(dir)
+	assert.EqualError(t, err, "source js is declared more than once")
+}
+
+func TestApp_PlanRequiresConfig(t *testing.T) {
+	a, _, stderr := newTestApp(map[string]string{tokenEnv: "secret", workspaceEnv: "myworkspace"})
+
+	assert.Equal(t, 1, a.run([]string{"plan"}))
+	assert.Contains(t, stderr.String(), "-f is required")
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ajbosco/segment-config-go/segment"
+)
+
+func destinationsResource() resource {
+	return resource{
+		name:    "destinations",
+		aliases: []string{"destination"},
+		summary: "Manage the destinations of a source",
+		commands: []command{
+			{name: "list", args: "<source>", summary: "List the destinations of a source", run: listDestinations},
+			{name: "inventory", summary: "List the destinations of every source, optionally filtered by -type, -enabled and -config", run: inventoryDestinations},
+			{name: "get", args: "<source> <destination>", summary: "Show a destination", run: getDestination},
+			{name: "create", args: "<source> <destination>", summary: "Create a destination, optionally configured from -f", run: createDestination},
+			{name: "update", args: "<source> <destination>", summary: "Enable, disable, rename or reconfigure a destination", run: updateDestination},
+			{name: "patch", args: "<source> <destination>", summary: "Change some settings of a destination from -f, merging map settings", run: patchDestination},
+			{name: "replace", args: "<source> <destination>", summary: "Recreate a destination, e.g. in another connection mode, keeping its settings and filters", run: replaceDestination},
+			{name: "delete", args: "<source> <destination>", summary: "Delete a destination", run: deleteDestination},
+		},
+	}
+}
+
+func listDestinations(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	d, err := c.ListDestinations(args[0])
+	if err != nil {
+		return err
+	}
+	return a.print(d.Destinations, destinationsTable(d.Destinations...))
+}
+
+func inventoryDestinations(a *app, fs *flag.FlagSet, args []string) error {
+	destType := fs.String("type", "", "catalog name of the destinations, e.g. amplitude")
+	enabled := fs.Bool("enabled", false, "only enabled, or with -enabled=false disabled, destinations")
+	config := fs.String("config", "", "comma-separated name=value settings the destinations must have; values are JSON or strings")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	q := segment.DestinationQuery{Type: *destType}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "enabled" {
+			q.Enabled = enabled
+		}
+	})
+	if *config != "" {
+		q.Config = map[string]interface{}{}
+		for _, setting := range strings.Split(*config, ",") {
+			i := strings.Index(setting, "=")
+			if i < 0 {
+				return fmt.Errorf("invalid -config setting %q: expected name=value", setting)
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(setting[i+1:]), &value); err != nil {
+				value = setting[i+1:]
+			}
+			q.Config[setting[:i]] = value
+		}
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	records, err := c.ListAllDestinations(q)
+	if err != nil {
+		return err
+	}
+	t := table{headers: []string{"SOURCE", "TYPE", "ENABLED", "CONNECTION MODE"}}
+	for _, r := range records {
+		t.add(r.Source, r.Type, fmt.Sprint(r.Enabled), r.ConnectionMode)
+	}
+	return a.print(records, t)
+}
+
+func getDestination(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	d, err := c.GetDestination(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return a.print(d, destinationsTable(d))
+}
+
+func createDestination(a *app, fs *flag.FlagSet, args []string) error {
+	connMode := fs.String("connection-mode", "CLOUD", "connection mode of the destination: CLOUD or DEVICE")
+	enabled := fs.Bool("enabled", false, "enable the destination")
+	file := fs.String("f", "", "JSON or YAML file with the list of destination settings, - for stdin")
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	var configs []segment.DestinationConfig
+	if *file != "" {
+		if err := a.readInput(*file, &configs); err != nil {
+			return err
+		}
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	configs = expandConfigNames(a.workspace, args[0], args[1], configs)
+	d, err := c.CreateDestination(args[0], args[1], *connMode, *enabled, configs)
+	if err != nil {
+		return err
+	}
+	return a.print(d, destinationsTable(d))
+}
+
+func updateDestination(a *app, fs *flag.FlagSet, args []string) error {
+	enabled := fs.Bool("enabled", false, "enable or disable the destination (unchanged if omitted)")
+	file := fs.String("f", "", "JSON or YAML file with the list of destination settings, - for stdin (unchanged if omitted)")
+	displayName := fs.String("display-name", "", "display name of the destination (unchanged if omitted)")
+	connMode := fs.String("connection-mode", "", "connection mode of the destination: CLOUD or DEVICE (unchanged if omitted)")
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	// Only the flags given are sent, so the other fields keep their values.
+	var dest segment.Destination
+	var fields []segment.DestinationField
+	readConfigs := false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "enabled":
+			dest.Enabled = *enabled
+			fields = append(fields, segment.DestinationFieldEnabled)
+		case "f":
+			readConfigs = true
+			fields = append(fields, segment.DestinationFieldConfig)
+		case "display-name":
+			dest.DisplayName = *displayName
+			fields = append(fields, segment.DestinationFieldDisplayName)
+		case "connection-mode":
+			dest.ConnectionMode = strings.ToUpper(*connMode)
+			fields = append(fields, segment.DestinationFieldConnectionMode)
+		}
+	})
+	if len(fields) == 0 {
+		return fmt.Errorf("nothing to update: set -enabled, -f, -display-name and/or -connection-mode")
+	}
+	if readConfigs {
+		if err := a.readInput(*file, &dest.Configs); err != nil {
+			return err
+		}
+		dest.Configs = expandConfigNames(a.workspace, args[0], args[1], dest.Configs)
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	d, err := c.UpdateDestinationFields(args[0], args[1], dest, fields...)
+	if err != nil {
+		return err
+	}
+	return a.print(d, destinationsTable(d))
+}
+
+func patchDestination(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON or YAML file mapping setting names to values, - for stdin")
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+	var settings map[string]interface{}
+	if err := a.readInput(*file, &settings); err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	d, changes, err := c.PatchDestinationConfig(args[0], args[1], settings)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(a.stderr, "no settings changed")
+	}
+	for _, change := range changes {
+		fmt.Fprintln(a.stderr, change)
+	}
+	return a.print(d, destinationsTable(d))
+}
+
+func replaceDestination(a *app, fs *flag.FlagSet, args []string) error {
+	connMode := fs.String("connection-mode", "", "connection mode of the new destination: CLOUD or DEVICE (unchanged if omitted)")
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	dest, err := c.GetDestination(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if *connMode != "" {
+		dest.ConnectionMode = strings.ToUpper(*connMode)
+	}
+	d, err := c.ReplaceDestination(args[0], args[1], dest)
+	if d.Name != "" {
+		if perr := a.print(d, destinationsTable(d)); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+func deleteDestination(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeleteDestination(args[0], args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "destination %s of source %s deleted\n", args[1], args[0])
+	return nil
+}
+
+// expandConfigNames turns short setting names such as "apiKey" into the
+// fully qualified names expected by the Config API.
+func expandConfigNames(workspace, srcName, destName string, configs []segment.DestinationConfig) []segment.DestinationConfig {
+	for i, cfg := range configs {
+		if !strings.Contains(cfg.Name, "/") {
+			configs[i].Name = fmt.Sprintf("%s/%s/%s/%s/%s/%s/config/%s",
+				segment.WorkspacesEndpoint, workspace, segment.SourceEndpoint, srcName, segment.DestinationEndpoint, destName, cfg.Name)
+		}
+	}
+	return configs
+}
+
+func destinationsTable(destinations ...segment.Destination) table {
+	t := table{headers: []string{"NAME", "DISPLAY NAME", "ENABLED", "CONNECTION MODE", "SETTINGS"}}
+	for _, d := range destinations {
+		t.add(shortName(d.Name), d.DisplayName, fmt.Sprint(d.Enabled), d.ConnectionMode, fmt.Sprint(len(d.Configs)))
+	}
+	return t
+}
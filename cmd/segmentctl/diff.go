@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// fieldDiff is a single changed value between the live and desired state.
+// A nil old value means the field is added, a nil new value that it is
+// removed.
+type fieldDiff struct {
+	path string
+	old  interface{}
+	new  interface{}
+}
+
+// diffValues returns the differences between two values after normalising
+// both through their JSON representation.
+func diffValues(path string, old, new interface{}) []fieldDiff {
+	return diffNormalized(path, normalize(old), normalize(new))
+}
+
+// normalize converts v to the generic form produced by encoding/json so that
+// values of different Go types but equal JSON compare equal.
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func diffNormalized(path string, old, new interface{}) []fieldDiff {
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := map[string]bool{}
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var diffs []fieldDiff
+		for _, k := range sorted {
+			diffs = append(diffs, diffNormalized(joinPath(path, k), oldMap[k], newMap[k])...)
+		}
+		return diffs
+	}
+
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := new.([]interface{})
+	if oldIsList && newIsList && len(oldList) == len(newList) {
+		var diffs []fieldDiff
+		for i := range oldList {
+			diffs = append(diffs, diffNormalized(fmt.Sprintf("%s[%d]", path, i), oldList[i], newList[i])...)
+		}
+		return diffs
+	}
+
+	return []fieldDiff{{path: path, old: old, new: new}}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// printer renders plans, optionally with ANSI colors.
+type printer struct {
+	w     io.Writer
+	color bool
+}
+
+func (p printer) colorize(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (p printer) printDiffs(diffs []fieldDiff) {
+	for _, d := range diffs {
+		switch {
+		case d.old == nil:
+			fmt.Fprintln(p.w, p.colorize(colorGreen, fmt.Sprintf("      + %s: %s", d.path, formatValue(d.new))))
+		case d.new == nil:
+			fmt.Fprintln(p.w, p.colorize(colorRed, fmt.Sprintf("      - %s: %s", d.path, formatValue(d.old))))
+		default:
+			fmt.Fprintln(p.w, p.colorize(colorYellow, fmt.Sprintf("      ~ %s: %s => %s", d.path, formatValue(d.old), formatValue(d.new))))
+		}
+	}
+}
+
+// formatValue renders a value compactly on a single line.
+func formatValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	s := []rune(string(data))
+	if len(s) > 120 {
+		return string(s[:117]) + "..."
+	}
+	return string(s)
+}
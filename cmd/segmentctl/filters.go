@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ajbosco/segment-config-go/segment"
+)
+
+func filtersResource() resource {
+	return resource{
+		name:    "filters",
+		aliases: []string{"filter", "destination-filters"},
+		summary: "Manage the filters of a destination",
+		commands: []command{
+			{name: "list", args: "<source> <destination>", summary: "List the filters of a destination", run: listFilters},
+			{name: "get", args: "<source> <destination> <filter-id>", summary: "Show a filter", run: getFilter},
+			{name: "create", args: "<source> <destination>", summary: "Create the filter described in -f", run: createFilter},
+			{name: "update", args: "<source> <destination> <filter-id>", summary: "Replace a filter with the one described in -f", run: updateFilter},
+			{name: "delete", args: "<source> <destination> <filter-id>", summary: "Delete a filter", run: deleteFilter},
+		},
+	}
+}
+
+func listFilters(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	filters, err := c.ListDestinationFilters(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return a.print(filters, filtersTable(filters...))
+}
+
+func getFilter(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 3)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	f, err := c.GetDestinationFilter(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return a.print(f, filtersTable(*f))
+}
+
+func createFilter(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON or YAML file with the filter, - for stdin (required)")
+	args, err := a.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	filter, err := a.readFilter(*file)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	f, err := c.CreateDestinationFilter(args[0], args[1], filter)
+	if err != nil {
+		return err
+	}
+	return a.print(f, filtersTable(*f))
+}
+
+func updateFilter(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON or YAML file with the filter, - for stdin (required)")
+	args, err := a.parse(fs, args, 3)
+	if err != nil {
+		return err
+	}
+	filter, err := a.readFilter(*file)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	filter.Name = filterName(a.workspace, args[0], args[1], args[2])
+	f, err := c.UpdateDestinationFilter(args[0], args[1], filter)
+	if err != nil {
+		return err
+	}
+	return a.print(f, filtersTable(*f))
+}
+
+func deleteFilter(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 3)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeleteDestinationFilter(args[0], args[1], args[2]); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "filter %s of destination %s deleted\n", args[2], args[1])
+	return nil
+}
+
+func (a *app) readFilter(file string) (segment.DestinationFilter, error) {
+	var filter segment.DestinationFilter
+	if file == "" {
+		return filter, fmt.Errorf("-f is required")
+	}
+	err := a.readInput(file, &filter)
+	return filter, err
+}
+
+// filterName returns the fully qualified name of a destination filter.
+func filterName(workspace, srcName, destName, filterID string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s/%s/%s/%s",
+		segment.WorkspacesEndpoint, workspace, segment.SourceEndpoint, srcName, segment.DestinationEndpoint, destName, segment.DestinationFiltersEndpoint, filterID)
+}
+
+func filtersTable(filters ...segment.DestinationFilter) table {
+	t := table{headers: []string{"ID", "TITLE", "ENABLED", "ACTIONS", "IF"}}
+	for _, f := range filters {
+		t.add(shortName(f.Name), f.Title, fmt.Sprint(f.IsEnabled), actionTypes(f.Actions), f.Conditions)
+	}
+	return t
+}
+
+func actionTypes(actions segment.DestinationFilterActions) string {
+	types := make([]string, 0, len(actions))
+	for _, action := range actions {
+		types = append(types, string(action.ActionType()))
+	}
+	return strings.Join(types, ",")
+}
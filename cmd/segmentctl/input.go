@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/pkg/errors"
+)
+
+// readInput decodes the JSON or YAML document in path into v. A path of "-"
+// reads from stdin.
+func (a *app) readInput(path string, v interface{}) error {
+	var r io.Reader = a.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s failed", path)
+	}
+	return errors.Wrapf(segment.UnmarshalYAML(data, v), "decoding %s failed", path)
+}
+
+// readEvents reads a stream of JSON events from path. Each value in the
+// stream is either a single event or an array of events.
+func (a *app) readEvents(path string) ([]map[string]interface{}, error) {
+	var r io.Reader = a.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var events []map[string]interface{}
+	dec := json.NewDecoder(r)
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s failed: %v", path, err)
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, value := range values {
+			event, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("decoding %s failed: event %d is not an object", path, len(events))
+			}
+			events = append(events, event)
+		}
+	}
+}
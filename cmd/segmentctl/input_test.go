@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInput_DecodeYAMLFilter(t *testing.T) {
+	doc := `
+title: Drop identify calls
+if: type = "identify"
+enabled: true
+actions:
+  - type: drop_event
+`
+	var filter segment.DestinationFilter
+	assert.NoError(t, segment.UnmarshalYAML([]byte(doc), &filter))
+
+	expected := segment.DestinationFilter{
+		Title:      "Drop identify calls",
+		Conditions: `type = "identify"`,
+		IsEnabled:  true,
+		Actions:    segment.DestinationFilterActions{segment.NewDropEventAction()},
+	}
+	assert.Equal(t, expected, filter)
+}
+
+func TestInput_DecodeJSON(t *testing.T) {
+	var configs []segment.DestinationConfig
+	assert.NoError(t, segment.UnmarshalYAML([]byte(`[{"name": "apiKey", "type": "string", "value": "abc"}]`), &configs))
+	assert.Equal(t, []segment.DestinationConfig{{Name: "apiKey", Type: "string", Value: "abc"}}, configs)
+}
+
+func TestInput_ReadStdin(t *testing.T) {
+	a, _, _ := newTestApp(nil)
+	a.stdin = strings.NewReader("allow_unplanned_track_events: true\ncommon_track_event_on_violations: BLOCK\n")
+
+	var cfg segment.SourceConfig
+	assert.NoError(t, a.readInput("-", &cfg))
+	assert.Equal(t, segment.SourceConfig{AllowUnplannedTrackEvents: true, CommonTrackEventOnViolations: segment.Block}, cfg)
+}
+
+func TestInput_ReadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plan.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("display_name: My Plan\n"), 0644))
+
+	a, _, _ := newTestApp(nil)
+	tp, err := a.readTrackingPlan(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "My Plan", tp.DisplayName)
+}
+
+func TestInput_InvalidDocument(t *testing.T) {
+	var tp segment.TrackingPlan
+	assert.Error(t, segment.UnmarshalYAML([]byte("display_name: [unterminated"), &tp))
+}
+
+func TestExpandConfigNames(t *testing.T) {
+	configs := []segment.DestinationConfig{
+		{Name: "apiKey"},
+		{Name: "workspaces/other/sources/js/destinations/amplitude/config/secret"},
+	}
+
+	actual := expandConfigNames("myworkspace", "js", "amplitude", configs)
+	assert.Equal(t, "workspaces/myworkspace/sources/js/destinations/amplitude/config/apiKey", actual[0].Name)
+	assert.Equal(t, "workspaces/other/sources/js/destinations/amplitude/config/secret", actual[1].Name)
+}
+
+func TestInput_ReadEvents(t *testing.T) {
+	a, _, _ := newTestApp(nil)
+	a.stdin = strings.NewReader(`{"type": "identify"}
+[{"type": "track", "event": "A"}, {"type": "group"}]`)
+
+	events, err := a.readEvents("-")
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"type": "identify"},
+		{"type": "track", "event": "A"},
+		{"type": "group"},
+	}, events)
+
+	a.stdin = strings.NewReader(`[{"type": "identify"}, "track"]`)
+	_, err = a.readEvents("-")
+	assert.EqualError(t, err, "decoding - failed: event 1 is not an object")
+}
@@ -0,0 +1,255 @@
+// Command segmentctl is a command-line interface to the Segment Config API.
+//
+// Usage:
+//
+//	segmentctl <resource> <command> [flags] [args]
+//	segmentctl plan|apply -f <dir>
+//
+// The access token and workspace are read from the -token and -workspace
+// flags, falling back to the SEGMENT_ACCESS_TOKEN and SEGMENT_WORKSPACE
+// environment variables.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ajbosco/segment-config-go/segment"
+)
+
+const (
+	tokenEnv     = "SEGMENT_ACCESS_TOKEN"
+	workspaceEnv = "SEGMENT_WORKSPACE"
+)
+
+// errUsage is returned when a command is invoked with invalid arguments.
+// The usage text has already been printed when it is returned.
+var errUsage = errors.New("invalid usage")
+
+// errHelp is returned when help was asked for with -h. The usage text has
+// already been printed, and the command succeeds.
+var errHelp = errors.New("help requested")
+
+// exitCode is returned by commands that finish with a specific exit status
+// rather than an error, such as plan reporting pending changes.
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+// resource groups the commands operating on a single kind of Segment object.
+type resource struct {
+	name     string
+	aliases  []string
+	summary  string
+	commands []command
+}
+
+// command is a single action on a resource, e.g. "sources list".
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(a *app, fs *flag.FlagSet, args []string) error
+}
+
+// app holds the state shared by every command invocation.
+type app struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+
+	token     string
+	workspace string
+	output    string
+}
+
+func main() {
+	a := &app{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+	}
+	os.Exit(a.run(os.Args[1:]))
+}
+
+// commands returns the commands that are not tied to a single resource.
+func commands() []command {
+	return []command{
+		planCommand(),
+		applyCommand(),
+	}
+}
+
+func resources() []resource {
+	return []resource{
+		workspaceResource(),
+		sourcesResource(),
+		sourceConfigResource(),
+		destinationsResource(),
+		filtersResource(),
+		trackingPlansResource(),
+	}
+}
+
+// run executes the command described by args and returns the process exit code.
+func (a *app) run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage()
+		return 0
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name == args[0] {
+			return a.runCommand("", cmd, args[1:])
+		}
+	}
+
+	res, ok := findResource(args[0])
+	if !ok {
+		fmt.Fprintf(a.stderr, "segmentctl: unknown resource %q\n\n", args[0])
+		a.usage()
+		return 1
+	}
+	if len(args) < 2 || args[1] == "help" || args[1] == "-h" || args[1] == "--help" {
+		a.resourceUsage(res)
+		return 0
+	}
+
+	for _, cmd := range res.commands {
+		if cmd.name == args[1] {
+			return a.runCommand(res.name, cmd, args[2:])
+		}
+	}
+
+	fmt.Fprintf(a.stderr, "segmentctl: unknown command %q for %s\n\n", args[1], res.name)
+	a.resourceUsage(res)
+	return 1
+}
+
+func (a *app) runCommand(res string, cmd command, args []string) int {
+	err := cmd.run(a, a.flags(res, cmd), args)
+	if err == errHelp {
+		return 0
+	}
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case exitCode:
+		return int(err)
+	default:
+		if err != errUsage {
+			fmt.Fprintf(a.stderr, "segmentctl: %s\n", err)
+		}
+		return 1
+	}
+}
+
+func findResource(name string) (resource, bool) {
+	for _, res := range resources() {
+		if res.name == name {
+			return res, true
+		}
+		for _, alias := range res.aliases {
+			if alias == name {
+				return res, true
+			}
+		}
+	}
+	return resource{}, false
+}
+
+func (a *app) usage() {
+	fmt.Fprintf(a.stderr, "Usage: segmentctl <resource> <command> [flags] [args]\n\nResources:\n")
+	w := tabwriter.NewWriter(a.stderr, 0, 4, 2, ' ', 0)
+	for _, res := range resources() {
+		fmt.Fprintf(w, "  %s\t%s\n", res.name, res.summary)
+	}
+	w.Flush()
+	fmt.Fprintf(a.stderr, "\nCommands:\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintf(a.stderr, "\nRun 'segmentctl <resource> help' for the commands of a resource.\n")
+}
+
+func (a *app) resourceUsage(res resource) {
+	fmt.Fprintf(a.stderr, "Usage: segmentctl %s <command> [flags] [args]\n\nCommands:\n", res.name)
+	w := tabwriter.NewWriter(a.stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range res.commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	w.Flush()
+}
+
+// flags returns a flag set for the given command with the global flags
+// already registered.
+func (a *app) flags(res string, cmd command) *flag.FlagSet {
+	name := strings.TrimSpace(res + " " + cmd.name)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.StringVar(&a.token, "token", a.getenv(tokenEnv), "Segment access token (env "+tokenEnv+")")
+	fs.StringVar(&a.workspace, "workspace", a.getenv(workspaceEnv), "Segment workspace slug (env "+workspaceEnv+")")
+	fs.StringVar(&a.output, "o", formatTable, "output format: table, json or yaml")
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: segmentctl %s [flags] %s\n\n%s\n\nFlags:\n", name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the command line and checks the number of positional arguments.
+// Flags may appear before, between or after the positional arguments.
+func (a *app) parse(fs *flag.FlagSet, args []string, nargs int) ([]string, error) {
+	var positional []string
+	for {
+		// The flag package has already reported the problem and printed usage.
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, errHelp
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) != nargs {
+		fmt.Fprintf(a.stderr, "expected %d argument(s), got %d\n\n", nargs, len(positional))
+		fs.Usage()
+		return nil, errUsage
+	}
+	if !validFormat(a.output) {
+		return nil, fmt.Errorf("unknown output format %q", a.output)
+	}
+	return positional, nil
+}
+
+// client builds a Segment client from the global flags.
+func (a *app) client() (*segment.Client, error) {
+	if a.token == "" {
+		return nil, fmt.Errorf("an access token is required: set -token or %s", tokenEnv)
+	}
+	if a.workspace == "" {
+		return nil, fmt.Errorf("a workspace is required: set -workspace or %s", workspaceEnv)
+	}
+	return segment.NewClient(a.token, a.workspace), nil
+}
+
+// shortName returns the last segment of a Segment resource name, e.g.
+// "js" for "workspaces/myworkspace/sources/js".
+func shortName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
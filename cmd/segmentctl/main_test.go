@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestApp(env map[string]string) (*app, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	a := &app{
+		stdin:  strings.NewReader(""),
+		stdout: &stdout,
+		stderr: &stderr,
+		getenv: func(key string) string { return env[key] },
+	}
+	return a, &stdout, &stderr
+}
+
+func TestApp_Usage(t *testing.T) {
+	a, _, stderr := newTestApp(nil)
+
+	assert.Equal(t, 0, a.run(nil))
+	assert.Contains(t, stderr.String(), "tracking-plans")
+	assert.Contains(t, stderr.String(), "destinations")
+}
+
+func TestApp_ResourceUsage(t *testing.T) {
+	a, _, stderr := newTestApp(nil)
+
+	assert.Equal(t, 0, a.run([]string{"tp", "help"}))
+	assert.Contains(t, stderr.String(), "Usage: segmentctl tracking-plans <command>")
+	assert.Contains(t, stderr.String(), "update <plan-id>")
+}
+
+func TestApp_CommandHelp(t *testing.T) {
+	a, stdout, stderr := newTestApp(nil)
+
+	assert.Equal(t, 0, a.run([]string{"sources", "list", "-h"}))
+	assert.Contains(t, stderr.String(), "Usage: segmentctl sources list")
+	assert.NotContains(t, stderr.String(), "segmentctl: help requested")
+	assert.Empty(t, stdout.String())
+
+	a, _, _ = newTestApp(nil)
+	assert.Equal(t, 0, a.run([]string{"plan", "--help"}))
+}
+
+func TestApp_UnknownResource(t *testing.T) {
+	a, _, stderr := newTestApp(nil)
+
+	assert.Equal(t, 1, a.run([]string{"nope", "list"}))
+	assert.Contains(t, stderr.String(), `unknown resource "nope"`)
+}
+
+func TestApp_UnknownCommand(t *testing.T) {
+	a, _, stderr := newTestApp(nil)
+
+	assert.Equal(t, 1, a.run([]string{"sources", "nope"}))
+	assert.Contains(t, stderr.String(), `unknown command "nope" for sources`)
+}
+
+func TestApp_WrongArgumentCount(t *testing.T) {
+	a, _, stderr := newTestApp(nil)
+
+	assert.Equal(t, 1, a.run([]string{"destinations", "get", "js"}))
+	assert.Contains(t, stderr.String(), "expected 2 argument(s), got 1")
+}
+
+func TestApp_MissingToken(t *testing.T) {
+	a, _, stderr := newTestApp(map[string]string{workspaceEnv: "myworkspace"})
+
+	assert.Equal(t, 1, a.run([]string{"sources", "list"}))
+	assert.Contains(t, stderr.String(), "an access token is required")
+}
+
+func TestApp_MissingWorkspace(t *testing.T) {
+	a, _, stderr := newTestApp(nil)
+
+	assert.Equal(t, 1, a.run([]string{"sources", "list", "-token", "secret"}))
+	assert.Contains(t, stderr.String(), "a workspace is required")
+}
+
+func TestApp_InvalidOutputFormat(t *testing.T) {
+	a, _, stderr := newTestApp(map[string]string{tokenEnv: "secret", workspaceEnv: "myworkspace"})
+
+	assert.Equal(t, 1, a.run([]string{"sources", "list", "-o", "xml"}))
+	assert.Contains(t, stderr.String(), `unknown output format "xml"`)
+}
+
+func TestApp_ParseInterspersedFlags(t *testing.T) {
+	a, _, _ := newTestApp(map[string]string{tokenEnv: "from-env"})
+	fs := a.flags("destinations", command{name: "get"})
+
+	args, err := a.parse(fs, []string{"js", "-o", "json", "google-analytics", "-token", "from-flag"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"js", "google-analytics"}, args)
+	assert.Equal(t, formatJSON, a.output)
+	assert.Equal(t, "from-flag", a.token)
+}
+
+func TestApp_ValidateEvents(t *testing.T) {
+	dir := t.TempDir()
+	tp := segment.TrackingPlan{DisplayName: "My Plan"}
+	tp.Rules.Events = []segment.Event{{
+		Name: "Order Completed",
+		Rules: segment.Rules{Properties: segment.RuleProperties{Properties: segment.Properties{
+			Type:     "object",
+			Required: []string{"order_id"},
+		}}},
+	}}
+	assert.NoError(t, segment.ExportTrackingPlan(tp, dir, segment.TrackingPlanFormatYAML))
+
+	a, stdout, _ := newTestApp(nil)
+	a.stdin = strings.NewReader(`{"type": "track", "event": "Order Completed", "properties": {"order_id": "o_1"}}`)
+	assert.Equal(t, 0, a.run([]string{"tp", "validate", "-d", dir, "-f", "-"}))
+
+	a, stdout, _ = newTestApp(nil)
+	a.stdin = strings.NewReader(`{"type": "track", "event": "Order Completed", "properties": {}}`)
+	assert.Equal(t, exitViolations, a.run([]string{"tp", "validate", "-d", dir, "-f", "-"}))
+	assert.Contains(t, stdout.String(), "properties.order_id is required")
+
+	a, _, stderr := newTestApp(nil)
+	assert.Equal(t, 1, a.run([]string{"tp", "validate", "-f", "-"}))
+	assert.Contains(t, stderr.String(), "exactly one of -plan and -d is required")
+}
+
+func TestApp_LintTrackingPlan(t *testing.T) {
+	dir := t.TempDir()
+	tp := segment.TrackingPlan{DisplayName: "My Plan"}
+	tp.Rules.Events = []segment.Event{{
+		Name: "Order Completed",
+		Rules: segment.Rules{Properties: segment.RuleProperties{Properties: segment.Properties{
+			Properties: map[string]segment.Property{"orderId": {Type: "string", Description: "id of the order"}},
+		}}},
+	}}
+	assert.NoError(t, segment.ExportTrackingPlan(tp, dir, segment.TrackingPlanFormatYAML))
+
+	a, _, _ := newTestApp(nil)
+	assert.Equal(t, 0, a.run([]string{"tp", "lint", "-d", dir, "-property-case", "camelCase"}))
+
+	a, stdout, _ := newTestApp(nil)
+	assert.Equal(t, 0, a.run([]string{"tp", "lint", "-d", dir}))
+	assert.Contains(t, stdout.String(), `property name "orderId" is not snake_case`)
+
+	tp.Rules.Events = append(tp.Rules.Events, tp.Rules.Events[0])
+	assert.NoError(t, segment.ExportTrackingPlan(tp, dir, segment.TrackingPlanFormatYAML))
+	a, _, _ = newTestApp(nil)
+	assert.Equal(t, exitLintErrors, a.run([]string{"tp", "lint", "-d", dir, "-property-case", "camelCase"}))
+}
+
+func TestShortName(t *testing.T) {
+	assert.Equal(t, "js", shortName("workspaces/myworkspace/sources/js"))
+	assert.Equal(t, "js", shortName("js"))
+}
+
+func TestApp_InferTrackingPlan(t *testing.T) {
+	events := `{"type": "track", "event": "Order Completed", "properties": {"order_id": "o_1", "total": 10}}
+		[{"type": "track", "event": "Order Completed", "properties": {"order_id": "o_2"}}]`
+
+	dir := t.TempDir()
+	a, stdout, _ := newTestApp(nil)
+	a.stdin = strings.NewReader(events)
+	assert.Equal(t, 0, a.run([]string{"tp", "infer", "-f", "-", "-name", "Shop", "-d", dir}))
+	assert.Contains(t, stdout.String(), "tracking plan inferred from 2 events")
+
+	tp, err := segment.ImportTrackingPlan(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "Shop", tp.DisplayName)
+	props := tp.Rules.Events[0].Rules.Properties.Properties
+	assert.Equal(t, []string{"order_id"}, props.Required)
+	assert.Equal(t, segment.Property{Type: "integer"}, props.Properties["total"])
+
+	a, _, stderr := newTestApp(nil)
+	a.stdin = strings.NewReader(`{"type": "track"}`)
+	assert.Equal(t, 1, a.run([]string{"tp", "infer", "-f", "-"}))
+	assert.Contains(t, stderr.String(), "event 0: track event has no event name")
+}
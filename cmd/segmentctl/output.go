@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ajbosco/segment-config-go/segment"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+func validFormat(format string) bool {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return true
+	}
+	return false
+}
+
+// table is the tabular representation of a command result.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+func (t *table) add(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// print writes v to the app's output in the selected format. The table is
+// only used for the table format; json and yaml render v itself.
+func (a *app) print(v interface{}, t table) error {
+	switch a.output {
+	case formatJSON:
+		return writeJSON(a.stdout, v)
+	case formatYAML:
+		return writeYAML(a.stdout, v)
+	default:
+		return writeTable(a.stdout, t)
+	}
+}
+
+func writeTable(w io.Writer, t table) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML renders v as YAML, see segment.MarshalYAML
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := segment.MarshalYAML(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDestination = segment.Destination{
+	Name:           "workspaces/myworkspace/sources/js/destinations/google-analytics",
+	DisplayName:    "Google Analytics",
+	Enabled:        true,
+	ConnectionMode: "CLOUD",
+	Configs: []segment.DestinationConfig{
+		{Name: "workspaces/myworkspace/sources/js/destinations/google-analytics/config/domain", Value: "true", Type: "string"},
+	},
+}
+
+func TestOutput_Table(t *testing.T) {
+	a, stdout, _ := newTestApp(nil)
+	a.output = formatTable
+
+	assert.NoError(t, a.print(testDestination, destinationsTable(testDestination)))
+	assert.Equal(t, ""+
+		"NAME               DISPLAY NAME       ENABLED   CONNECTION MODE   SETTINGS\n"+
+		"google-analytics   Google Analytics   true      CLOUD             1\n",
+		stdout.String())
+}
+
+func TestOutput_JSON(t *testing.T) {
+	a, stdout, _ := newTestApp(nil)
+	a.output = formatJSON
+
+	w := segment.Workspace{Name: "workspaces/myworkspace", ID: "jwt9cirmwq", CreateTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	assert.NoError(t, a.print(w, workspaceTable(w)))
+	assert.Equal(t, `{
+  "name": "workspaces/myworkspace",
+  "id": "jwt9cirmwq",
+  "create_time": "2020-01-02T03:04:05Z"
+}
+`, stdout.String())
+}
+
+func TestOutput_YAML(t *testing.T) {
+	a, stdout, _ := newTestApp(nil)
+	a.output = formatYAML
+
+	assert.NoError(t, a.print(testDestination, destinationsTable(testDestination)))
+	assert.Equal(t, `name: workspaces/myworkspace/sources/js/destinations/google-analytics
+display_name: Google Analytics
+enabled: true
+connection_mode: CLOUD
+config:
+  - name: workspaces/myworkspace/sources/js/destinations/google-analytics/config/domain
+    value: "true"
+    type: string
+create_time: "0001-01-01T00:00:00Z"
+update_time: "0001-01-01T00:00:00Z"
+`, stdout.String())
+}
+
+func TestOutput_YAMLRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeYAML(&buf, testDestination))
+
+	var actual segment.Destination
+	assert.NoError(t, segment.UnmarshalYAML(buf.Bytes(), &actual))
+	assert.Equal(t, testDestination, actual)
+}
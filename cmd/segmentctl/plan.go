@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/pkg/errors"
+)
+
+// Exit codes of the plan command, suitable for CI pipelines.
+const (
+	exitNoChanges      = 0
+	exitChangesPending = 2
+)
+
+// workspaceAPI is the subset of *segment.Client used by plan and apply.
+type workspaceAPI interface {
+	ListSources() (segment.Sources, error)
+	CreateSource(srcName string, catName string) (segment.Source, error)
+	GetSourceConfig(srcName string) (segment.SourceConfig, error)
+	PatchSourceConfig(srcName string, config segment.SourceConfig, fields ...segment.SourceConfigField) (segment.SourceConfig, error)
+	ListDestinations(srcName string) (segment.Destinations, error)
+	CreateDestination(srcName string, destName string, connMode string, enabled bool, configs []segment.DestinationConfig) (segment.Destination, error)
+	UpdateDestinationFields(srcName string, destName string, dest segment.Destination, fields ...segment.DestinationField) (segment.Destination, error)
+	ListDestinationFilters(srcName string, destinationName string) ([]segment.DestinationFilter, error)
+	CreateDestinationFilter(srcName string, destinationName string, filter segment.DestinationFilter) (*segment.DestinationFilter, error)
+	UpdateDestinationFilterFields(srcName string, destinationName string, filter segment.DestinationFilter, fields ...segment.DestinationFilterField) (*segment.DestinationFilter, error)
+	ListTrackingPlans() (segment.TrackingPlans, error)
+	GetTrackingPlan(trackingPlanID string) (segment.TrackingPlan, error)
+	CreateTrackingPlan(data segment.TrackingPlan) (segment.TrackingPlan, error)
+	UpdateTrackingPlan(trackingPlanID string, data segment.TrackingPlan) (segment.TrackingPlan, error)
+	ListTrackingPlanSources(planId string) ([]segment.TrackingPlanSourceConnection, error)
+	CreateTrackingPlanSourceConnection(planId string, sourceName string) error
+	DeleteTrackingPlanSourceConnection(planId string, sourceName string) error
+}
+
+type changeAction string
+
+const (
+	actionCreate changeAction = "create"
+	actionUpdate changeAction = "update"
+)
+
+// change is a single pending modification of the workspace.
+type change struct {
+	action  changeAction
+	kind    string
+	address string
+	diffs   []fieldDiff
+	apply   func() error
+}
+
+func planCommand() command {
+	return command{name: "plan", args: "-f <dir>", summary: "Show the changes needed to make the workspace match a config directory", run: runPlan}
+}
+
+func applyCommand() command {
+	return command{name: "apply", args: "-f <dir>", summary: "Apply the changes needed to make the workspace match a config directory", run: runApply}
+}
+
+func runPlan(a *app, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("f", "", "config directory or file (required)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	changes, err := a.plan(*dir)
+	if err != nil {
+		return err
+	}
+	p := a.printer(*noColor)
+	p.printPlan(changes)
+	if len(changes) > 0 {
+		return exitCode(exitChangesPending)
+	}
+	return exitCode(exitNoChanges)
+}
+
+func runApply(a *app, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("f", "", "config directory or file (required)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	autoApprove := fs.Bool("auto-approve", false, "apply without asking for confirmation")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	changes, err := a.plan(*dir)
+	if err != nil {
+		return err
+	}
+	p := a.printer(*noColor)
+	p.printPlan(changes)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if !*autoApprove {
+		fmt.Fprint(a.stdout, "\nDo you want to apply these changes? Only 'yes' will be accepted: ")
+		answer, _ := bufio.NewReader(a.stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			return fmt.Errorf("apply cancelled")
+		}
+	}
+
+	fmt.Fprintln(a.stdout)
+	for i, ch := range changes {
+		fmt.Fprintf(a.stdout, "%s %s %s...\n", ch.action, ch.kind, ch.address)
+		if err := ch.apply(); err != nil {
+			return errors.Wrapf(err, "%s %s %s failed after %d of %d changes", ch.action, ch.kind, ch.address, i, len(changes))
+		}
+	}
+	fmt.Fprintf(a.stdout, "\nApply complete: %d change(s) applied.\n", len(changes))
+	return nil
+}
+
+func (a *app) plan(dir string) ([]change, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("-f is required")
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	c, err := a.client()
+	if err != nil {
+		return nil, err
+	}
+	return computePlan(c, a.workspace, cfg)
+}
+
+func (a *app) printer(noColor bool) printer {
+	return printer{w: a.stdout, color: !noColor && a.getenv("NO_COLOR") == "" && isTerminal(a.stdout)}
+}
+
+func isTerminal(w interface{}) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// planner compares the desired config with the live workspace.
+type planner struct {
+	api       workspaceAPI
+	workspace string
+	changes   []change
+}
+
+// computePlan returns the changes needed to make the workspace match cfg,
+// in the order they must be applied.
+func computePlan(api workspaceAPI, workspace string, cfg config) ([]change, error) {
+	p := &planner{api: api, workspace: workspace}
+	if err := p.planSources(cfg.Sources); err != nil {
+		return nil, err
+	}
+	if err := p.planTrackingPlans(cfg.TrackingPlans); err != nil {
+		return nil, err
+	}
+	return p.changes, nil
+}
+
+func (p *planner) add(ch change) {
+	p.changes = append(p.changes, ch)
+}
+
+func (p *planner) planSources(specs []sourceSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	live, err := p.api.ListSources()
+	if err != nil {
+		return errors.Wrap(err, "listing sources failed")
+	}
+	existing := map[string]bool{}
+	for _, src := range live.Sources {
+		existing[shortName(src.Name)] = true
+	}
+
+	for _, spec := range specs {
+		spec := spec
+		if !existing[spec.Name] {
+			if spec.CatalogName == "" {
+				return fmt.Errorf("source %s does not exist and has no catalog_name to create it from", spec.Name)
+			}
+			p.add(change{
+				action:  actionCreate,
+				kind:    "source",
+				address: spec.Name,
+				diffs:   diffValues("", nil, map[string]string{"catalog_name": spec.CatalogName}),
+				apply: func() error {
+					_, err := p.api.CreateSource(spec.Name, spec.CatalogName)
+					return err
+				},
+			})
+			if spec.SchemaConfig != nil {
+				p.planSourceConfig(spec.Name, segment.SourceConfig{}, *spec.SchemaConfig)
+			}
+			for _, dest := range spec.Destinations {
+				p.planNewDestination(spec.Name, dest)
+			}
+			continue
+		}
+
+		if spec.SchemaConfig != nil {
+			live, err := p.api.GetSourceConfig(spec.Name)
+			if err != nil {
+				return errors.Wrapf(err, "getting schema config of source %s failed", spec.Name)
+			}
+			p.planSourceConfig(spec.Name, live, *spec.SchemaConfig)
+		}
+		if err := p.planDestinations(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planSourceConfig updates the settings listed in the spec that differ from
+// the live ones.
+func (p *planner) planSourceConfig(srcName string, live segment.SourceConfig, desired sourceConfigSpec) {
+	liveView := sourceConfigView(live)
+	desiredView := sourceConfigView(desired.SourceConfig)
+	var diffs []fieldDiff
+	var fields []segment.SourceConfigField
+	for _, field := range desired.fields {
+		d := diffValues(string(field), liveView[string(field)], desiredView[string(field)])
+		if len(d) > 0 {
+			diffs = append(diffs, d...)
+			fields = append(fields, field)
+		}
+	}
+	if len(diffs) == 0 {
+		return
+	}
+	p.add(change{
+		action:  actionUpdate,
+		kind:    "schema config",
+		address: srcName,
+		diffs:   diffs,
+		apply: func() error {
+			_, err := p.api.PatchSourceConfig(srcName, desired.SourceConfig, fields...)
+			return err
+		},
+	})
+}
+
+func (p *planner) planDestinations(src sourceSpec) error {
+	if len(src.Destinations) == 0 {
+		return nil
+	}
+	live, err := p.api.ListDestinations(src.Name)
+	if err != nil {
+		return errors.Wrapf(err, "listing destinations of source %s failed", src.Name)
+	}
+	existing := map[string]segment.Destination{}
+	for _, dest := range live.Destinations {
+		existing[shortName(dest.Name)] = dest
+	}
+
+	for _, spec := range src.Destinations {
+		dest, ok := existing[spec.Name]
+		if !ok {
+			p.planNewDestination(src.Name, spec)
+			continue
+		}
+		if err := p.planDestinationUpdate(src.Name, dest, spec); err != nil {
+			return err
+		}
+		if err := p.planFilters(src.Name, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *planner) planNewDestination(srcName string, spec destinationSpec) {
+	connMode := spec.ConnectionMode
+	if connMode == "" {
+		connMode = "CLOUD"
+	}
+	enabled := spec.Enabled != nil && *spec.Enabled
+	var configs []segment.DestinationConfig
+	for _, name := range sortedKeys(spec.Config) {
+		configs = append(configs, segment.DestinationConfig{Name: name, Value: spec.Config[name]})
+	}
+	configs = expandConfigNames(p.workspace, srcName, spec.Name, configs)
+
+	p.add(change{
+		action:  actionCreate,
+		kind:    "destination",
+		address: srcName + "/" + spec.Name,
+		diffs: diffValues("", nil, map[string]interface{}{
+			"connection_mode": connMode,
+			"enabled":         enabled,
+			"config":          spec.Config,
+		}),
+		apply: func() error {
+			_, err := p.api.CreateDestination(srcName, spec.Name, connMode, enabled, configs)
+			return err
+		},
+	})
+	for _, f := range spec.Filters {
+		p.planNewFilter(srcName, spec.Name, f.DestinationFilter)
+	}
+}
+
+func (p *planner) planDestinationUpdate(srcName string, live segment.Destination, spec destinationSpec) error {
+	address := srcName + "/" + spec.Name
+	if spec.ConnectionMode != "" && !strings.EqualFold(spec.ConnectionMode, live.ConnectionMode) {
+		return fmt.Errorf("destination %s: connection_mode cannot be changed from %s to %s in place", address, live.ConnectionMode, spec.ConnectionMode)
+	}
+
+	var diffs []fieldDiff
+	if spec.Enabled != nil {
+		diffs = diffValues("enabled", live.Enabled, *spec.Enabled)
+	}
+	liveValues := map[string]interface{}{}
+	for _, cfg := range live.Configs {
+		liveValues[shortName(cfg.Name)] = cfg.Value
+	}
+	for _, name := range sortedKeys(spec.Config) {
+		diffs = append(diffs, diffValues("config."+name, liveValues[name], spec.Config[name])...)
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	// Keep every live setting, replacing the ones listed in the spec.
+	var configs []segment.DestinationConfig
+	seen := map[string]bool{}
+	for _, cfg := range live.Configs {
+		name := shortName(cfg.Name)
+		if value, ok := spec.Config[name]; ok {
+			cfg.Value = value
+			seen[name] = true
+		}
+		configs = append(configs, cfg)
+	}
+	for _, name := range sortedKeys(spec.Config) {
+		if !seen[name] {
+			configs = append(configs, segment.DestinationConfig{Name: name, Value: spec.Config[name]})
+		}
+	}
+	dest := segment.Destination{Configs: expandConfigNames(p.workspace, srcName, spec.Name, configs)}
+	fields := []segment.DestinationField{segment.DestinationFieldConfig}
+	if spec.Enabled != nil {
+		dest.Enabled = *spec.Enabled
+		fields = append([]segment.DestinationField{segment.DestinationFieldEnabled}, fields...)
+	}
+
+	p.add(change{
+		action:  actionUpdate,
+		kind:    "destination",
+		address: address,
+		diffs:   diffs,
+		apply: func() error {
+			_, err := p.api.UpdateDestinationFields(srcName, spec.Name, dest, fields...)
+			return err
+		},
+	})
+	return nil
+}
+
+func (p *planner) planFilters(srcName string, dest destinationSpec) error {
+	if len(dest.Filters) == 0 {
+		return nil
+	}
+	live, err := p.api.ListDestinationFilters(srcName, dest.Name)
+	if err != nil {
+		return errors.Wrapf(err, "listing filters of destination %s/%s failed", srcName, dest.Name)
+	}
+	existing := map[string]segment.DestinationFilter{}
+	for _, f := range live {
+		existing[f.Title] = f
+	}
+
+	for _, spec := range dest.Filters {
+		liveFilter, ok := existing[spec.Title]
+		if !ok {
+			p.planNewFilter(srcName, dest.Name, spec.DestinationFilter)
+			continue
+		}
+
+		// Filters are identified by title; the name is assigned by Segment.
+		// Only the fields listed in the spec are compared and sent.
+		desired := spec.DestinationFilter
+		desired.Name = liveFilter.Name
+		liveView := filterView(liveFilter)
+		desiredView := filterView(desired)
+		var diffs []fieldDiff
+		var fields []segment.DestinationFilterField
+		for _, field := range spec.fields {
+			d := diffValues(string(field), liveView[string(field)], desiredView[string(field)])
+			if len(d) > 0 {
+				diffs = append(diffs, d...)
+				fields = append(fields, field)
+			}
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+		destName := dest.Name
+		p.add(change{
+			action:  actionUpdate,
+			kind:    "filter",
+			address: fmt.Sprintf("%s/%s/%q", srcName, destName, spec.Title),
+			diffs:   diffs,
+			apply: func() error {
+				_, err := p.api.UpdateDestinationFilterFields(srcName, destName, desired, fields...)
+				return err
+			},
+		})
+	}
+	return nil
+}
+
+func (p *planner) planNewFilter(srcName, destName string, f segment.DestinationFilter) {
+	p.add(change{
+		action:  actionCreate,
+		kind:    "filter",
+		address: fmt.Sprintf("%s/%s/%q", srcName, destName, f.Title),
+		diffs:   diffValues("", nil, f),
+		apply: func() error {
+			_, err := p.api.CreateDestinationFilter(srcName, destName, f)
+			return err
+		},
+	})
+}
+
+func (p *planner) planTrackingPlans(specs []trackingPlanSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	live, err := p.api.ListTrackingPlans()
+	if err != nil {
+		return errors.Wrap(err, "listing tracking plans failed")
+	}
+	existing := map[string]string{}
+	for _, tp := range live.TrackingPlans {
+		existing[tp.DisplayName] = shortName(tp.Name)
+	}
+
+	for _, spec := range specs {
+		spec := spec
+		planID, ok := existing[spec.DisplayName]
+		if !ok {
+			diffs := diffValues("rules", nil, rulesView(spec.Rules))
+			if len(spec.Sources) > 0 {
+				diffs = append(diffs, diffValues("sources", nil, spec.Sources)...)
+			}
+			p.add(change{
+				action:  actionCreate,
+				kind:    "tracking plan",
+				address: fmt.Sprintf("%q", spec.DisplayName),
+				diffs:   diffs,
+				apply: func() error {
+					tp, err := p.api.CreateTrackingPlan(segment.TrackingPlan{DisplayName: spec.DisplayName, Rules: spec.Rules})
+					if err != nil {
+						return err
+					}
+					for _, src := range spec.Sources {
+						if err := p.api.CreateTrackingPlanSourceConnection(shortName(tp.Name), src); err != nil {
+							return errors.Wrapf(err, "connecting source %s failed", src)
+						}
+					}
+					return nil
+				},
+			})
+			continue
+		}
+
+		tp, err := p.api.GetTrackingPlan(planID)
+		if err != nil {
+			return errors.Wrapf(err, "getting tracking plan %s failed", planID)
+		}
+		if diffs := diffValues("rules", rulesView(tp.Rules), rulesView(spec.Rules)); len(diffs) > 0 {
+			p.add(change{
+				action:  actionUpdate,
+				kind:    "tracking plan",
+				address: fmt.Sprintf("%q (%s)", spec.DisplayName, planID),
+				diffs:   diffs,
+				apply: func() error {
+					_, err := p.api.UpdateTrackingPlan(planID, segment.TrackingPlan{DisplayName: spec.DisplayName, Rules: spec.Rules})
+					return err
+				},
+			})
+		}
+		if spec.Sources != nil {
+			if err := p.planTrackingPlanSources(planID, spec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *planner) planTrackingPlanSources(planID string, spec trackingPlanSpec) error {
+	connections, err := p.api.ListTrackingPlanSources(planID)
+	if err != nil {
+		return errors.Wrapf(err, "listing sources of tracking plan %s failed", planID)
+	}
+	connected := map[string]bool{}
+	for _, conn := range connections {
+		connected[shortName(conn.Source)] = true
+	}
+	desired := map[string]bool{}
+	for _, src := range spec.Sources {
+		desired[src] = true
+	}
+
+	var diffs []fieldDiff
+	var added, removed []string
+	for _, src := range spec.Sources {
+		if !connected[src] {
+			added = append(added, src)
+			diffs = append(diffs, fieldDiff{path: "sources", new: src})
+		}
+	}
+	for _, conn := range connections {
+		if src := shortName(conn.Source); !desired[src] {
+			removed = append(removed, src)
+			diffs = append(diffs, fieldDiff{path: "sources", old: src})
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	p.add(change{
+		action:  actionUpdate,
+		kind:    "tracking plan sources",
+		address: fmt.Sprintf("%q (%s)", spec.DisplayName, planID),
+		diffs:   diffs,
+		apply: func() error {
+			for _, src := range added {
+				if err := p.api.CreateTrackingPlanSourceConnection(planID, src); err != nil {
+					return errors.Wrapf(err, "connecting source %s failed", src)
+				}
+			}
+			for _, src := range removed {
+				if err := p.api.DeleteTrackingPlanSourceConnection(planID, src); err != nil {
+					return errors.Wrapf(err, "disconnecting source %s failed", src)
+				}
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// sourceConfigView returns every setting of a schema config so that changes
+// to and from false or empty values are reported as such.
+func sourceConfigView(cfg segment.SourceConfig) map[string]interface{} {
+	view := map[string]interface{}{}
+	for _, setting := range sourceConfigSettings(cfg) {
+		view[setting.name] = setting.value
+	}
+	return view
+}
+
+// filterView returns the fields of a filter keyed by their JSON name.
+func filterView(f segment.DestinationFilter) map[string]interface{} {
+	view, _ := normalize(f).(map[string]interface{})
+	return view
+}
+
+// rulesView keys the events of a rule set by name (and version) so that the
+// diff of two rule sets reads per event rather than per slice index.
+func rulesView(rules segment.RuleSet) map[string]interface{} {
+	events := map[string]interface{}{}
+	for _, e := range rules.Events {
+		key := e.Name
+		if e.Version != nil && *e.Version > 1 {
+			key = fmt.Sprintf("%s@v%d", e.Name, *e.Version)
+		}
+		events[key] = e
+	}
+	return map[string]interface{}{
+		"global":   rules.Global,
+		"identify": rules.Identify,
+		"group":    rules.Group,
+		"events":   events,
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printPlan renders the pending changes followed by a summary line.
+func (p printer) printPlan(changes []change) {
+	if len(changes) == 0 {
+		fmt.Fprintln(p.w, "No changes. The workspace matches the configuration.")
+		return
+	}
+
+	var created, updated int
+	for _, ch := range changes {
+		switch ch.action {
+		case actionCreate:
+			created++
+			fmt.Fprintln(p.w, p.colorize(colorGreen, fmt.Sprintf("  + create %s %s", ch.kind, ch.address)))
+		case actionUpdate:
+			updated++
+			fmt.Fprintln(p.w, p.colorize(colorYellow, fmt.Sprintf("  ~ update %s %s", ch.kind, ch.address)))
+		}
+		p.printDiffs(ch.diffs)
+	}
+	fmt.Fprintf(p.w, "\nPlan: %d to create, %d to update.\n", created, updated)
+}
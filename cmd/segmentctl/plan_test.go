@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ajbosco/segment-config-go/segment"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI is an in-memory workspace recording the mutating calls it receives.
+type fakeAPI struct {
+	sources      []segment.Source
+	sourceConfig map[string]segment.SourceConfig
+	destinations map[string][]segment.Destination
+	filters      map[string][]segment.DestinationFilter
+	plans        []segment.TrackingPlan
+	connections  map[string][]segment.TrackingPlanSourceConnection
+	calls        []string
+}
+
+func (f *fakeAPI) record(format string, args ...interface{}) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeAPI) ListSources() (segment.Sources, error) {
+	return segment.Sources{Sources: f.sources}, nil
+}
+
+func (f *fakeAPI) CreateSource(srcName string, catName string) (segment.Source, error) {
+	f.record("CreateSource %s %s", srcName, catName)
+	return segment.Source{Name: "workspaces/myworkspace/sources/" + srcName}, nil
+}
+
+func (f *fakeAPI) GetSourceConfig(srcName string) (segment.SourceConfig, error) {
+	return f.sourceConfig[srcName], nil
+}
+
+func (f *fakeAPI) PatchSourceConfig(srcName string, config segment.SourceConfig, fields ...segment.SourceConfigField) (segment.SourceConfig, error) {
+	f.record("PatchSourceConfig %s %v", srcName, fields)
+	return config, nil
+}
+
+func (f *fakeAPI) ListDestinations(srcName string) (segment.Destinations, error) {
+	return segment.Destinations{Destinations: f.destinations[srcName]}, nil
+}
+
+func (f *fakeAPI) CreateDestination(srcName string, destName string, connMode string, enabled bool, configs []segment.DestinationConfig) (segment.Destination, error) {
+	f.record("CreateDestination %s %s %s %v %d", srcName, destName, connMode, enabled, len(configs))
+	return segment.Destination{}, nil
+}
+
+func (f *fakeAPI) UpdateDestinationFields(srcName string, destName string, dest segment.Destination, fields ...segment.DestinationField) (segment.Destination, error) {
+	var values []string
+	for _, field := range fields {
+		switch field {
+		case segment.DestinationFieldEnabled:
+			values = append(values, fmt.Sprintf("enabled=%v", dest.Enabled))
+		case segment.DestinationFieldConfig:
+			for _, cfg := range dest.Configs {
+				values = append(values, fmt.Sprintf("%s=%v", shortName(cfg.Name), cfg.Value))
+			}
+		}
+	}
+	f.record("UpdateDestinationFields %s %s %v", srcName, destName, values)
+	return segment.Destination{}, nil
+}
+
+func (f *fakeAPI) ListDestinationFilters(srcName string, destinationName string) ([]segment.DestinationFilter, error) {
+	return f.filters[srcName+"/"+destinationName], nil
+}
+
+func (f *fakeAPI) CreateDestinationFilter(srcName string, destinationName string, filter segment.DestinationFilter) (*segment.DestinationFilter, error) {
+	f.record("CreateDestinationFilter %s %s %s", srcName, destinationName, filter.Title)
+	return &filter, nil
+}
+
+func (f *fakeAPI) UpdateDestinationFilterFields(srcName string, destinationName string, filter segment.DestinationFilter, fields ...segment.DestinationFilterField) (*segment.DestinationFilter, error) {
+	f.record("UpdateDestinationFilterFields %s %s %s %v", srcName, destinationName, filter.Name, fields)
+	return &filter, nil
+}
+
+func (f *fakeAPI) ListTrackingPlans() (segment.TrackingPlans, error) {
+	return segment.TrackingPlans{TrackingPlans: f.plans}, nil
+}
+
+func (f *fakeAPI) GetTrackingPlan(trackingPlanID string) (segment.TrackingPlan, error) {
+	for _, tp := range f.plans {
+		if shortName(tp.Name) == trackingPlanID {
+			return tp, nil
+		}
+	}
+	return segment.TrackingPlan{}, fmt.Errorf("tracking plan %s not found", trackingPlanID)
+}
+
+func (f *fakeAPI) CreateTrackingPlan(data segment.TrackingPlan) (segment.TrackingPlan, error) {
+	f.record("CreateTrackingPlan %s", data.DisplayName)
+	data.Name = "workspaces/myworkspace/tracking-plans/rs_new"
+	return data, nil
+}
+
+func (f *fakeAPI) UpdateTrackingPlan(trackingPlanID string, data segment.TrackingPlan) (segment.TrackingPlan, error) {
+	f.record("UpdateTrackingPlan %s %s", trackingPlanID, data.DisplayName)
+	return data, nil
+}
+
+func (f *fakeAPI) ListTrackingPlanSources(planId string) ([]segment.TrackingPlanSourceConnection, error) {
+	return f.connections[planId], nil
+}
+
+func (f *fakeAPI) CreateTrackingPlanSourceConnection(planId string, sourceName string) error {
+	f.record("CreateTrackingPlanSourceConnection %s %s", planId, sourceName)
+	return nil
+}
+
+func (f *fakeAPI) DeleteTrackingPlanSourceConnection(planId string, sourceName string) error {
+	f.record("DeleteTrackingPlanSourceConnection %s %s", planId, sourceName)
+	return nil
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{
+		sources: []segment.Source{{Name: "workspaces/myworkspace/sources/js"}},
+		sourceConfig: map[string]segment.SourceConfig{
+			"js": {AllowUnplannedTrackEvents: true, CommonTrackEventOnViolations: segment.Allow},
+		},
+		destinations: map[string][]segment.Destination{
+			"js": {{
+				Name:           "workspaces/myworkspace/sources/js/destinations/google-analytics",
+				Enabled:        true,
+				ConnectionMode: "CLOUD",
+				Configs: []segment.DestinationConfig{
+					{Name: "workspaces/myworkspace/sources/js/destinations/google-analytics/config/trackingId", Type: "string", Value: "UA-1"},
+					{Name: "workspaces/myworkspace/sources/js/destinations/google-analytics/config/anonymizeIp", Type: "boolean", Value: false},
+				},
+			}},
+		},
+		filters: map[string][]segment.DestinationFilter{
+			"js/google-analytics": {{
+				Name:       "workspaces/myworkspace/sources/js/destinations/google-analytics/filters/df_1",
+				Title:      "Drop identify",
+				Conditions: `type = "identify"`,
+				Actions:    segment.DestinationFilterActions{segment.NewDropEventAction()},
+				IsEnabled:  true,
+			}},
+		},
+		plans: []segment.TrackingPlan{{
+			Name:        "workspaces/myworkspace/tracking-plans/rs_1",
+			DisplayName: "Web",
+			Rules: segment.RuleSet{Events: []segment.Event{
+				{Name: "Order Completed", Description: "An order was completed"},
+			}},
+		}},
+		connections: map[string][]segment.TrackingPlanSourceConnection{
+			"rs_1": {{Source: "workspaces/myworkspace/sources/ios", TrackingPlanId: "rs_1"}},
+		},
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// matchingConfig describes exactly the live state of newFakeAPI.
+func matchingConfig() config {
+	return config{
+		Sources: []sourceSpec{{
+			Name: "js",
+			SchemaConfig: &sourceConfigSpec{
+				SourceConfig: segment.SourceConfig{AllowUnplannedTrackEvents: true, CommonTrackEventOnViolations: segment.Allow},
+				fields: []segment.SourceConfigField{
+					segment.SourceConfigAllowUnplannedTrackEvents,
+					segment.SourceConfigCommonTrackEventOnViolations,
+				},
+			},
+			Destinations: []destinationSpec{{
+				Name:    "google-analytics",
+				Enabled: boolPtr(true),
+				Config:  map[string]interface{}{"trackingId": "UA-1"},
+				Filters: []filterSpec{{
+					DestinationFilter: segment.DestinationFilter{
+						Title:      "Drop identify",
+						Conditions: `type = "identify"`,
+						Actions:    segment.DestinationFilterActions{segment.NewDropEventAction()},
+						IsEnabled:  true,
+					},
+					fields: []segment.DestinationFilterField{
+						segment.DestinationFilterFieldConditions,
+						segment.DestinationFilterFieldActions,
+						segment.DestinationFilterFieldTitle,
+						segment.DestinationFilterFieldEnabled,
+					},
+				}},
+			}},
+		}},
+		TrackingPlans: []trackingPlanSpec{{
+			DisplayName: "Web",
+			Rules: segment.RuleSet{Events: []segment.Event{
+				{Name: "Order Completed", Description: "An order was completed"},
+			}},
+			Sources: []string{"ios"},
+		}},
+	}
+}
+
+func TestPlan_NoChanges(t *testing.T) {
+	changes, err := computePlan(newFakeAPI(), "myworkspace", matchingConfig())
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	var buf bytes.Buffer
+	printer{w: &buf}.printPlan(changes)
+	assert.Equal(t, "No changes. The workspace matches the configuration.\n", buf.String())
+}
+
+func TestPlan_Updates(t *testing.T) {
+	api := newFakeAPI()
+	cfg := matchingConfig()
+	cfg.Sources[0].SchemaConfig.AllowUnplannedTrackEvents = false
+	cfg.Sources[0].Destinations[0].Enabled = boolPtr(false)
+	cfg.Sources[0].Destinations[0].Config["anonymizeIp"] = true
+	cfg.Sources[0].Destinations[0].Filters[0].IsEnabled = false
+	cfg.TrackingPlans[0].Rules.Events[0].Description = "Checkout finished"
+	cfg.TrackingPlans[0].Sources = []string{"js"}
+
+	changes, err := computePlan(api, "myworkspace", cfg)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	printer{w: &buf}.printPlan(changes)
+	assert.Equal(t, `  ~ update schema config js
+      ~ allow_unplanned_track_events: true => false
+  ~ update destination js/google-analytics
+      ~ enabled: true => false
+      ~ config.anonymizeIp: false => true
+  ~ update filter js/google-analytics/"Drop identify"
+      ~ enabled: true => false
+  ~ update tracking plan "Web" (rs_1)
+      ~ rules.events.Order Completed.description: "An order was completed" => "Checkout finished"
+  ~ update tracking plan sources "Web" (rs_1)
+      + sources: "js"
+      - sources: "ios"
+
+Plan: 0 to create, 5 to update.
+`, buf.String())
+
+	for _, ch := range changes {
+		assert.NoError(t, ch.apply())
+	}
+	assert.Equal(t, []string{
+		"PatchSourceConfig js [allow_unplanned_track_events]",
+		"UpdateDestinationFields js google-analytics [enabled=false trackingId=UA-1 anonymizeIp=true]",
+		"UpdateDestinationFilterFields js google-analytics workspaces/myworkspace/sources/js/destinations/google-analytics/filters/df_1 [enabled]",
+		"UpdateTrackingPlan rs_1 Web",
+		"CreateTrackingPlanSourceConnection rs_1 js",
+		"DeleteTrackingPlanSourceConnection rs_1 ios",
+	}, api.calls)
+}
+
+func TestPlan_EnabledOmitted(t *testing.T) {
+	api := newFakeAPI()
+	cfg := matchingConfig()
+	cfg.Sources[0].Destinations[0].Enabled = nil
+	cfg.Sources[0].Destinations[0].Filters = nil
+	cfg.TrackingPlans = nil
+
+	changes, err := computePlan(api, "myworkspace", cfg)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	cfg.Sources[0].Destinations[0].Config["anonymizeIp"] = true
+	changes, err = computePlan(api, "myworkspace", cfg)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, []fieldDiff{{path: "config.anonymizeIp", old: false, new: true}}, changes[0].diffs)
+	assert.NoError(t, changes[0].apply())
+	assert.Equal(t, []string{"UpdateDestinationFields js google-analytics [trackingId=UA-1 anonymizeIp=true]"}, api.calls)
+}
+
+func TestPlan_UnlistedFieldsLeftAlone(t *testing.T) {
+	api := newFakeAPI()
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "js.yaml", `
+sources:
+  - name: js
+    schema_config:
+      allow_unplanned_track_events: false
+    destinations:
+      - name: google-analytics
+        filters:
+          - title: Drop identify
+            enabled: false
+`)
+	cfg, err := loadConfig(dir)
+	assert.NoError(t, err)
+
+	changes, err := computePlan(api, "myworkspace", cfg)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, []fieldDiff{{path: "allow_unplanned_track_events", old: true, new: false}}, changes[0].diffs)
+	assert.Equal(t, []fieldDiff{{path: "enabled", old: true, new: false}}, changes[1].diffs)
+
+	for _, ch := range changes {
+		assert.NoError(t, ch.apply())
+	}
+	assert.Equal(t, []string{
+		"PatchSourceConfig js [allow_unplanned_track_events]",
+		"UpdateDestinationFilterFields js google-analytics workspaces/myworkspace/sources/js/destinations/google-analytics/filters/df_1 [enabled]",
+	}, api.calls)
+}
+
+func TestPlan_Creates(t *testing.T) {
+	api := newFakeAPI()
+	cfg := config{
+		Sources: []sourceSpec{{
+			Name:        "android",
+			CatalogName: "catalog/sources/android",
+			Destinations: []destinationSpec{{
+				Name:    "amplitude",
+				Enabled: boolPtr(true),
+				Config:  map[string]interface{}{"apiKey": "secret"},
+				Filters: []filterSpec{{DestinationFilter: segment.DestinationFilter{Title: "Sample", Actions: segment.DestinationFilterActions{segment.NewSamplingEventAction(0.5, "userId")}}}},
+			}},
+		}},
+		TrackingPlans: []trackingPlanSpec{{DisplayName: "Mobile", Sources: []string{"android"}}},
+	}
+
+	changes, err := computePlan(api, "myworkspace", cfg)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 4)
+	for _, ch := range changes {
+		assert.Equal(t, actionCreate, ch.action)
+		assert.NoError(t, ch.apply())
+	}
+	assert.Equal(t, []string{
+		"CreateSource android catalog/sources/android",
+		"CreateDestination android amplitude CLOUD true 1",
+		"CreateDestinationFilter android amplitude Sample",
+		"CreateTrackingPlan Mobile",
+		"CreateTrackingPlanSourceConnection rs_new android",
+	}, api.calls)
+}
+
+func TestPlan_SourceWithoutCatalog(t *testing.T) {
+	_, err := computePlan(newFakeAPI(), "myworkspace", config{Sources: []sourceSpec{{Name: "android"}}})
+	assert.EqualError(t, err, "source android does not exist and has no catalog_name to create it from")
+}
+
+func TestPlan_ConnectionModeChange(t *testing.T) {
+	cfg := matchingConfig()
+	cfg.Sources[0].Destinations[0].ConnectionMode = "DEVICE"
+
+	_, err := computePlan(newFakeAPI(), "myworkspace", cfg)
+	assert.EqualError(t, err, "destination js/google-analytics: connection_mode cannot be changed from CLOUD to DEVICE in place")
+}
+
+func TestPrinter_Colors(t *testing.T) {
+	var buf bytes.Buffer
+	printer{w: &buf, color: true}.printDiffs([]fieldDiff{{path: "enabled", old: true, new: false}})
+	assert.Equal(t, colorYellow+"      ~ enabled: true => false"+colorReset+"\n", buf.String())
+}
+
+func TestDiffValues(t *testing.T) {
+	old := map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": "x"}, "list": []string{"1", "2"}}
+	new := map[string]interface{}{"b": map[string]interface{}{"c": "y", "d": true}, "list": []string{"1", "3"}}
+
+	assert.Equal(t, []fieldDiff{
+		{path: "a", old: float64(1)},
+		{path: "b.c", old: "x", new: "y"},
+		{path: "b.d", new: true},
+		{path: "list[1]", old: "2", new: "3"},
+	}, diffValues("", old, new))
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ajbosco/segment-config-go/segment"
+)
+
+func sourcesResource() resource {
+	return resource{
+		name:    "sources",
+		aliases: []string{"source"},
+		summary: "Manage sources",
+		commands: []command{
+			{name: "list", summary: "List all sources in the workspace", run: listSources},
+			{name: "get", args: "<source>", summary: "Show a source", run: getSource},
+			{name: "create", args: "<source>", summary: "Create a source from a catalog entry", run: createSource},
+			{name: "delete", args: "<source>", summary: "Delete a source", run: deleteSource},
+			{name: "tracking-plan", args: "<source>", summary: "Show the tracking plan a source is connected to", run: getSourceTrackingPlan},
+			{name: "tracking-plans", summary: "List the tracking plan of every source, including sources without one", run: listSourceTrackingPlans},
+		},
+	}
+}
+
+func sourceConfigResource() resource {
+	return resource{
+		name:    "source-config",
+		aliases: []string{"schema-config"},
+		summary: "Manage the Protocols schema config of a source",
+		commands: []command{
+			{name: "get", args: "<source>", summary: "Show the schema config of a source", run: getSourceConfig},
+			{name: "update", args: "<source>", summary: "Replace the schema config of a source with the one in -f or a -preset", run: updateSourceConfig},
+		},
+	}
+}
+
+func listSources(a *app, fs *flag.FlagSet, args []string) error {
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	s, err := c.ListSources()
+	if err != nil {
+		return err
+	}
+	return a.print(s.Sources, sourcesTable(s.Sources...))
+}
+
+func getSource(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	s, err := c.GetSource(args[0])
+	if err != nil {
+		return err
+	}
+	return a.print(s, sourcesTable(s))
+}
+
+func getSourceTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tp, err := c.GetSourceTrackingPlan(args[0])
+	if err != nil {
+		return err
+	}
+	return a.print(tp, trackingPlansTable(tp))
+}
+
+func listSourceTrackingPlans(a *app, fs *flag.FlagSet, args []string) error {
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	plans, err := c.GetSourceTrackingPlans()
+	if err != nil {
+		return err
+	}
+	t := table{headers: []string{"SOURCE", "TRACKING PLAN", "DISPLAY NAME"}}
+	sources := make([]string, 0, len(plans.Plans))
+	for src := range plans.Plans {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	for _, src := range sources {
+		tp := plans.Plans[src]
+		t.add(src, shortName(tp.Name), tp.DisplayName)
+	}
+	for _, src := range plans.Unconnected {
+		t.add(src, "-", "")
+	}
+	return a.print(plans, t)
+}
+
+func createSource(a *app, fs *flag.FlagSet, args []string) error {
+	catalog := fs.String("catalog", "", "catalog name of the source, e.g. catalog/sources/javascript (required)")
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *catalog == "" {
+		return fmt.Errorf("-catalog is required")
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	s, err := c.CreateSource(args[0], *catalog)
+	if err != nil {
+		return err
+	}
+	return a.print(s, sourcesTable(s))
+}
+
+func deleteSource(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeleteSource(args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "source %s deleted\n", args[0])
+	return nil
+}
+
+func sourcesTable(sources ...segment.Source) table {
+	t := table{headers: []string{"NAME", "CATALOG", "WRITE KEYS", "CREATED"}}
+	for _, s := range sources {
+		t.add(shortName(s.Name), s.CatalogName, strings.Join(s.WriteKeys, ","), formatTime(s.CreateTime))
+	}
+	return t
+}
+
+func getSourceConfig(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := c.GetSourceConfig(args[0])
+	if err != nil {
+		return err
+	}
+	return a.print(cfg, sourceConfigTable(cfg))
+}
+
+func updateSourceConfig(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON or YAML file with the schema config, - for stdin")
+	preset := fs.String("preset", "", "use a preset instead of -f: permissive, block-unplanned or strict")
+	fields := fs.String("fields", "", "comma-separated settings to update, e.g. allow_unplanned_track_events; all of them by default")
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if (*file == "") == (*preset == "") {
+		return fmt.Errorf("exactly one of -f and -preset is required")
+	}
+	var cfg segment.SourceConfig
+	if *preset != "" {
+		if cfg, err = segment.NewSourceConfig(segment.SourceConfigPreset(*preset)).Build(); err != nil {
+			return err
+		}
+	} else if err := a.readInput(*file, &cfg); err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	update := segment.SourceConfigFields
+	if *fields != "" {
+		update = nil
+		for _, f := range strings.Split(*fields, ",") {
+			update = append(update, segment.SourceConfigField(strings.TrimSpace(f)))
+		}
+	}
+	cfg, err = c.PatchSourceConfig(args[0], cfg, update...)
+	if err != nil {
+		return err
+	}
+	return a.print(cfg, sourceConfigTable(cfg))
+}
+
+func sourceConfigTable(cfg segment.SourceConfig) table {
+	t := table{headers: []string{"SETTING", "VALUE"}}
+	for _, setting := range sourceConfigSettings(cfg) {
+		t.add(setting.name, fmt.Sprint(setting.value))
+	}
+	return t
+}
+
+type sourceConfigSetting struct {
+	name  string
+	value interface{}
+}
+
+// sourceConfigSettings lists every schema config setting, including the
+// false and empty ones that the JSON encoding of SourceConfig omits.
+func sourceConfigSettings(cfg segment.SourceConfig) []sourceConfigSetting {
+	return []sourceConfigSetting{
+		{"allow_unplanned_track_events", cfg.AllowUnplannedTrackEvents},
+		{"allow_unplanned_identify_traits", cfg.AllowUnplannedIdentifyTraits},
+		{"allow_unplanned_group_traits", cfg.AllowUnplannedGroupTraits},
+		{"allow_unplanned_track_event_properties", cfg.AllowUnplannedTrackEventsProperties},
+		{"allow_track_event_on_violations", cfg.AllowTrackEventOnViolations},
+		{"allow_identify_traits_on_violations", cfg.AllowIdentifyTraitsOnViolations},
+		{"allow_group_traits_on_violations", cfg.AllowGroupTraitsOnViolations},
+		{"allow_track_properties_on_violations", cfg.AllowTrackPropertiesOnViolations},
+		{"forwarding_blocked_events_to", cfg.ForwardingBlockedEventsTo},
+		{"forwarding_violations_to", cfg.ForwardingViolationsTo},
+		{"common_track_event_on_violations", string(cfg.CommonTrackEventOnViolations)},
+		{"common_identify_event_on_violations", string(cfg.CommonIdentifyEventOnViolations)},
+		{"common_group_event_on_violations", string(cfg.CommonGroupEventOnViolations)},
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ajbosco/segment-config-go/segment"
+)
+
+func trackingPlansResource() resource {
+	return resource{
+		name:    "tracking-plans",
+		aliases: []string{"tracking-plan", "tp"},
+		summary: "Manage Protocols tracking plans",
+		commands: []command{
+			{name: "list", summary: "List all tracking plans in the workspace", run: listTrackingPlans},
+			{name: "get", args: "<plan-id>", summary: "Show a tracking plan", run: getTrackingPlan},
+			{name: "create", summary: "Create the tracking plan described in -f", run: createTrackingPlan},
+			{name: "update", args: "<plan-id>", summary: "Replace the display name and rules of a tracking plan with -f", run: updateTrackingPlan},
+			{name: "delete", args: "<plan-id>", summary: "Delete a tracking plan", run: deleteTrackingPlan},
+			{name: "export", args: "<plan-id>", summary: "Write a tracking plan to a directory of files, one per event", run: exportTrackingPlan},
+			{name: "diff", args: "<plan-id>", summary: "Show the changes made to a tracking plan since it was exported to -d", run: diffTrackingPlan},
+			{name: "import", summary: "Create or update a tracking plan from a directory written by export", run: importTrackingPlan},
+			{name: "codegen", args: "<plan-id>", summary: "Generate Go types and track call constructors for the events of a tracking plan", run: codegenTrackingPlan},
+			{name: "docs", args: "<plan-id>", summary: "Generate Markdown or HTML documentation for a tracking plan", run: docsTrackingPlan},
+			{name: "lint", summary: "Check a tracking plan for naming, description and schema problems", run: lintTrackingPlan},
+			{name: "validate", summary: "Check the events in -f against a tracking plan", run: validateEvents},
+			{name: "infer", summary: "Infer a tracking plan from the sample events in -f", run: inferTrackingPlan},
+		},
+	}
+}
+
+func listTrackingPlans(a *app, fs *flag.FlagSet, args []string) error {
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tps, err := c.ListTrackingPlans()
+	if err != nil {
+		return err
+	}
+	return a.print(tps.TrackingPlans, trackingPlansTable(tps.TrackingPlans...))
+}
+
+func getTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tp, err := c.GetTrackingPlan(args[0])
+	if err != nil {
+		return err
+	}
+	return a.print(tp, trackingPlansTable(tp))
+}
+
+func createTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON or YAML file with the tracking plan, - for stdin (required)")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	tp, err := a.readTrackingPlan(*file)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tp, err = c.CreateTrackingPlan(tp)
+	if err != nil {
+		return err
+	}
+	return a.print(tp, trackingPlansTable(tp))
+}
+
+func updateTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON or YAML file with the tracking plan, - for stdin (required)")
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	tp, err := a.readTrackingPlan(*file)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tp, err = c.UpdateTrackingPlan(args[0], tp)
+	if err != nil {
+		return err
+	}
+	return a.print(tp, trackingPlansTable(tp))
+}
+
+func deleteTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeleteTrackingPlan(args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "tracking plan %s deleted\n", args[0])
+	return nil
+}
+
+func exportTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("d", "", "directory to write the tracking plan to (required)")
+	format := fs.String("format", string(segment.TrackingPlanFormatYAML), "file format: yaml or json")
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("-d is required")
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tp, err := c.GetTrackingPlan(args[0])
+	if err != nil {
+		return err
+	}
+	if err := segment.ExportTrackingPlan(tp, *dir, segment.TrackingPlanFormat(*format)); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "tracking plan %s exported to %s (%d events)\n", args[0], *dir, len(tp.Rules.Events))
+	return nil
+}
+
+func importTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("d", "", "directory to read the tracking plan from (required)")
+	create := fs.Bool("create", false, "create a new tracking plan even if the files name an existing one")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("-d is required")
+	}
+	tp, err := segment.ImportTrackingPlan(*dir)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	// The manifest keeps the name of the exported plan, which is updated in
+	// place unless a copy is requested.
+	if tp.Name == "" || *create {
+		tp, err = c.CreateTrackingPlan(segment.TrackingPlan{DisplayName: tp.DisplayName, Rules: tp.Rules})
+	} else {
+		tp, err = c.UpdateTrackingPlan(shortName(tp.Name), tp)
+	}
+	if err != nil {
+		return err
+	}
+	return a.print(tp, trackingPlansTable(tp))
+}
+
+func diffTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("d", "", "directory the tracking plan was exported to (required)")
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("-d is required")
+	}
+	exported, err := segment.ImportTrackingPlan(*dir)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	live, err := c.GetTrackingPlan(args[0])
+	if err != nil {
+		return err
+	}
+	diff := segment.DiffTrackingPlans(exported, live)
+	t := table{headers: []string{"CHANGE"}}
+	for _, change := range diff.Changes {
+		t.add(change.String())
+	}
+	return a.print(diff, t)
+}
+
+func codegenTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	pkg := fs.String("package", "events", "package name of the generated code")
+	out := fs.String("out", "-", "file to write the generated code to, - for stdout")
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tp, err := c.GetTrackingPlan(args[0])
+	if err != nil {
+		return err
+	}
+	src, err := segment.GenerateGo(tp, segment.GoCodegenOptions{Package: *pkg})
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = a.stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*out, src, 0644)
+}
+
+func docsTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	out := fs.String("out", "", "directory to write the documentation to (required)")
+	format := fs.String("format", string(segment.DocsFormatMarkdown), "documentation format: markdown or html")
+	previous := fs.String("previous", "", "directory of an older export of the tracking plan to include a changelog since")
+	args, err := a.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return fmt.Errorf("-out is required")
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tp, err := c.GetTrackingPlan(args[0])
+	if err != nil {
+		return err
+	}
+	sources, err := c.ListTrackingPlanSources(args[0])
+	if err != nil {
+		return err
+	}
+	opts := segment.DocsOptions{Format: segment.DocsFormat(*format), Sources: sources}
+	if *previous != "" {
+		old, err := segment.ImportTrackingPlan(*previous)
+		if err != nil {
+			return err
+		}
+		opts.Previous = &old
+	}
+	if err := segment.WriteTrackingPlanDocs(tp, *out, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "documentation of tracking plan %s written to %s (%d events)\n", args[0], *out, len(tp.Rules.Events))
+	return nil
+}
+
+// Exit statuses of validate and lint when they find problems.
+const (
+	exitViolations = 2
+	exitLintErrors = 2
+)
+
+// eventViolations are the violations of the event at Index in the input.
+type eventViolations struct {
+	Index      int                 `json:"index"`
+	Event      string              `json:"event"`
+	Violations []segment.Violation `json:"violations"`
+}
+
+func validateEvents(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON file with one or more events or arrays of events, - for stdin (required)")
+	planID := fs.String("plan", "", "ID of the tracking plan to validate against")
+	dir := fs.String("d", "", "directory of an exported tracking plan to validate against instead of -plan")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+	tp, err := a.loadTrackingPlan(*planID, *dir)
+	if err != nil {
+		return err
+	}
+
+	events, err := a.readEvents(*file)
+	if err != nil {
+		return err
+	}
+	results := []eventViolations{}
+	t := table{headers: []string{"INDEX", "EVENT", "FIELD", "VIOLATION", "DESCRIPTION"}}
+	for i, event := range events {
+		violations, err := segment.ValidateEvent(tp, event)
+		if err != nil {
+			return fmt.Errorf("event %d: %v", i, err)
+		}
+		if len(violations) == 0 {
+			continue
+		}
+		name := eventName(event)
+		results = append(results, eventViolations{Index: i, Event: name, Violations: violations})
+		for _, v := range violations {
+			t.add(fmt.Sprint(i), name, v.Field, string(v.Type), v.Description)
+		}
+	}
+	if err := a.print(results, t); err != nil {
+		return err
+	}
+	if len(results) > 0 {
+		return exitCode(exitViolations)
+	}
+	return nil
+}
+
+func inferTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "JSON file with one or more events or arrays of events, - for stdin (required)")
+	name := fs.String("name", "Inferred Tracking Plan", "display name of the tracking plan")
+	dir := fs.String("d", "", "directory to write the tracking plan to, as export does, instead of printing it")
+	format := fs.String("format", string(segment.TrackingPlanFormatYAML), "file format with -d: yaml or json")
+	maxEnum := fs.Int("max-enum", segment.DefaultMaxEnumValues, "maximum number of distinct values of an enum, -1 for no enums")
+	required := fs.Float64("required-ratio", 1, "share of the events that must have a property for it to be required")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+
+	events, err := a.readEvents(*file)
+	if err != nil {
+		return err
+	}
+	inf := segment.NewTrackingPlanInferrer(segment.InferOptions{MaxEnumValues: *maxEnum, RequiredRatio: *required})
+	for i, event := range events {
+		if err := inf.AddEvent(event); err != nil {
+			return fmt.Errorf("event %d: %v", i, err)
+		}
+	}
+	tp := inf.TrackingPlan(*name)
+
+	if *dir == "" {
+		return a.print(tp, trackingPlansTable(tp))
+	}
+	if err := segment.ExportTrackingPlan(tp, *dir, segment.TrackingPlanFormat(*format)); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "tracking plan inferred from %d events written to %s (%d events)\n", len(events), *dir, len(tp.Rules.Events))
+	return nil
+}
+
+func lintTrackingPlan(a *app, fs *flag.FlagSet, args []string) error {
+	planID := fs.String("plan", "", "ID of the tracking plan to lint")
+	dir := fs.String("d", "", "directory of an exported tracking plan to lint instead of -plan")
+	propertyCase := fs.String("property-case", string(segment.SnakeCase), "expected case of property names: snake_case or camelCase")
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	convention := segment.PropertyNamingConvention(*propertyCase)
+	if convention != segment.SnakeCase && convention != segment.CamelCase {
+		return fmt.Errorf("unknown property case %q", *propertyCase)
+	}
+	tp, err := a.loadTrackingPlan(*planID, *dir)
+	if err != nil {
+		return err
+	}
+
+	rules := segment.DefaultLintRules()
+	for i, rule := range rules {
+		if rule.Name == segment.LintRulePropertyNaming {
+			rules[i] = segment.PropertyNamingRule(convention)
+		}
+	}
+	findings := segment.LintTrackingPlan(tp, rules...)
+	t := table{headers: []string{"SEVERITY", "RULE", "EVENT", "PATH", "MESSAGE"}}
+	for _, f := range findings {
+		event := f.Event
+		if f.Section != segment.SectionEvent {
+			event = "(" + f.Section + ")"
+		}
+		t.add(string(f.Severity), f.Rule, event, f.Path, f.Message)
+	}
+	if findings == nil {
+		findings = []segment.LintFinding{}
+	}
+	if err := a.print(findings, t); err != nil {
+		return err
+	}
+	if segment.HasLintErrors(findings) {
+		return exitCode(exitLintErrors)
+	}
+	return nil
+}
+
+// loadTrackingPlan fetches the tracking plan planID, or reads the one
+// exported to dir. Exactly one of them must be set.
+func (a *app) loadTrackingPlan(planID, dir string) (segment.TrackingPlan, error) {
+	if (planID == "") == (dir == "") {
+		return segment.TrackingPlan{}, fmt.Errorf("exactly one of -plan and -d is required")
+	}
+	if dir != "" {
+		return segment.ImportTrackingPlan(dir)
+	}
+	c, err := a.client()
+	if err != nil {
+		return segment.TrackingPlan{}, err
+	}
+	return c.GetTrackingPlan(planID)
+}
+
+// eventName describes an event in the validate output, e.g. "Order Completed"
+// for track calls or "identify".
+func eventName(event map[string]interface{}) string {
+	if name, ok := event["event"].(string); ok && name != "" {
+		return name
+	}
+	callType, _ := event["type"].(string)
+	return callType
+}
+
+func (a *app) readTrackingPlan(file string) (segment.TrackingPlan, error) {
+	var tp segment.TrackingPlan
+	if file == "" {
+		return tp, fmt.Errorf("-f is required")
+	}
+	err := a.readInput(file, &tp)
+	return tp, err
+}
+
+func trackingPlansTable(tps ...segment.TrackingPlan) table {
+	t := table{headers: []string{"ID", "DISPLAY NAME", "EVENTS", "UPDATED"}}
+	for _, tp := range tps {
+		t.add(shortName(tp.Name), tp.DisplayName, fmt.Sprint(len(tp.Rules.Events)), formatTime(tp.UpdateTime))
+	}
+	return t
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/ajbosco/segment-config-go/segment"
+)
+
+func workspaceResource() resource {
+	return resource{
+		name:    "workspace",
+		aliases: []string{"workspaces"},
+		summary: "Inspect the configured workspace",
+		commands: []command{
+			{name: "get", summary: "Show the workspace", run: getWorkspace},
+		},
+	}
+}
+
+func getWorkspace(a *app, fs *flag.FlagSet, args []string) error {
+	if _, err := a.parse(fs, args, 0); err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	w, err := c.GetWorkspace()
+	if err != nil {
+		return err
+	}
+	return a.print(w, workspaceTable(w))
+}
+
+func workspaceTable(w segment.Workspace) table {
+	t := table{headers: []string{"NAME", "DISPLAY NAME", "ID", "CREATED"}}
+	t.add(shortName(w.Name), w.DisplayName, w.ID, formatTime(w.CreateTime))
+	return t
+}
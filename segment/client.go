@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -16,6 +17,10 @@ const (
 	apiVersion     = "v1beta"
 	defaultBaseURL = "https://platform.segmentapis.com"
 	mediaType      = "application/json"
+
+	// maxConcurrentRequests bounds the requests made at once by the methods
+	// that fan out over several resources
+	maxConcurrentRequests = 8
 )
 
 // Client manages communication with Segment Config API.
@@ -108,3 +113,27 @@ func handleErrorRequest(body io.ReadCloser) error {
 
 	return &segmentErr
 }
+
+// forEachConcurrently calls fn with 0 to n-1, running at most limit calls at
+// once. It returns the error of the lowest index that failed.
+func forEachConcurrently(n, limit int, fn func(i int) error) error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
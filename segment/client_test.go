@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -128,3 +130,33 @@ func Test_doRequest_httpError_toomanyrequests(t *testing.T) {
 	_, err := client.doRequest(http.MethodGet, "/", nil)
 	assert.EqualError(t, err, expected.Error())
 }
+
+func Test_forEachConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	done := make([]bool, 20)
+	err := forEachConcurrently(len(done), 3, func(i int) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+		done[i] = true
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if i == 7 || i == 12 {
+			return fmt.Errorf("call %d failed", i)
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "call 7 failed")
+	assert.True(t, maxRunning <= 3)
+	for _, d := range done {
+		assert.True(t, d)
+	}
+}
@@ -0,0 +1,154 @@
+package segment
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConflictError is returned when a resource was modified by someone else
+// between being read and being written back. The operation can be retried.
+// The API has no conditional writes, so the resource is checked just before
+// the write: a modification made between that check and the write is not
+// detected, and is overwritten.
+type ConflictError struct {
+	// Resource is the name of the modified resource
+	Resource string
+	// Expected is the update time the change was based on and Actual the
+	// update time found before writing. Both are zero for resources without
+	// an update time.
+	Expected time.Time
+	Actual   time.Time
+}
+
+func (err *ConflictError) Error() string {
+	if err.Expected.IsZero() && err.Actual.IsZero() {
+		return fmt.Sprintf("%s was modified concurrently", err.Resource)
+	}
+	return fmt.Sprintf("%s was modified concurrently: expected update time %s, found %s",
+		err.Resource, err.Expected.Format(time.RFC3339Nano), err.Actual.Format(time.RFC3339Nano))
+}
+
+// IsConflict reports whether err is, or wraps, a *ConflictError
+func IsConflict(err error) bool {
+	_, ok := errors.Cause(err).(*ConflictError)
+	return ok
+}
+
+// RetryOnConflict calls fn until it returns an error that is not a conflict,
+// at most attempts times. fn should read the resource, apply its change and
+// write it back with one of the IfUnchanged methods, e.g.
+//
+//	err := segment.RetryOnConflict(3, func() error {
+//		d, err := c.GetDestination("js", "google-analytics")
+//		if err != nil {
+//			return err
+//		}
+//		_, err = c.UpdateDestinationIfUnchanged("js", "google-analytics", d, true, d.Configs)
+//		return err
+//	})
+//
+// Retrying narrows the window in which a concurrent edit can be lost, but
+// does not close it, see ConflictError.
+func RetryOnConflict(attempts int, fn func() error) error {
+	var err error
+	for i := 0; i < attempts || i == 0; i++ {
+		if err = fn(); !IsConflict(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// UpdateDestinationIfUnchanged updates a destination like UpdateDestination,
+// but only if it has not changed since last was read. Otherwise a
+// *ConflictError is returned. Only the fields that differ from the current
+// destination are sent, and nothing is sent when none do. The API has no
+// conditional writes, so an edit made between the check and the write can
+// still be lost.
+func (c *Client) UpdateDestinationIfUnchanged(srcName string, destName string, last Destination, enabled bool, configs []DestinationConfig) (Destination, error) {
+	current, err := c.GetDestination(srcName, destName)
+	if err != nil {
+		return current, err
+	}
+	if err := checkUnchanged(current.Name, last.UpdateTime, current.UpdateTime, last, current); err != nil {
+		return current, err
+	}
+	return c.updateChangedDestinationFields(srcName, destName, current, Destination{Enabled: enabled, Configs: configs})
+}
+
+// UpdateDestinationFilterIfUnchanged updates a filter like
+// UpdateDestinationFilter, but only if it has not changed since last was
+// read. Filters have no update time, so the whole filter is compared. Only
+// the fields that differ from the current filter are sent. The API has no
+// conditional writes, so an edit made between the check and the write can
+// still be lost.
+func (c *Client) UpdateDestinationFilterIfUnchanged(srcName string, destinationName string, last DestinationFilter, filter DestinationFilter) (*DestinationFilter, error) {
+	if filter.Name == "" {
+		return nil, errFilterName
+	}
+	current, err := c.GetDestinationFilter(srcName, destinationName, path.Base(filter.Name))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUnchanged(current.Name, time.Time{}, time.Time{}, last, *current); err != nil {
+		return current, err
+	}
+	return c.updateChangedDestinationFilterFields(srcName, destinationName, current, filter)
+}
+
+// UpdateSourceConfigIfUnchanged updates a schema config like
+// UpdateSourceConfig, but only if it has not changed since last was read.
+// Schema configs have no update time, so the whole config is compared. Only
+// the settings that differ from the current config are sent. The API has no
+// conditional writes, so an edit made between the check and the write can
+// still be lost.
+func (c *Client) UpdateSourceConfigIfUnchanged(srcName string, last SourceConfig, config SourceConfig) (SourceConfig, error) {
+	current, err := c.GetSourceConfig(srcName)
+	if err != nil {
+		return current, err
+	}
+	if err := checkUnchanged(current.Name, time.Time{}, time.Time{}, last, current); err != nil {
+		return current, err
+	}
+	return c.patchChangedSourceConfigFields(srcName, current, config)
+}
+
+// UpdateTrackingPlanIfUnchanged updates a tracking plan like
+// UpdateTrackingPlan, but only if it has not changed since last was read.
+// Only the fields that differ from the current plan are sent. The API has no
+// conditional writes, so an edit made between the check and the write can
+// still be lost.
+func (c *Client) UpdateTrackingPlanIfUnchanged(trackingPlanID string, last TrackingPlan, data TrackingPlan) (TrackingPlan, error) {
+	current, err := c.checkTrackingPlanUnchanged(trackingPlanID, last)
+	if err != nil {
+		return current, err
+	}
+	return c.updateChangedTrackingPlanFields(trackingPlanID, current, data)
+}
+
+func (c *Client) checkTrackingPlanUnchanged(trackingPlanID string, last TrackingPlan) (TrackingPlan, error) {
+	current, err := c.GetTrackingPlan(trackingPlanID)
+	if err != nil {
+		return current, err
+	}
+	return current, checkUnchanged(current.Name, last.UpdateTime, current.UpdateTime, last, current)
+}
+
+// checkUnchanged compares the update times of a resource when it has one,
+// and the whole resource otherwise.
+func checkUnchanged(name string, lastUpdate, currentUpdate time.Time, last, current interface{}) error {
+	if !lastUpdate.IsZero() || !currentUpdate.IsZero() {
+		if lastUpdate.Equal(currentUpdate) {
+			return nil
+		}
+		return &ConflictError{Resource: name, Expected: lastUpdate, Actual: currentUpdate}
+	}
+	if reflect.DeepEqual(last, current) {
+		return nil
+	}
+	return &ConflictError{Resource: name}
+}
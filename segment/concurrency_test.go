@@ -0,0 +1,145 @@
+package segment
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrency_RetryOnConflict(t *testing.T) {
+	calls := 0
+	err := RetryOnConflict(3, func() error {
+		calls++
+		if calls < 3 {
+			return errors.Wrap(&ConflictError{Resource: "x"}, "update failed")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = RetryOnConflict(2, func() error {
+		calls++
+		return &ConflictError{Resource: "x"}
+	})
+	assert.True(t, IsConflict(err))
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	err = RetryOnConflict(0, func() error {
+		calls++
+		return errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, 1, calls)
+}
+
+func TestConcurrency_UpdateDestinationIfUnchanged(t *testing.T) {
+	setup()
+	defer teardown()
+
+	updates := 0
+	endpoint := fmt.Sprintf("/%s/%s/%s/%s/js/%s/google-analytics",
+		apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint)
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			updates++
+		}
+		fmt.Fprint(w, `{
+			"name": "workspaces/myworkspace/sources/js/destinations/google-analytics",
+			"enabled": true,
+			"update_time": "2020-01-02T03:04:05Z"
+		}`)
+	})
+
+	last := Destination{UpdateTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	_, err := client.UpdateDestinationIfUnchanged("js", "google-analytics", last, false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+
+	last.UpdateTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err = client.UpdateDestinationIfUnchanged("js", "google-analytics", last, false, nil)
+	assert.EqualError(t, err, "workspaces/myworkspace/sources/js/destinations/google-analytics was modified concurrently: expected update time 2020-01-01T00:00:00Z, found 2020-01-02T03:04:05Z")
+	assert.Equal(t, 1, updates)
+}
+
+func TestConcurrency_UpdateSourceConfigIfUnchanged(t *testing.T) {
+	setup()
+	defer teardown()
+
+	updates := 0
+	endpoint := fmt.Sprintf("/%s/%s/%s/%s/js/schema-config", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint)
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			updates++
+		}
+		fmt.Fprint(w, `{"name": "workspaces/myworkspace/sources/js/schema-config", "allow_unplanned_track_events": true}`)
+	})
+
+	last := SourceConfig{Name: "workspaces/myworkspace/sources/js/schema-config", AllowUnplannedTrackEvents: true}
+	_, err := client.UpdateSourceConfigIfUnchanged("js", last, SourceConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+
+	last.AllowUnplannedTrackEvents = false
+	_, err = client.UpdateSourceConfigIfUnchanged("js", last, SourceConfig{})
+	assert.EqualError(t, err, "workspaces/myworkspace/sources/js/schema-config was modified concurrently")
+	assert.Equal(t, 1, updates)
+}
+
+func TestConcurrency_UpdateDestinationFilterIfUnchanged(t *testing.T) {
+	setup()
+	defer teardown()
+
+	updates := 0
+	filterName := fmt.Sprintf("%s/%s/%s/js/%s/google-analytics/%s/df_123",
+		WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint, DestinationFiltersEndpoint)
+	endpoint := fmt.Sprintf("/%s/%s", apiVersion, filterName)
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			updates++
+		}
+		fmt.Fprintf(w, `{"name": %q, "title": "Drop", "if": "all", "actions": [], "enabled": true}`, filterName)
+	})
+
+	last, err := client.GetDestinationFilter("js", "google-analytics", "df_123")
+	assert.NoError(t, err)
+	update := *last
+	update.IsEnabled = false
+	_, err = client.UpdateDestinationFilterIfUnchanged("js", "google-analytics", *last, update)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+
+	last.Title = "Sample"
+	_, err = client.UpdateDestinationFilterIfUnchanged("js", "google-analytics", *last, update)
+	assert.True(t, IsConflict(err))
+	assert.Equal(t, 1, updates)
+
+	update.Name = ""
+	_, err = client.UpdateDestinationFilterIfUnchanged("js", "google-analytics", *last, update)
+	assert.EqualError(t, err, "the name of the filter to update is required")
+	_, err = client.UpdateDestinationFilter("js", "google-analytics", update)
+	assert.EqualError(t, err, "the name of the filter to update is required")
+	assert.Equal(t, 1, updates)
+}
+
+func TestConcurrency_UpdateTrackingPlanIfUnchanged(t *testing.T) {
+	setup()
+	defer teardown()
+	update := handleEventsPlan(t, 0)
+
+	last := TrackingPlan{UpdateTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	_, err := client.UpdateTrackingPlanIfUnchanged(testTrackingPlanID, last, TrackingPlan{DisplayName: "Renamed"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", update.TrackingPlan.DisplayName)
+
+	update.TrackingPlan.DisplayName = ""
+	_, err = client.UpdateTrackingPlanIfUnchanged(testTrackingPlanID, TrackingPlan{}, TrackingPlan{DisplayName: "Renamed"})
+	assert.True(t, IsConflict(err))
+	assert.Empty(t, update.TrackingPlan.DisplayName)
+}
@@ -0,0 +1,128 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DestinationConfigChange is a setting changed by PatchDestinationConfig. Old
+// is nil for settings the destination did not have.
+type DestinationConfigChange struct {
+	// Name is the short name of the setting, e.g. "apiKey"
+	Name string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c DestinationConfigChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Name, settingString(c.Old), settingString(c.New))
+}
+
+func settingString(v interface{}) string {
+	if v == nil {
+		return "(unset)"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// PatchDestinationConfig changes some settings of a destination, leaving the
+// others as they are. Settings are keyed by their short name, e.g. "apiKey",
+// or their full name. Map settings are merged key by key, recursively, and a
+// nil value in them removes the key; other values replace the setting. The
+// destination is read first, and the update is skipped when nothing changes.
+// The changes are returned in name order.
+func (c *Client) PatchDestinationConfig(srcName string, destName string, settings map[string]interface{}) (Destination, []DestinationConfigChange, error) {
+	d, err := c.GetDestination(srcName, destName)
+	if err != nil {
+		return d, nil, err
+	}
+
+	configs := make([]DestinationConfig, len(d.Configs))
+	copy(configs, d.Configs)
+	index := map[string]int{}
+	for i, cfg := range configs {
+		index[path.Base(cfg.Name)] = i
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []DestinationConfigChange
+	for _, name := range names {
+		short := path.Base(name)
+		i, ok := index[short]
+		var old interface{}
+		if ok {
+			old = configs[i].Value
+		}
+		value := mergeSetting(old, settings[name])
+		equal, err := jsonEqual(old, value)
+		if err != nil {
+			return d, nil, errors.Wrapf(err, "comparing setting %s failed", short)
+		}
+		if equal && (ok || value == nil) {
+			continue
+		}
+
+		changes = append(changes, DestinationConfigChange{Name: short, Old: old, New: value})
+		if ok {
+			configs[i].Value = value
+			continue
+		}
+		fullName := name
+		if !strings.Contains(name, "/") {
+			fullName = fmt.Sprintf("%s/%s/%s/%s/%s/%s/config/%s",
+				WorkspacesEndpoint, c.workspace, SourceEndpoint, srcName, DestinationEndpoint, destName, name)
+		}
+		index[short] = len(configs)
+		configs = append(configs, DestinationConfig{Name: fullName, Value: value})
+	}
+	if len(changes) == 0 {
+		return d, nil, nil
+	}
+
+	d, err = c.UpdateDestinationFields(srcName, destName, Destination{Configs: configs}, DestinationFieldConfig)
+	if err != nil {
+		return d, nil, err
+	}
+	return d, changes, nil
+}
+
+// mergeSetting merges patch into the value of a setting: maps are merged
+// recursively, with nil values removing keys, and anything else replaces the
+// old value. old is not modified.
+func mergeSetting(old, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	oldMap, ok := old.(map[string]interface{})
+	if !ok {
+		oldMap = nil
+	}
+
+	merged := make(map[string]interface{}, len(oldMap)+len(patchMap))
+	for k, v := range oldMap {
+		merged[k] = v
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergeSetting(merged[k], v)
+	}
+	return merged
+}
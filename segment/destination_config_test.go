@@ -0,0 +1,86 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestinationConfig_MergeSetting(t *testing.T) {
+	old := map[string]interface{}{
+		"events":  map[string]interface{}{"Signed Up": "signup", "Logged In": "login"},
+		"enabled": true,
+	}
+	merged := mergeSetting(old, map[string]interface{}{
+		"events":  map[string]interface{}{"Signed Up": "register", "Logged In": nil},
+		"timeout": 30,
+	})
+	assert.Equal(t, map[string]interface{}{
+		"events":  map[string]interface{}{"Signed Up": "register"},
+		"enabled": true,
+		"timeout": 30,
+	}, merged)
+	assert.Equal(t, "signup", old["events"].(map[string]interface{})["Signed Up"])
+
+	assert.Equal(t, "UA-2", mergeSetting("UA-1", "UA-2"))
+	assert.Equal(t, map[string]interface{}{"a": 1}, mergeSetting("UA-1", map[string]interface{}{"a": 1}))
+}
+
+func TestDestinationConfig_PatchDestinationConfig(t *testing.T) {
+	setup()
+	defer teardown()
+
+	updates := 0
+	var body map[string]interface{}
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/js/%s/google-analytics", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint),
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPatch {
+				updates++
+				body = nil
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			}
+			fmt.Fprint(w, `{
+				"name": "workspaces/test-workspace/sources/js/destinations/google-analytics",
+				"enabled": true,
+				"config": [
+					{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/config/trackingId", "value": "UA-1", "type": "string"},
+					{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/config/dimensions", "value": {"plan": "dimension1", "role": "dimension2"}, "type": "map"}
+				]
+			}`)
+		})
+
+	_, changes, err := client.PatchDestinationConfig("js", "google-analytics", map[string]interface{}{
+		"trackingId": "UA-1",
+		"dimensions": map[string]interface{}{"plan": "dimension1"},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, 0, updates)
+
+	_, changes, err = client.PatchDestinationConfig("js", "google-analytics", map[string]interface{}{
+		"dimensions":  map[string]interface{}{"role": nil, "team": "dimension3"},
+		"anonymizeIp": true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+	assert.Equal(t, []DestinationConfigChange{
+		{Name: "anonymizeIp", New: true},
+		{
+			Name: "dimensions",
+			Old:  map[string]interface{}{"plan": "dimension1", "role": "dimension2"},
+			New:  map[string]interface{}{"plan": "dimension1", "team": "dimension3"},
+		},
+	}, changes)
+	assert.Equal(t, `anonymizeIp: (unset) -> true`, changes[0].String())
+	assert.Equal(t, `dimensions: {"plan":"dimension1","role":"dimension2"} -> {"plan":"dimension1","team":"dimension3"}`, changes[1].String())
+
+	assert.Equal(t, map[string]interface{}{"paths": []interface{}{"destination.config"}}, body["update_mask"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/config/trackingId", "value": "UA-1", "type": "string"},
+		map[string]interface{}{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/config/dimensions", "value": map[string]interface{}{"plan": "dimension1", "team": "dimension3"}, "type": "map"},
+		map[string]interface{}{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/config/anonymizeIp", "value": true},
+	}, body["destination"].(map[string]interface{})["config"])
+}
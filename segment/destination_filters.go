@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
 
 	"github.com/pkg/errors"
 )
 
-var updateMask = newUpdateMask("if", "actions", "title", "description", "enabled")
+// errFilterName is returned when updating a filter without its name, which is
+// the path of the filter
+var errFilterName = errors.New("the name of the filter to update is required")
+
+var updateMask = newUpdateMask(fieldNames(DestinationFilterFields)...)
 
 // ListDestinations returns all destinations for a source
 func (c *Client) ListDestinationFilters(srcName string, destinationName string) ([]DestinationFilter, error) {
@@ -46,8 +51,47 @@ func (c *Client) CreateDestinationFilter(srcName string, destinationName string,
 	return &result, nil
 }
 
+// UpdateDestinationFilter updates the filter named filter.Name. The filter is
+// read first, and only the fields that differ from it are sent; nothing is
+// sent when none do.
 func (c *Client) UpdateDestinationFilter(srcName string, destinationName string, filter DestinationFilter) (*DestinationFilter, error) {
-	data, err := c.doRequest(http.MethodPatch, filter.Name, destinationFilterCRURequest{Filter: filter, UpdateMask: updateMask})
+	if filter.Name == "" {
+		return nil, errFilterName
+	}
+	current, err := c.GetDestinationFilter(srcName, destinationName, path.Base(filter.Name))
+	if err != nil {
+		return nil, err
+	}
+	return c.updateChangedDestinationFilterFields(srcName, destinationName, current, filter)
+}
+
+// updateChangedDestinationFilterFields sends the fields of filter that differ
+// from current
+func (c *Client) updateChangedDestinationFilterFields(srcName string, destinationName string, current *DestinationFilter, filter DestinationFilter) (*DestinationFilter, error) {
+	changed, err := changedFields(*current, filter, fieldNames(DestinationFilterFields))
+	if err != nil || len(changed) == 0 {
+		return current, err
+	}
+	fields := make([]DestinationFilterField, len(changed))
+	for i, name := range changed {
+		fields[i] = DestinationFilterField(name)
+	}
+	return c.UpdateDestinationFilterFields(srcName, destinationName, filter, fields...)
+}
+
+// UpdateDestinationFilterFields updates the given fields of the filter named
+// filter.Name to their values in filter, leaving the others unchanged
+func (c *Client) UpdateDestinationFilterFields(srcName string, destinationName string, filter DestinationFilter, fields ...DestinationFilterField) (*DestinationFilter, error) {
+	if filter.Name == "" {
+		return nil, errFilterName
+	}
+	values, mask, err := updateFields("destination filter", "", filter, fieldNames(fields), fieldNames(DestinationFilterFields))
+	if err != nil {
+		return nil, err
+	}
+	values["name"] = filter.Name
+
+	data, err := c.doRequest(http.MethodPatch, filter.Name, updateRequest("filter", values, mask))
 	if err != nil {
 		return nil, err
 	}
@@ -252,9 +252,19 @@ func TestDestinationFilters_UpdateFilter(t *testing.T) {
 		defer teardown()
 		endpoint := fmt.Sprintf("/%s/%s", apiVersion, testCase.filter.Name)
 
-		mux.HandleFunc(endpoint, withValidRequest(t, "PATCH", inRequest(testCase.filterJSON), func(w http.ResponseWriter, r *http.Request) {
+		// Every field of the stored filter differs, so every field is sent
+		stored := fmt.Sprintf(`{"name": %q, "if": "all", "title": "Old", "description": "Old", "enabled": %t}`, testCase.filter.Name, !testCase.filter.IsEnabled)
+		request := fmt.Sprintf(`{"filter": %s, "update_mask": {"paths": ["title", "description", "if", "actions", "enabled"]}}`, testCase.filterJSON)
+		update := withValidRequest(t, "PATCH", request, func(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprintf(w, testCase.filterJSON)
-		}))
+		})
+		mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, stored)
+				return
+			}
+			update(w, r)
+		})
 
 		t.Run(fmt.Sprintf("UpdateFilter for %s", testCase.filterJSON), func(t *testing.T) {
 			expected := testCase.filter
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -26,6 +30,84 @@ func (c *Client) ListDestinations(srcName string) (Destinations, error) {
 	return d, nil
 }
 
+// ListAllDestinations returns the destinations of every source of the
+// workspace that match q, sorted by source and type. The destinations of the
+// sources are listed concurrently.
+func (c *Client) ListAllDestinations(q DestinationQuery) ([]DestinationRecord, error) {
+	sources, err := c.ListSources()
+	if err != nil {
+		return nil, err
+	}
+
+	destinations := make([][]Destination, len(sources.Sources))
+	err = forEachConcurrently(len(sources.Sources), maxConcurrentRequests, func(i int) error {
+		srcName := path.Base(sources.Sources[i].Name)
+		d, err := c.ListDestinations(srcName)
+		if err != nil {
+			return errors.Wrapf(err, "listing the destinations of source %s failed", srcName)
+		}
+		destinations[i] = d.Destinations
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []DestinationRecord
+	for i, dests := range destinations {
+		for _, d := range dests {
+			record := DestinationRecord{
+				Source:         path.Base(sources.Sources[i].Name),
+				Type:           path.Base(d.Name),
+				Enabled:        d.Enabled,
+				ConnectionMode: d.ConnectionMode,
+				Destination:    d,
+			}
+			ok, err := q.matches(record)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				records = append(records, record)
+			}
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Source != records[j].Source {
+			return records[i].Source < records[j].Source
+		}
+		return records[i].Type < records[j].Type
+	})
+	return records, nil
+}
+
+func (q DestinationQuery) matches(r DestinationRecord) (bool, error) {
+	if q.Type != "" && q.Type != r.Type {
+		return false, nil
+	}
+	if q.Enabled != nil && *q.Enabled != r.Enabled {
+		return false, nil
+	}
+	for name, want := range q.Config {
+		found := false
+		for _, cfg := range r.Destination.Configs {
+			if path.Base(cfg.Name) != name {
+				continue
+			}
+			equal, err := jsonEqual(cfg.Value, want)
+			if err != nil {
+				return false, errors.Wrapf(err, "comparing setting %s failed", name)
+			}
+			found = equal
+			break
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // GetDestination returns information about a destination for a source
 func (c *Client) GetDestination(srcName string, destName string) (Destination, error) {
 	var d Destination
@@ -84,18 +166,54 @@ func (c *Client) DeleteDestination(srcName string, destName string) error {
 	return nil
 }
 
-// UpdateDestination updates an existing destination with a new config
+// UpdateDestination updates an existing destination with a new config. The
+// destination is read first, and only the fields that differ from it are
+// sent; nothing is sent when none do.
 func (c *Client) UpdateDestination(srcName string, destName string, enabled bool, configs []DestinationConfig) (Destination, error) {
+	current, err := c.GetDestination(srcName, destName)
+	if err != nil {
+		return current, err
+	}
+	return c.updateChangedDestinationFields(srcName, destName, current, Destination{Enabled: enabled, Configs: configs})
+}
+
+// updateChangedDestinationFields sends the enabled flag and config of desired
+// where they differ from current
+func (c *Client) updateChangedDestinationFields(srcName string, destName string, current Destination, desired Destination) (Destination, error) {
+	changed, err := changedFields(current, desired, fieldNames([]DestinationField{DestinationFieldEnabled, DestinationFieldConfig}))
+	if err != nil || len(changed) == 0 {
+		return current, err
+	}
+	fields := make([]DestinationField, len(changed))
+	for i, name := range changed {
+		fields[i] = DestinationField(name)
+	}
+	return c.UpdateDestinationFields(srcName, destName, desired, fields...)
+}
+
+// UpdateDestinationFields updates the given fields of a destination to their
+// values in dest, leaving the others unchanged. Fields are sent even when
+// false or empty, so a destination can be disabled or its config cleared.
+// The display name and connection mode can be changed too, e.g.
+//
+//	d, err := c.UpdateDestinationFields("js", "google-analytics",
+//		segment.Destination{ConnectionMode: "CLOUD"}, segment.DestinationFieldConnectionMode)
+//
+// Use ReplaceDestination where the API refuses to switch the connection mode.
+func (c *Client) UpdateDestinationFields(srcName string, destName string, dest Destination, fields ...DestinationField) (Destination, error) {
 	var d Destination
 	destFullName := fmt.Sprintf("%s/%s/%s/%s/%s/%s",
 		WorkspacesEndpoint, c.workspace, SourceEndpoint, srcName, DestinationEndpoint, destName)
-	dest := Destination{
-		Name:    destFullName,
-		Enabled: enabled,
-		Configs: configs,
+	if dest.Configs == nil {
+		dest.Configs = []DestinationConfig{}
 	}
-	req := destinationUpdateRequest{dest, UpdateMask{Paths: []string{"destination.config", "destination.enabled"}}}
-	data, err := c.doRequest(http.MethodPatch, destFullName, req)
+	values, mask, err := updateFields("destination", "destination", dest, fieldNames(fields), fieldNames(DestinationFields))
+	if err != nil {
+		return d, err
+	}
+	values["name"] = destFullName
+
+	data, err := c.doRequest(http.MethodPatch, destFullName, updateRequest("destination", values, mask))
 	if err != nil {
 		return d, err
 	}
@@ -106,3 +224,86 @@ func (c *Client) UpdateDestination(srcName string, destName string, enabled bool
 
 	return d, nil
 }
+
+// ReplaceDestinationError is returned by ReplaceDestination when it fails
+// after deleting the destination. Destination and Filters are the destination
+// and its filters as they were read before the deletion, so that the caller
+// can restore them.
+type ReplaceDestinationError struct {
+	Destination Destination
+	Filters     []DestinationFilter
+	Err         error
+}
+
+func (err *ReplaceDestinationError) Error() string {
+	return err.Err.Error()
+}
+
+// ReplaceDestination deletes a destination and creates it again as dest, for
+// changes the API cannot make in place, such as switching between device and
+// cloud mode. dest is the whole new destination, typically the current one
+// with changes; its name, parent and times are ignored, and its settings must
+// be named in full. The destination is read and dest is checked before
+// anything is deleted. The filters of the destination are recreated on the
+// new one. Failures after the deletion return a *ReplaceDestinationError,
+// along with the new destination if it was created.
+func (c *Client) ReplaceDestination(srcName string, destName string, dest Destination) (Destination, error) {
+	var d Destination
+	destFullName := fmt.Sprintf("%s/%s/%s/%s/%s/%s",
+		WorkspacesEndpoint, c.workspace, SourceEndpoint, srcName, DestinationEndpoint, destName)
+	if dest.ConnectionMode != "CLOUD" && dest.ConnectionMode != "DEVICE" {
+		return d, errors.Errorf("connection mode of destination %s is %q, expected CLOUD or DEVICE", destName, dest.ConnectionMode)
+	}
+	for _, cfg := range dest.Configs {
+		if !strings.HasPrefix(cfg.Name, destFullName+"/config/") {
+			return d, errors.Errorf("%s is not a setting of destination %s", cfg.Name, destFullName)
+		}
+	}
+
+	current, err := c.GetDestination(srcName, destName)
+	if err != nil {
+		return d, errors.Wrapf(err, "getting destination %s failed", destName)
+	}
+	filters, err := c.ListDestinationFilters(srcName, destName)
+	if err != nil {
+		return d, errors.Wrapf(err, "listing the filters of destination %s failed", destName)
+	}
+
+	if err := c.DeleteDestination(srcName, destName); err != nil {
+		return d, errors.Wrapf(err, "deleting destination %s failed", destName)
+	}
+	replaceErr := func(err error) error {
+		return &ReplaceDestinationError{Destination: current, Filters: filters, Err: err}
+	}
+
+	dest.Name = destFullName
+	dest.Parent = ""
+	dest.CreateTime = time.Time{}
+	dest.UpdateTime = time.Time{}
+	data, err := c.doRequest(http.MethodPost,
+		fmt.Sprintf("%s/%s/%s/%s/%s",
+			WorkspacesEndpoint, c.workspace, SourceEndpoint, srcName, DestinationEndpoint),
+		destinationCreateRequest{dest})
+	if err != nil {
+		return d, replaceErr(errors.Wrapf(err, "destination %s was deleted but creating it again failed", destName))
+	}
+	err = json.Unmarshal(data, &d)
+	if err != nil {
+		return d, replaceErr(errors.Wrap(err, "failed to unmarshal destination response"))
+	}
+
+	var failed []string
+	for _, filter := range filters {
+		id := path.Base(filter.Name)
+		filter.Name = ""
+		if _, err := c.CreateDestinationFilter(srcName, destName, filter); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", id, err))
+		}
+	}
+	if len(failed) > 0 {
+		return d, replaceErr(errors.Errorf("destination %s was recreated but %d of %d filters were not: %s",
+			destName, len(failed), len(filters), strings.Join(failed, "; ")))
+	}
+
+	return d, nil
+}
@@ -1,10 +1,13 @@
 package segment
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -200,3 +203,232 @@ func TestDestinations_UpdateDestination(t *testing.T) {
 
 	assert.Equal(t, expected, actual)
 }
+
+func TestDestinations_UpdateConnectionMode(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var body map[string]interface{}
+	recordRequest(fmt.Sprintf("/%s/%s/%s/%s/js/%s/google-analytics", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint),
+		`{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics", "display_name": "GA", "connection_mode": "CLOUD"}`, &body)
+
+	d, err := client.UpdateDestinationFields("js", "google-analytics", Destination{DisplayName: "GA", ConnectionMode: "CLOUD"},
+		DestinationFieldDisplayName, DestinationFieldConnectionMode)
+	assert.NoError(t, err)
+	assert.Equal(t, "CLOUD", d.ConnectionMode)
+	assert.Equal(t, map[string]interface{}{
+		"destination": map[string]interface{}{
+			"name":            "workspaces/test-workspace/sources/js/destinations/google-analytics",
+			"display_name":    "GA",
+			"connection_mode": "CLOUD",
+		},
+		"update_mask": map[string]interface{}{"paths": []interface{}{"destination.display_name", "destination.connection_mode"}},
+	}, body)
+
+	// UpdateDestination leaves the display name and connection mode alone
+	_, err = client.UpdateDestination("js", "google-analytics", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"paths": []interface{}{"destination.enabled"}}, body["update_mask"])
+}
+
+func TestDestinations_ReplaceDestination(t *testing.T) {
+	setup()
+	defer teardown()
+
+	destinations := fmt.Sprintf("/%s/%s/%s/%s/js/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint)
+	var calls []string
+	var created map[string]interface{}
+	var filters []string
+	mux.HandleFunc(destinations, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" destinations")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		fmt.Fprint(w, `{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics", "connection_mode": "CLOUD"}`)
+	})
+	mux.HandleFunc(destinations+"/google-analytics", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" google-analytics")
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, testReplacedDestination)
+		}
+	})
+	mux.HandleFunc(destinations+"/google-analytics/"+DestinationFiltersEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" filters")
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"filters": [
+				{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/filters/df_1", "title": "Drop tests", "if": "event = 'Test'", "enabled": true},
+				{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/filters/df_2", "title": "Broken", "if": "!!"}
+			]}`)
+			return
+		}
+		var req destinationFilterCRURequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Empty(t, req.Filter.Name)
+		if req.Filter.Title == "Broken" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid FQL", "code": 3}`)
+			return
+		}
+		filters = append(filters, req.Filter.Title)
+		fmt.Fprint(w, `{}`)
+	})
+
+	d, err := client.ReplaceDestination("js", "google-analytics", Destination{
+		Name:           "workspaces/test-workspace/sources/js/destinations/google-analytics",
+		Enabled:        true,
+		ConnectionMode: "CLOUD",
+		UpdateTime:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "destination google-analytics was recreated but 1 of 2 filters were not: df_2: ")
+	replaceErr, ok := err.(*ReplaceDestinationError)
+	assert.True(t, ok)
+	assert.Equal(t, "DEVICE", replaceErr.Destination.ConnectionMode)
+	assert.Len(t, replaceErr.Filters, 2)
+	assert.Equal(t, "CLOUD", d.ConnectionMode)
+	assert.Equal(t, []string{"GET google-analytics", "GET filters", "DELETE google-analytics", "POST destinations", "POST filters", "POST filters"}, calls)
+	assert.Equal(t, []string{"Drop tests"}, filters)
+	assert.Equal(t, map[string]interface{}{
+		"name":            "workspaces/test-workspace/sources/js/destinations/google-analytics",
+		"enabled":         true,
+		"connection_mode": "CLOUD",
+		"create_time":     "0001-01-01T00:00:00Z",
+		"update_time":     "0001-01-01T00:00:00Z",
+	}, created["destination"])
+}
+
+const testReplacedDestination = `{
+	"name": "workspaces/test-workspace/sources/js/destinations/google-analytics",
+	"enabled": true,
+	"connection_mode": "DEVICE",
+	"config": [{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/config/trackingId", "value": "UA-1"}]
+}`
+
+func TestDestinations_ReplaceDestinationCreateFails(t *testing.T) {
+	setup()
+	defer teardown()
+
+	destinations := fmt.Sprintf("/%s/%s/%s/%s/js/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint)
+	var calls []string
+	mux.HandleFunc(destinations, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" destinations")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": "invalid config", "code": 3}`)
+	})
+	mux.HandleFunc(destinations+"/google-analytics", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" google-analytics")
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, testReplacedDestination)
+		}
+	})
+	mux.HandleFunc(destinations+"/google-analytics/"+DestinationFiltersEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" filters")
+		fmt.Fprint(w, `{"filters": [{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics/filters/df_1", "title": "Drop tests"}]}`)
+	})
+
+	_, err := client.ReplaceDestination("js", "google-analytics", Destination{ConnectionMode: "CLOUD"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "destination google-analytics was deleted but creating it again failed")
+	assert.Equal(t, []string{"GET google-analytics", "GET filters", "DELETE google-analytics", "POST destinations"}, calls)
+
+	replaceErr, ok := err.(*ReplaceDestinationError)
+	assert.True(t, ok)
+	assert.Equal(t, Destination{
+		Name:           "workspaces/test-workspace/sources/js/destinations/google-analytics",
+		Enabled:        true,
+		ConnectionMode: "DEVICE",
+		Configs:        []DestinationConfig{{Name: "workspaces/test-workspace/sources/js/destinations/google-analytics/config/trackingId", Value: "UA-1"}},
+	}, replaceErr.Destination)
+	assert.Equal(t, []DestinationFilter{{Name: "workspaces/test-workspace/sources/js/destinations/google-analytics/filters/df_1", Title: "Drop tests"}}, replaceErr.Filters)
+	_, ok = errors.Cause(replaceErr.Err).(*SegmentApiError)
+	assert.True(t, ok)
+}
+
+func TestDestinations_ReplaceDestinationInvalid(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+	})
+
+	_, err := client.ReplaceDestination("js", "google-analytics", Destination{ConnectionMode: "cloud"})
+	assert.EqualError(t, err, `connection mode of destination google-analytics is "cloud", expected CLOUD or DEVICE`)
+	_, err = client.ReplaceDestination("js", "google-analytics", Destination{
+		ConnectionMode: "CLOUD",
+		Configs:        []DestinationConfig{{Name: "workspaces/test-workspace/sources/js/destinations/amplitude/config/apiKey"}},
+	})
+	assert.EqualError(t, err, "workspaces/test-workspace/sources/js/destinations/amplitude/config/apiKey is not a setting of destination workspaces/test-workspace/sources/js/destinations/google-analytics")
+	assert.Empty(t, calls)
+}
+
+func TestDestinations_ListAllDestinations(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"sources": [
+			{"name": "workspaces/test-workspace/sources/web"},
+			{"name": "workspaces/test-workspace/sources/ios"}
+		]}`)
+	})
+	for src, response := range map[string]string{
+		"web": `{"destinations": [
+			{"name": "workspaces/test-workspace/sources/web/destinations/amplitude", "enabled": true, "connection_mode": "CLOUD",
+			 "config": [{"name": "workspaces/test-workspace/sources/web/destinations/amplitude/config/apiKey", "value": "key-1"}]},
+			{"name": "workspaces/test-workspace/sources/web/destinations/google-analytics", "enabled": false, "connection_mode": "DEVICE"}
+		]}`,
+		"ios": `{"destinations": [
+			{"name": "workspaces/test-workspace/sources/ios/destinations/amplitude", "enabled": false, "connection_mode": "DEVICE",
+			 "config": [{"name": "workspaces/test-workspace/sources/ios/destinations/amplitude/config/apiKey", "value": "key-2"}]}
+		]}`,
+	} {
+		response := response
+		mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, src, DestinationEndpoint),
+			func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, response) })
+	}
+
+	records, err := client.ListAllDestinations(DestinationQuery{})
+	assert.NoError(t, err)
+	var summary []string
+	for _, r := range records {
+		summary = append(summary, fmt.Sprintf("%s %s %v %s", r.Source, r.Type, r.Enabled, r.ConnectionMode))
+	}
+	assert.Equal(t, []string{
+		"ios amplitude false DEVICE",
+		"web amplitude true CLOUD",
+		"web google-analytics false DEVICE",
+	}, summary)
+
+	enabled := true
+	records, err = client.ListAllDestinations(DestinationQuery{Type: "amplitude", Enabled: &enabled})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "web", records[0].Source)
+	assert.Equal(t, "workspaces/test-workspace/sources/web/destinations/amplitude", records[0].Destination.Name)
+
+	records, err = client.ListAllDestinations(DestinationQuery{Config: map[string]interface{}{"apiKey": "key-2"}})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "ios", records[0].Source)
+
+	records, err = client.ListAllDestinations(DestinationQuery{Config: map[string]interface{}{"trackingId": "UA-1"}})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestDestinations_ListAllDestinationsError(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"sources": [{"name": "workspaces/test-workspace/sources/web"}]}`)
+	})
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/web/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint), func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "source not found", "code": 5}`)
+	})
+
+	_, err := client.ListAllDestinations(DestinationQuery{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "listing the destinations of source web failed")
+}
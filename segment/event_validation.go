@@ -0,0 +1,365 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ViolationType is the kind of a tracking plan violation
+type ViolationType string
+
+// Violation types, named as in the violations reported by Protocols
+const (
+	ViolationRequired          ViolationType = "Required"
+	ViolationInvalidType       ViolationType = "Invalid Type"
+	ViolationInvalidEnum       ViolationType = "Invalid Enum"
+	ViolationInvalidPattern    ViolationType = "Invalid Pattern"
+	ViolationInvalidFormat     ViolationType = "Invalid Format"
+	ViolationInvalidValue      ViolationType = "Invalid Value"
+	ViolationUnplannedProperty ViolationType = "Unplanned Property"
+	ViolationUnplannedEvent    ViolationType = "Unplanned Event"
+)
+
+// Violation is a single way in which an event does not match its tracking
+// plan, in the shape Protocols reports violations
+type Violation struct {
+	Type ViolationType `json:"type"`
+	// Field is the dotted path of the offending value, e.g. "properties.products.0.sku"
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Type, v.Description)
+}
+
+// ValidateEventJSON validates a JSON encoded track, identify or group call
+// against a tracking plan. See ValidateEvent.
+func ValidateEventJSON(tp TrackingPlan, data []byte) ([]Violation, error) {
+	var event map[string]interface{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal event")
+	}
+	return ValidateEvent(tp, event)
+}
+
+// ValidateEvent validates a decoded Segment call against a tracking plan the
+// way Protocols does. Every call is checked against the global rules; track
+// calls are checked against the rules of the planned event with the same
+// name and version (context.protocols.event_version, 1 by default), identify
+// and group calls against the identify and group rules. A track call of an
+// event that is not in the plan yields an Unplanned Event violation.
+func ValidateEvent(tp TrackingPlan, event map[string]interface{}) ([]Violation, error) {
+	callType, _ := event["type"].(string)
+	if callType == "" {
+		return nil, errors.New("event has no type")
+	}
+
+	v := &eventValidator{}
+	v.rules(tp.Rules.Global, event)
+	switch callType {
+	case "track":
+		name, _ := event["event"].(string)
+		if name == "" {
+			return nil, errors.New("track event has no event name")
+		}
+		version := requestedEventVersion(event)
+		planned, ok := findEvent(tp.Rules.Events, name, version)
+		if !ok {
+			v.add(ViolationUnplannedEvent, "event", "event %q (version %d) is not planned", name, version)
+			break
+		}
+		v.rules(planned.Rules, event)
+	case "identify":
+		v.rules(tp.Rules.Identify, event)
+	case "group":
+		v.rules(tp.Rules.Group, event)
+	}
+
+	return v.violations, nil
+}
+
+// requestedEventVersion returns the event version set in
+// context.protocols.event_version, defaulting to 1.
+func requestedEventVersion(event map[string]interface{}) int {
+	context, _ := event["context"].(map[string]interface{})
+	protocols, _ := context["protocols"].(map[string]interface{})
+	if version, ok := protocols["event_version"].(float64); ok {
+		return int(version)
+	}
+	return 1
+}
+
+func findEvent(events []Event, name string, version int) (Event, bool) {
+	if i := eventIndex(events, name, version); i >= 0 {
+		return events[i], true
+	}
+	return Event{}, false
+}
+
+type eventValidator struct {
+	violations []Violation
+	// definitions are the ones of the rules being checked, for $ref
+	definitions map[string]Property
+	refDepth    int
+}
+
+// maxRefDepth bounds the $ref resolutions nested in one another, so that
+// recursive definitions cannot loop forever.
+const maxRefDepth = 32
+
+func (v *eventValidator) add(t ViolationType, field string, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Type: t, Field: field, Description: fmt.Sprintf(format, args...)})
+}
+
+func (v *eventValidator) rules(r Rules, event map[string]interface{}) {
+	v.definitions = ruleDefinitions(r)
+	v.required("", r.Required, event)
+	v.properties("context", r.Properties.Context, event["context"])
+	v.properties("properties", r.Properties.Properties, event["properties"])
+	v.properties("traits", r.Properties.Traits, event["traits"])
+}
+
+func (v *eventValidator) properties(field string, p Properties, value interface{}) {
+	if value == nil && p.Type == "" && len(p.Required) == 0 {
+		return
+	}
+	schema := Property{Properties: p.Properties, Required: p.Required}
+	if p.Type != "" {
+		schema.Type = p.Type
+	}
+	v.value(field, schema, value)
+}
+
+// value checks a single value against its schema.
+func (v *eventValidator) value(field string, schema Property, value interface{}) {
+	if def, ok := resolveLocalRef(v.definitions, schema.Ref); ok && v.refDepth < maxRefDepth {
+		v.refDepth++
+		v.value(field, def, value)
+		v.refDepth--
+	}
+	if types := propertyTypes(schema.Type); len(types) > 0 && !matchesType(types, value) {
+		v.add(ViolationInvalidType, field, "Invalid type. Expected: %s, given: %s", strings.Join(types, ", "), jsonType(value))
+		return
+	}
+
+	if schema.Enum != nil && !matchesEnum(schema.Enum, value) {
+		v.add(ViolationInvalidEnum, field, "%s must be one of %s", field, strings.Join(enumValues(schema.Enum), ", "))
+	}
+	if schema.Const != nil {
+		var expected interface{}
+		if err := json.Unmarshal(schema.Const, &expected); err == nil && !reflect.DeepEqual(expected, value) {
+			v.add(ViolationInvalidValue, field, "%s must be %s", field, schema.Const)
+		}
+	}
+	v.combinators(field, schema, value)
+
+	// Required properties are checked before dispatching on the value, so
+	// that they are reported when the object is missing and its schema
+	// declares no type.
+	if object, ok := value.(map[string]interface{}); ok || value == nil {
+		v.required(field, schema.Required, object)
+	}
+
+	switch value := value.(type) {
+	case float64:
+		v.bounds(field, schema, value)
+	case string:
+		length := utf8.RuneCountInString(value)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			v.add(ViolationInvalidValue, field, "%s must be at least %d characters long", field, *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			v.add(ViolationInvalidValue, field, "%s must be at most %d characters long", field, *schema.MaxLength)
+		}
+		if schema.Pattern != nil {
+			// Patterns Go cannot compile are ignored rather than reported.
+			if re, err := regexp.Compile(*schema.Pattern); err == nil && !re.MatchString(value) {
+				v.add(ViolationInvalidPattern, field, "%s does not match pattern %s", field, *schema.Pattern)
+			}
+		}
+		if schema.Format != nil && !matchesFormat(*schema.Format, value) {
+			v.add(ViolationInvalidFormat, field, "%s is not a valid %s", field, *schema.Format)
+		}
+	case []interface{}:
+		if schema.MinItems != nil && len(value) < *schema.MinItems {
+			v.add(ViolationInvalidValue, field, "%s must have at least %d items", field, *schema.MinItems)
+		}
+		if schema.Items != nil {
+			for i, item := range value {
+				v.value(fmt.Sprintf("%s.%d", field, i), *schema.Items, item)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range sortedKeys(value) {
+			child := joinField(field, name)
+			if prop, ok := schema.Properties[name]; ok {
+				v.value(child, prop, value[name])
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					v.add(ViolationUnplannedProperty, child, "%s is not planned", child)
+				}
+			case map[string]interface{}:
+				if prop, err := decodeProperty(additional); err == nil {
+					v.value(child, prop, value[name])
+				}
+			case Property:
+				v.value(child, additional, value[name])
+			}
+		}
+	}
+}
+
+// combinators checks allOf, anyOf and oneOf. The violations of the allOf
+// schemas are reported as they are; anyOf and oneOf only report how many of
+// their schemas matched.
+func (v *eventValidator) combinators(field string, schema Property, value interface{}) {
+	for _, s := range schema.AllOf {
+		v.value(field, s, value)
+	}
+	if len(schema.AnyOf) > 0 && v.matching(field, schema.AnyOf, value) == 0 {
+		v.add(ViolationInvalidValue, field, "%s does not match any schema in anyOf", field)
+	}
+	if len(schema.OneOf) > 0 {
+		if n := v.matching(field, schema.OneOf, value); n != 1 {
+			v.add(ViolationInvalidValue, field, "%s must match exactly one schema in oneOf, matched %d", field, n)
+		}
+	}
+}
+
+// matching returns the number of schemas value is valid against.
+func (v *eventValidator) matching(field string, schemas []Property, value interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		sub := &eventValidator{definitions: v.definitions, refDepth: v.refDepth}
+		sub.value(field, s, value)
+		if len(sub.violations) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// bounds checks minimum and maximum, with exclusiveMinimum and
+// exclusiveMaximum in either their draft-04 boolean or their numeric form.
+func (v *eventValidator) bounds(field string, schema Property, value float64) {
+	if schema.Minimum != nil {
+		if exclusive, _ := schema.ExclusiveMinimum.(bool); exclusive && value <= *schema.Minimum {
+			v.add(ViolationInvalidValue, field, "%s must be greater than %v", field, *schema.Minimum)
+		} else if value < *schema.Minimum {
+			v.add(ViolationInvalidValue, field, "%s must be at least %v", field, *schema.Minimum)
+		}
+	}
+	if limit, ok := schema.ExclusiveMinimum.(float64); ok && value <= limit {
+		v.add(ViolationInvalidValue, field, "%s must be greater than %v", field, limit)
+	}
+	if schema.Maximum != nil {
+		if exclusive, _ := schema.ExclusiveMaximum.(bool); exclusive && value >= *schema.Maximum {
+			v.add(ViolationInvalidValue, field, "%s must be less than %v", field, *schema.Maximum)
+		} else if value > *schema.Maximum {
+			v.add(ViolationInvalidValue, field, "%s must be at most %v", field, *schema.Maximum)
+		}
+	}
+	if limit, ok := schema.ExclusiveMaximum.(float64); ok && value >= limit {
+		v.add(ViolationInvalidValue, field, "%s must be less than %v", field, limit)
+	}
+}
+
+func (v *eventValidator) required(field string, required []string, value map[string]interface{}) {
+	for _, name := range required {
+		if _, ok := value[name]; !ok {
+			child := joinField(field, name)
+			v.add(ViolationRequired, child, "%s is required", child)
+		}
+	}
+}
+
+func joinField(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// jsonType returns the JSON Schema type name of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func matchesType(types []string, value interface{}) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesEnum(enum []*string, value interface{}) bool {
+	for _, e := range enum {
+		if e == nil && value == nil {
+			return true
+		}
+		if s, ok := value.(string); ok && e != nil && *e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFormat checks the formats Protocols users rely on. Unknown formats
+// are accepted.
+func matchesFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	}
+	return true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
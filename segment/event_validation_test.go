@@ -0,0 +1,212 @@
+package segment
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testValidEvent = `{
+	"type": "track",
+	"event": "Test Event Clicked",
+	"context": {"context_prop_1": {}},
+	"properties": {
+		"user_id": "u_1",
+		"email": "jane@example.com",
+		"created": "2020-01-02T03:04:05Z",
+		"test_prop": 3,
+		"enum_prop": "foo",
+		"array_prop": ["a", "b"],
+		"prop_obj": {"prop_str": null, "prop_obj_nested": {"prop_bool": true}}
+	}
+}`
+
+func TestEventValidation_ValidEvent(t *testing.T) {
+	violations, err := ValidateEventJSON(testTrackingPlan(t), []byte(testValidEvent))
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+func TestEventValidation_Violations(t *testing.T) {
+	event := `{
+		"type": "track",
+		"event": "Test Event Clicked",
+		"context": {},
+		"properties": {
+			"email": "jane",
+			"created": "yesterday",
+			"test_prop": 1.5,
+			"enum_prop": "baz",
+			"array_prop": ["a", 2],
+			"prop_obj": {"prop_str": 1}
+		}
+	}`
+
+	violations, err := ValidateEventJSON(testTrackingPlan(t), []byte(event))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationRequired, Field: "context.context_prop_1", Description: "context.context_prop_1 is required"},
+		{Type: ViolationRequired, Field: "properties.user_id", Description: "properties.user_id is required"},
+		{Type: ViolationInvalidType, Field: "properties.array_prop.1", Description: "Invalid type. Expected: string, given: integer"},
+		{Type: ViolationInvalidFormat, Field: "properties.created", Description: "properties.created is not a valid date-time"},
+		{Type: ViolationInvalidPattern, Field: "properties.email", Description: "properties.email does not match pattern @"},
+		{Type: ViolationInvalidEnum, Field: "properties.enum_prop", Description: "properties.enum_prop must be one of foo, bar, null"},
+		{Type: ViolationRequired, Field: "properties.prop_obj.prop_obj_nested", Description: "properties.prop_obj.prop_obj_nested is required"},
+		{Type: ViolationInvalidType, Field: "properties.prop_obj.prop_str", Description: "Invalid type. Expected: null, string, given: integer"},
+		{Type: ViolationInvalidType, Field: "properties.test_prop", Description: "Invalid type. Expected: integer, given: number"},
+	}, violations)
+}
+
+func TestEventValidation_RequiredWithoutType(t *testing.T) {
+	tp := TrackingPlan{Rules: RuleSet{Events: []Event{{
+		Name: "Order Completed",
+		Rules: Rules{Properties: RuleProperties{Properties: Properties{
+			Required: []string{"order_id", "shipping"},
+			Properties: map[string]Property{
+				"order_id": {},
+				"shipping": {Required: []string{"city"}},
+			},
+		}}},
+	}}}}
+
+	violations, err := ValidateEventJSON(tp, []byte(`{"type": "track", "event": "Order Completed"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationRequired, Field: "properties.order_id", Description: "properties.order_id is required"},
+		{Type: ViolationRequired, Field: "properties.shipping", Description: "properties.shipping is required"},
+	}, violations)
+
+	violations, err = ValidateEventJSON(tp, []byte(`{"type": "track", "event": "Order Completed", "properties": {"order_id": 1, "shipping": null}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationRequired, Field: "properties.shipping.city", Description: "properties.shipping.city is required"},
+	}, violations)
+}
+
+func TestEventValidation_UnplannedEvent(t *testing.T) {
+	event := `{"type": "track", "event": "Test Event Clicked", "context": {"context_prop_1": {}, "protocols": {"event_version": 2}}}`
+
+	violations, err := ValidateEventJSON(testTrackingPlan(t), []byte(event))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationUnplannedEvent, Field: "event", Description: `event "Test Event Clicked" (version 2) is not planned`},
+	}, violations)
+}
+
+func TestEventValidation_IdentifyAndGroup(t *testing.T) {
+	tp := testTrackingPlan(t)
+	tp.Rules.Global = Rules{}
+	tp.Rules.Identify = Rules{
+		Type: "object",
+		Properties: RuleProperties{
+			Traits: Properties{
+				Type:     "object",
+				Required: []string{"email"},
+				Properties: map[string]Property{
+					"email": {Type: "string", Format: newString("email")},
+				},
+			},
+		},
+	}
+	tp.Rules.Group = Rules{
+		Type:     "object",
+		Required: []string{"traits"},
+	}
+
+	violations, err := ValidateEventJSON(tp, []byte(`{"type": "identify", "traits": {"email": "not an email"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationInvalidFormat, Field: "traits.email", Description: "traits.email is not a valid email"},
+	}, violations)
+
+	violations, err = ValidateEventJSON(tp, []byte(`{"type": "group", "groupId": "g_1"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationRequired, Field: "traits", Description: "traits is required"},
+	}, violations)
+}
+
+func TestEventValidation_AdditionalProperties(t *testing.T) {
+	tp := testTrackingPlan(t)
+	props := tp.Rules.Events[0].Rules.Properties.Properties.Properties
+	obj := props["prop_obj"]
+	obj.AdditionalProperties = false
+	props["prop_obj"] = obj
+	nested := obj.Properties["prop_obj_nested"]
+	nested.AdditionalProperties = map[string]interface{}{"type": "number"}
+	obj.Properties["prop_obj_nested"] = nested
+
+	event := map[string]interface{}{
+		"type":    "track",
+		"event":   "Test Event Clicked",
+		"context": map[string]interface{}{"context_prop_1": map[string]interface{}{}},
+		"properties": map[string]interface{}{
+			"user_id": "u_1",
+			"email":   "jane@example.com",
+			"prop_obj": map[string]interface{}{
+				"prop_str":        "s",
+				"prop_obj_nested": map[string]interface{}{"count": 1.0, "name": "x"},
+				"extra":           true,
+			},
+		},
+	}
+
+	violations, err := ValidateEvent(tp, event)
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationUnplannedProperty, Field: "properties.prop_obj.extra", Description: "properties.prop_obj.extra is not planned"},
+		{Type: ViolationInvalidType, Field: "properties.prop_obj.prop_obj_nested.name", Description: "Invalid type. Expected: number, given: string"},
+	}, violations)
+}
+
+func TestEventValidation_InvalidEvent(t *testing.T) {
+	_, err := ValidateEventJSON(testTrackingPlan(t), []byte(`{"event": "Test Event Clicked"}`))
+	assert.EqualError(t, err, "event has no type")
+
+	_, err = ValidateEventJSON(testTrackingPlan(t), []byte(`{"type": "track"}`))
+	assert.EqualError(t, err, "track event has no event name")
+
+	_, err = ValidateEventJSON(testTrackingPlan(t), []byte(`[]`))
+	assert.Error(t, err)
+}
+
+func TestEventValidation_SchemaKeywords(t *testing.T) {
+	min, max := 0.0, 100.0
+	minLength, maxLength := 2, 3
+	tp := TrackingPlan{Rules: RuleSet{Events: []Event{{Name: "Order Completed", Rules: Rules{
+		Properties: RuleProperties{Properties: Properties{Properties: map[string]Property{
+			"total":    {Type: "number", Minimum: &min, ExclusiveMinimum: true, Maximum: &max},
+			"discount": {Type: "number", ExclusiveMaximum: 1.0},
+			"currency": {Type: "string", MinLength: &minLength, MaxLength: &maxLength},
+			"channel":  {Const: json.RawMessage(`"web"`)},
+			"coupon":   {AnyOf: []Property{{Type: "string", Pattern: newString("^[A-Z]+$")}, {Type: "null"}}},
+			"quantity": {OneOf: []Property{{Type: "integer"}, {Type: "number", Minimum: &min}}},
+			"sku":      {AllOf: []Property{{Type: "string"}, {MaxLength: &maxLength}}},
+		}}},
+	}}}}}
+
+	valid := `{"type": "track", "event": "Order Completed", "properties": {
+		"total": 0.5, "discount": 0.5, "currency": "€UR", "channel": "web",
+		"coupon": null, "quantity": 1.5, "sku": "ABC"
+	}}`
+	violations, err := ValidateEventJSON(tp, []byte(valid))
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	invalid := `{"type": "track", "event": "Order Completed", "properties": {
+		"total": 0, "discount": 1, "currency": "E", "channel": "app",
+		"coupon": "abc", "quantity": 2, "sku": "ABCD"
+	}}`
+	violations, err = ValidateEventJSON(tp, []byte(invalid))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationInvalidValue, Field: "properties.channel", Description: `properties.channel must be "web"`},
+		{Type: ViolationInvalidValue, Field: "properties.coupon", Description: "properties.coupon does not match any schema in anyOf"},
+		{Type: ViolationInvalidValue, Field: "properties.currency", Description: "properties.currency must be at least 2 characters long"},
+		{Type: ViolationInvalidValue, Field: "properties.discount", Description: "properties.discount must be less than 1"},
+		{Type: ViolationInvalidValue, Field: "properties.quantity", Description: "properties.quantity must match exactly one schema in oneOf, matched 2"},
+		{Type: ViolationInvalidValue, Field: "properties.sku", Description: "properties.sku must be at most 3 characters long"},
+		{Type: ViolationInvalidValue, Field: "properties.total", Description: "properties.total must be greater than 0"},
+	}, violations)
+}
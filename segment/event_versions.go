@@ -0,0 +1,98 @@
+package segment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EventVersions returns the versions of the named event in a tracking plan,
+// ordered from oldest to newest
+func EventVersions(tp TrackingPlan, name string) []Event {
+	var versions []Event
+	for _, e := range tp.Rules.Events {
+		if e.Name == name {
+			versions = append(versions, e)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return eventVersion(versions[i]) < eventVersion(versions[j])
+	})
+	return versions
+}
+
+// LatestEventVersion returns the newest version of the named event
+func LatestEventVersion(tp TrackingPlan, name string) (Event, bool) {
+	versions := EventVersions(tp, name)
+	if len(versions) == 0 {
+		return Event{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// BumpEventVersion adds a new version of the named event with the given
+// rules, keeping the existing versions so that clients still sending them
+// stay valid. The new version is one above the latest and inherits its
+// description. It is inserted after the latest version and returned.
+func BumpEventVersion(tp *TrackingPlan, name string, rules Rules) (Event, error) {
+	latest, ok := LatestEventVersion(*tp, name)
+	if !ok {
+		return Event{}, errors.Errorf("event %q does not exist", name)
+	}
+
+	version := eventVersion(latest) + 1
+	bumped := Event{
+		Name:        name,
+		Description: latest.Description,
+		Rules:       rules,
+		Version:     &version,
+	}
+
+	i := eventIndex(tp.Rules.Events, name, eventVersion(latest)) + 1
+	events := make([]Event, 0, len(tp.Rules.Events)+1)
+	events = append(events, tp.Rules.Events[:i]...)
+	events = append(events, bumped)
+	events = append(events, tp.Rules.Events[i:]...)
+	tp.Rules.Events = events
+	return bumped, nil
+}
+
+// VersionBumpError is returned by CheckEventVersions when existing event
+// versions were changed in a breaking way
+type VersionBumpError struct {
+	Changes []TrackingPlanChange
+}
+
+func (err *VersionBumpError) Error() string {
+	var events []string
+	seen := map[string]bool{}
+	for _, c := range err.Changes {
+		key := fmt.Sprintf("%q (v%d)", c.Event, c.Version)
+		if !seen[key] {
+			seen[key] = true
+			events = append(events, key)
+		}
+	}
+	return fmt.Sprintf("breaking changes to existing event versions require a new version: %s", strings.Join(events, ", "))
+}
+
+// CheckEventVersions returns a *VersionBumpError if going from tracking plan
+// a to b makes a breaking change to an event version that exists in both,
+// instead of adding the change as a new version with BumpEventVersion.
+// Removing or renaming whole events is not considered, as a new version
+// would not help clients of the old one.
+func CheckEventVersions(a, b TrackingPlan) error {
+	var changes []TrackingPlanChange
+	for _, c := range DiffTrackingPlans(a, b).Breaking() {
+		if c.Section != SectionEvent || c.Type == EventRemoved || c.Type == EventRenamed {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return &VersionBumpError{Changes: changes}
+}
@@ -0,0 +1,78 @@
+package segment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventVersions_EventVersions(t *testing.T) {
+	v2, v3 := 2, 3
+	tp := TrackingPlan{Rules: RuleSet{Events: []Event{
+		{Name: "Order Completed", Version: &v3},
+		{Name: "Signed Up"},
+		{Name: "Order Completed"},
+		{Name: "Order Completed", Version: &v2},
+	}}}
+
+	var versions []int
+	for _, e := range EventVersions(tp, "Order Completed") {
+		versions = append(versions, eventVersion(e))
+	}
+	assert.Equal(t, []int{1, 2, 3}, versions)
+	assert.Empty(t, EventVersions(tp, "Logged Out"))
+
+	latest, ok := LatestEventVersion(tp, "Order Completed")
+	assert.True(t, ok)
+	assert.Equal(t, 3, *latest.Version)
+	_, ok = LatestEventVersion(tp, "Logged Out")
+	assert.False(t, ok)
+}
+
+func TestEventVersions_BumpEventVersion(t *testing.T) {
+	tp := diffTestPlan()
+	rules := Rules{Properties: RuleProperties{Properties: Properties{
+		Properties: map[string]Property{"plan": {Type: "integer"}},
+	}}}
+
+	bumped, err := BumpEventVersion(&tp, "Signed Up", rules)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *bumped.Version)
+	assert.Equal(t, rules, bumped.Rules)
+
+	var keys []string
+	for _, e := range tp.Rules.Events {
+		keys = append(keys, eventKey(e))
+	}
+	assert.Equal(t, []string{"Order Completed@1", "Signed Up@1", "Signed Up@2", "Logged Out@1"}, keys)
+	assert.Equal(t, diffTestPlan().Rules.Events[1], tp.Rules.Events[1])
+
+	_, err = BumpEventVersion(&tp, "Product Viewed", rules)
+	assert.EqualError(t, err, `event "Product Viewed" does not exist`)
+}
+
+func TestEventVersions_CheckEventVersions(t *testing.T) {
+	a := diffTestPlan()
+
+	// Non-breaking changes and removed events need no new version.
+	b := diffTestPlan()
+	order := b.Rules.Events[0].Rules.Properties.Properties
+	order.Properties["coupon"] = Property{Type: "string"}
+	b.Rules.Events = b.Rules.Events[:2]
+	assert.NoError(t, CheckEventVersions(a, b))
+
+	// A breaking change in place does.
+	b = diffTestPlan()
+	b.Rules.Events[1].Rules.Properties.Properties.Properties = map[string]Property{"plan": {Type: "integer"}}
+	err := CheckEventVersions(a, b)
+	assert.EqualError(t, err, `breaking changes to existing event versions require a new version: "Signed Up" (v1)`)
+	assert.Len(t, err.(*VersionBumpError).Changes, 1)
+
+	// The same change as a new version is fine.
+	b = diffTestPlan()
+	_, bumpErr := BumpEventVersion(&b, "Signed Up", Rules{Properties: RuleProperties{Properties: Properties{
+		Properties: map[string]Property{"plan": {Type: "integer"}},
+	}}})
+	assert.NoError(t, bumpErr)
+	assert.NoError(t, CheckEventVersions(a, b))
+}
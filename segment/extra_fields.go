@@ -0,0 +1,147 @@
+package segment
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// The methods below keep the fields of tracking plan rules that the types do
+// not model in their Extra map. Each one goes through a copy of its type
+// without methods, so that encoding/json handles the modeled fields as usual.
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *Rules) UnmarshalJSON(data []byte) error {
+	type rules Rules
+	extra, err := unmarshalWithExtra(data, (*rules)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler
+func (r Rules) MarshalJSON() ([]byte, error) {
+	type rules Rules
+	return marshalWithExtra(rules(r), r.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *Properties) UnmarshalJSON(data []byte) error {
+	type properties Properties
+	extra, err := unmarshalWithExtra(data, (*properties)(p))
+	p.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler
+func (p Properties) MarshalJSON() ([]byte, error) {
+	type properties Properties
+	return marshalWithExtra(properties(p), p.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *Property) UnmarshalJSON(data []byte) error {
+	type property Property
+	extra, err := unmarshalWithExtra(data, (*property)(p))
+	p.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler
+func (p Property) MarshalJSON() ([]byte, error) {
+	type property Property
+	return marshalWithExtra(property(p), p.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type event Event
+	extra, err := unmarshalWithExtra(data, (*event)(e))
+	e.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	return marshalWithExtra(event(e), e.Extra)
+}
+
+// unmarshalWithExtra decodes a JSON object into v, a pointer to a struct, and
+// returns the compacted fields of the object v has no field for, or nil if
+// there are none.
+func unmarshalWithExtra(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name := range jsonFieldNames(reflect.TypeOf(v).Elem()) {
+		delete(fields, name)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	// Compacting makes the values independent of the indentation of data.
+	for name, value := range fields {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil {
+			return nil, err
+		}
+		fields[name] = buf.Bytes()
+	}
+	return fields, nil
+}
+
+// marshalWithExtra encodes v, a struct, and appends the extra fields in
+// sorted order. Extra fields never replace the fields of v.
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	empty := len(data) == 2
+	for _, name := range names {
+		if !empty {
+			buf.WriteByte(',')
+		}
+		empty = false
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value := extra[name]
+		if value == nil {
+			value = json.RawMessage("null")
+		}
+		if err := json.Compact(buf, value); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonFieldNames returns the JSON names of the fields of a struct type
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for name := range jsonFieldIndex(t) {
+		names[name] = true
+	}
+	return names
+}
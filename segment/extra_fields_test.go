@@ -0,0 +1,122 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testUnknownFieldsPlan = `{
+	"name": "workspaces/test-workspace/tracking-plans/rs_123",
+	"display_name": "Test",
+	"rules": {
+		"events": [{
+			"name": "Order Completed",
+			"id": "evt_1",
+			"rules": {
+				"$schema": "http://json-schema.org/draft-07/schema#",
+				"$id": "order-completed",
+				"properties": {
+					"properties": {
+						"type": "object",
+						"additionalProperties": false,
+						"properties": {
+							"total": {"type": "number", "examples": [9.99, 20], "x-owner": "payments"}
+						},
+						"dependencies": {"coupon": ["total"]}
+					}
+				}
+			}
+		}]
+	}
+}`
+
+func TestExtraFields_RoundTrip(t *testing.T) {
+	var tp TrackingPlan
+	assert.NoError(t, json.Unmarshal([]byte(testUnknownFieldsPlan), &tp))
+
+	e := tp.Rules.Events[0]
+	assert.Equal(t, map[string]json.RawMessage{"id": json.RawMessage(`"evt_1"`)}, e.Extra)
+	assert.Equal(t, map[string]json.RawMessage{"$id": json.RawMessage(`"order-completed"`)}, e.Rules.Extra)
+	props := e.Rules.Properties.Properties
+	assert.Equal(t, map[string]json.RawMessage{
+		"additionalProperties": json.RawMessage(`false`),
+		"dependencies":         json.RawMessage(`{"coupon":["total"]}`),
+	}, props.Extra)
+	assert.Equal(t, map[string]json.RawMessage{
+		"examples": json.RawMessage(`[9.99,20]`),
+		"x-owner":  json.RawMessage(`"payments"`),
+	}, props.Properties["total"].Extra)
+	assert.Nil(t, e.Rules.Properties.Context.Extra)
+
+	data, err := json.Marshal(tp)
+	assert.NoError(t, err)
+	var actual TrackingPlan
+	assert.NoError(t, json.Unmarshal(data, &actual))
+	assert.Equal(t, tp, actual)
+	assert.Contains(t, string(data), `"id":"evt_1"`)
+}
+
+func TestExtraFields_Marshal(t *testing.T) {
+	p := Property{
+		Type: "string",
+		Extra: map[string]json.RawMessage{
+			"type":     json.RawMessage(`"number"`),
+			"examples": json.RawMessage(`["a"]`),
+			"default":  nil,
+		},
+	}
+	data, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"string","default":null,"examples":["a"]}`, string(data))
+
+	data, err = json.Marshal(Properties{Extra: map[string]json.RawMessage{"title": json.RawMessage(`"Order"`)}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title":"Order"}`, string(data))
+
+	data, err = json.Marshal(Rules{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"properties":{"context":{},"properties":{},"traits":{}}}`, string(data))
+}
+
+func TestExtraFields_Diff(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	b.Rules.Events[1].Rules.Properties.Properties.Properties["plan"] = Property{
+		Type:  "string",
+		Extra: map[string]json.RawMessage{"examples": json.RawMessage(`["pro"]`)},
+	}
+
+	diff := DiffTrackingPlans(a, b)
+	assert.Equal(t, []TrackingPlanChange{{
+		Type: ConstraintChanged, Section: SectionEvent, Event: "Signed Up", Version: 1,
+		Path: "properties.plan.examples", New: []interface{}{"pro"},
+	}}, diff.Changes)
+}
+
+func TestExtraFields_ReadModifyWrite(t *testing.T) {
+	setup()
+	defer teardown()
+
+	endpoint := fmt.Sprintf("/%s/%s/%s/%s/rs_123", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint)
+	var sent trackingPlanUpdateRequest
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&sent))
+		}
+		fmt.Fprint(w, testUnknownFieldsPlan)
+	})
+
+	tp, err := client.GetTrackingPlan("rs_123")
+	assert.NoError(t, err)
+	tp.DisplayName = "Renamed"
+	tp.Rules.Events[0].Description = "Checkout finished"
+	_, err = client.UpdateTrackingPlan("rs_123", tp)
+	assert.NoError(t, err)
+
+	assert.Equal(t, tp.Rules, sent.TrackingPlan.Rules)
+	total := sent.TrackingPlan.Rules.Events[0].Rules.Properties.Properties.Properties["total"]
+	assert.Equal(t, json.RawMessage(`"payments"`), total.Extra["x-owner"])
+}
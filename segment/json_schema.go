@@ -0,0 +1,495 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaDraft is a JSON Schema draft, identified by its meta-schema URI as
+// used in Rules.Schema
+type SchemaDraft string
+
+// JSON Schema drafts supported by tracking plans
+const (
+	Draft04 SchemaDraft = "http://json-schema.org/draft-04/schema#"
+	Draft06 SchemaDraft = "http://json-schema.org/draft-06/schema#"
+	Draft07 SchemaDraft = "http://json-schema.org/draft-07/schema#"
+)
+
+// DefaultSchemaDraft is assumed for rules without a $schema
+const DefaultSchemaDraft = Draft07
+
+var schemaDraftURI = regexp.MustCompile(`^https?://json-schema\.org/(draft-0[467])/schema#?$`)
+
+// ParseSchemaDraft returns the draft of a $schema value. Both http and https
+// URIs are accepted, with or without the trailing "#". An empty value is
+// DefaultSchemaDraft.
+func ParseSchemaDraft(schema string) (SchemaDraft, error) {
+	if schema == "" {
+		return DefaultSchemaDraft, nil
+	}
+	m := schemaDraftURI.FindStringSubmatch(strings.TrimSpace(schema))
+	if m == nil {
+		return "", errors.Errorf("unsupported $schema %q", schema)
+	}
+	return SchemaDraft("http://json-schema.org/" + m[1] + "/schema#"), nil
+}
+
+// SchemaProblem is a place where tracking plan rules are not well-formed
+// JSON Schema
+type SchemaProblem struct {
+	// Section, Event and Version locate the problem like in TrackingPlanChange
+	Section string `json:"section"`
+	Event   string `json:"event,omitempty"`
+	Version int    `json:"version,omitempty"`
+	// Path is the dotted path of the schema, e.g. "properties.products[].sku"
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p SchemaProblem) String() string {
+	var b strings.Builder
+	if p.Section == SectionEvent {
+		fmt.Fprintf(&b, "event %q", p.Event)
+		if p.Version > 1 {
+			fmt.Fprintf(&b, " (v%d)", p.Version)
+		}
+	} else {
+		fmt.Fprintf(&b, "%s rules", p.Section)
+	}
+	if p.Path != "" {
+		fmt.Fprintf(&b, ", %s", p.Path)
+	}
+	fmt.Fprintf(&b, ": %s", p.Message)
+	return b.String()
+}
+
+// SchemaError is returned by ValidateTrackingPlanSchema for malformed rules
+type SchemaError struct {
+	Problems []SchemaProblem
+}
+
+func (err *SchemaError) Error() string {
+	messages := make([]string, 0, len(err.Problems))
+	for _, p := range err.Problems {
+		messages = append(messages, p.String())
+	}
+	return "invalid tracking plan schema: " + strings.Join(messages, "; ")
+}
+
+var jsonSchemaTypes = map[string]bool{
+	"array": true, "boolean": true, "integer": true, "null": true, "number": true, "object": true, "string": true,
+}
+
+// ValidateTrackingPlanSchema checks that every set of rules in a tracking
+// plan is well-formed JSON Schema for the draft named in its $schema, and
+// returns a *SchemaError listing the problems otherwise. Patterns are
+// compiled with Go's regexp package, which lacks some ECMA 262 features such
+// as lookaheads.
+func ValidateTrackingPlanSchema(tp TrackingPlan) error {
+	c := &schemaChecker{}
+	c.rules(SchemaProblem{Section: SectionGlobal}, tp.Rules.Global)
+	c.rules(SchemaProblem{Section: SectionIdentify}, tp.Rules.Identify)
+	c.rules(SchemaProblem{Section: SectionGroup}, tp.Rules.Group)
+	for _, e := range tp.Rules.Events {
+		c.rules(SchemaProblem{Section: SectionEvent, Event: e.Name, Version: eventVersion(e)}, e.Rules)
+	}
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return &SchemaError{Problems: c.problems}
+}
+
+type schemaChecker struct {
+	draft       SchemaDraft
+	definitions map[string]Property
+	problems    []SchemaProblem
+}
+
+func (c *schemaChecker) add(loc SchemaProblem, format string, args ...interface{}) {
+	loc.Message = fmt.Sprintf(format, args...)
+	c.problems = append(c.problems, loc)
+}
+
+func (c *schemaChecker) rules(loc SchemaProblem, r Rules) {
+	draft, err := ParseSchemaDraft(r.Schema)
+	if err != nil {
+		c.add(loc, "%v", err)
+		return
+	}
+	c.draft = draft
+	c.definitions = ruleDefinitions(r)
+	if r.Type != "" && r.Type != "object" {
+		c.add(loc, "rules must be of type object, not %q", r.Type)
+	}
+	for _, s := range ruleSections(r) {
+		loc.Path = s.name
+		if s.p.Type != "" && s.p.Type != "object" {
+			c.add(loc, "must be of type object, not %q", s.p.Type)
+		}
+		c.object(loc, s.p.Properties, s.p.Required)
+	}
+}
+
+func (c *schemaChecker) object(loc SchemaProblem, properties map[string]Property, required []string) {
+	seen := map[string]bool{}
+	for _, name := range required {
+		if seen[name] {
+			c.add(loc, "required lists %q more than once", name)
+		}
+		seen[name] = true
+	}
+	for _, name := range propertyNames(properties) {
+		child := loc
+		child.Path = joinField(loc.Path, name)
+		c.property(child, properties[name])
+	}
+}
+
+func (c *schemaChecker) property(loc SchemaProblem, p Property) {
+	c.types(loc, p.Type)
+
+	if p.Pattern != nil {
+		if _, err := regexp.Compile(*p.Pattern); err != nil {
+			c.add(loc, "invalid pattern %q: %v", *p.Pattern, err)
+		}
+	}
+	if p.Enum != nil {
+		if len(p.Enum) == 0 && c.draft == Draft04 {
+			c.add(loc, "enum must have at least one value in draft-04")
+		}
+		seen := map[string]bool{}
+		for _, v := range enumValues(p.Enum) {
+			if seen[v] {
+				c.add(loc, "enum lists %s more than once", v)
+			}
+			seen[v] = true
+		}
+	}
+
+	c.nonNegative(loc, "minItems", p.MinItems)
+	c.nonNegative(loc, "minLength", p.MinLength)
+	c.nonNegative(loc, "maxLength", p.MaxLength)
+	if p.MinLength != nil && p.MaxLength != nil && *p.MinLength > *p.MaxLength {
+		c.add(loc, "minLength %d is greater than maxLength %d", *p.MinLength, *p.MaxLength)
+	}
+	if p.Minimum != nil && p.Maximum != nil && *p.Minimum > *p.Maximum {
+		c.add(loc, "minimum %v is greater than maximum %v", *p.Minimum, *p.Maximum)
+	}
+	c.exclusive(loc, "exclusiveMinimum", "minimum", p.ExclusiveMinimum, p.Minimum)
+	c.exclusive(loc, "exclusiveMaximum", "maximum", p.ExclusiveMaximum, p.Maximum)
+
+	if p.Const != nil {
+		if c.draft == Draft04 {
+			c.add(loc, "const is not supported in draft-04")
+		} else if !json.Valid(p.Const) {
+			c.add(loc, "const is not valid JSON")
+		}
+	}
+	if p.Contains != nil {
+		if c.draft == Draft04 {
+			c.add(loc, "contains is not supported in draft-04")
+		}
+		c.property(joinSchemaPath(loc, ".contains"), *p.Contains)
+	}
+	if p.Ref != "" {
+		if _, err := url.Parse(p.Ref); err != nil {
+			c.add(loc, "invalid $ref %q", p.Ref)
+		} else if _, ok := resolveLocalRef(c.definitions, p.Ref); !ok && isLocalDefinitionRef(p.Ref) {
+			c.add(loc, "$ref %q does not resolve to a definition of the rules", p.Ref)
+		}
+	}
+
+	c.subschema(loc, "additionalProperties", p.AdditionalProperties)
+	c.subschema(loc, "additionalItems", p.AdditionalItems)
+	if p.Items != nil {
+		c.property(joinSchemaPath(loc, "[]"), *p.Items)
+	}
+	for _, list := range []struct {
+		keyword string
+		schemas []Property
+	}{{"allOf", p.AllOf}, {"anyOf", p.AnyOf}, {"oneOf", p.OneOf}} {
+		if list.schemas != nil && len(list.schemas) == 0 {
+			c.add(loc, "%s must not be empty", list.keyword)
+		}
+		for i, s := range list.schemas {
+			c.property(joinSchemaPath(loc, fmt.Sprintf(".%s[%d]", list.keyword, i)), s)
+		}
+	}
+	c.object(loc, p.Properties, p.Required)
+}
+
+func (c *schemaChecker) types(loc SchemaProblem, t interface{}) {
+	var types []interface{}
+	switch t := t.(type) {
+	case nil:
+		return
+	case string:
+		types = []interface{}{t}
+	case []string:
+		for _, v := range t {
+			types = append(types, v)
+		}
+	case []interface{}:
+		types = t
+	default:
+		c.add(loc, "type must be a string or a list of strings")
+		return
+	}
+	if len(types) == 0 {
+		c.add(loc, "type must not be an empty list")
+	}
+	seen := map[string]bool{}
+	for _, v := range types {
+		s, ok := v.(string)
+		switch {
+		case !ok || !jsonSchemaTypes[s]:
+			c.add(loc, "unknown type %v", v)
+		case seen[s]:
+			c.add(loc, "type lists %s more than once", s)
+		}
+		seen[s] = true
+	}
+}
+
+func (c *schemaChecker) nonNegative(loc SchemaProblem, keyword string, v *int) {
+	if v != nil && *v < 0 {
+		c.add(loc, "%s must not be negative", keyword)
+	}
+}
+
+// exclusive checks that exclusiveMinimum or exclusiveMaximum has the form of
+// the draft: a boolean next to minimum or maximum in draft-04, a number in
+// later drafts.
+func (c *schemaChecker) exclusive(loc SchemaProblem, keyword, bound string, v interface{}, limit *float64) {
+	if v == nil {
+		return
+	}
+	switch v.(type) {
+	case bool:
+		if c.draft != Draft04 {
+			c.add(loc, "%s must be a number in drafts after draft-04", keyword)
+		} else if limit == nil {
+			c.add(loc, "%s requires %s", keyword, bound)
+		}
+	case float64, int:
+		if c.draft == Draft04 {
+			c.add(loc, "%s must be a boolean in draft-04", keyword)
+		}
+	default:
+		c.add(loc, "%s must be a number or a boolean", keyword)
+	}
+}
+
+// subschema checks additionalProperties and additionalItems, which are
+// either a boolean or a schema.
+func (c *schemaChecker) subschema(loc SchemaProblem, keyword string, v interface{}) {
+	switch v := v.(type) {
+	case nil, bool:
+	case Property:
+		c.property(joinSchemaPath(loc, "."+keyword), v)
+	case map[string]interface{}:
+		p, err := decodeProperty(v)
+		if err != nil {
+			c.add(loc, "%s is not a valid schema: %v", keyword, err)
+			return
+		}
+		c.property(joinSchemaPath(loc, "."+keyword), p)
+	default:
+		c.add(loc, "%s must be a boolean or a schema", keyword)
+	}
+}
+
+func joinSchemaPath(loc SchemaProblem, suffix string) SchemaProblem {
+	loc.Path += suffix
+	return loc
+}
+
+// NormalizeTrackingPlan rewrites every set of rules of a tracking plan for
+// the given draft. See NormalizeRules.
+func NormalizeTrackingPlan(tp TrackingPlan, draft SchemaDraft) (TrackingPlan, error) {
+	var err error
+	for _, r := range []*Rules{&tp.Rules.Global, &tp.Rules.Identify, &tp.Rules.Group} {
+		if reflect.DeepEqual(*r, Rules{}) {
+			continue
+		}
+		if *r, err = NormalizeRules(*r, draft); err != nil {
+			return tp, err
+		}
+	}
+	events := make([]Event, len(tp.Rules.Events))
+	for i, e := range tp.Rules.Events {
+		if e.Rules, err = NormalizeRules(e.Rules, draft); err != nil {
+			return tp, errors.Wrapf(err, "event %s", eventKey(e))
+		}
+		events[i] = e
+	}
+	tp.Rules.Events = events
+	return tp, nil
+}
+
+// NormalizeRules converts rules written for any supported draft to draft and
+// sets their $schema. exclusiveMinimum and exclusiveMaximum are converted
+// between their boolean (draft-04) and numeric forms. Converting to draft-04
+// turns a string or null const into a single value enum, and fails for
+// schemas using keywords draft-04 cannot express.
+func NormalizeRules(r Rules, draft SchemaDraft) (Rules, error) {
+	draft, err := ParseSchemaDraft(string(draft))
+	if err != nil {
+		return r, err
+	}
+	if _, err := ParseSchemaDraft(r.Schema); err != nil {
+		return r, err
+	}
+
+	n := schemaNormalizer{to: draft}
+	r.Schema = string(draft)
+	sections := []*Properties{&r.Properties.Context, &r.Properties.Properties, &r.Properties.Traits}
+	for i, s := range sections {
+		props, err := n.properties(ruleSectionNames[i], s.Properties)
+		if err != nil {
+			return r, err
+		}
+		s.Properties = props
+	}
+	return r, nil
+}
+
+type schemaNormalizer struct {
+	to SchemaDraft
+}
+
+func (n schemaNormalizer) properties(path string, props map[string]Property) (map[string]Property, error) {
+	if props == nil {
+		return nil, nil
+	}
+	normalized := make(map[string]Property, len(props))
+	for name, p := range props {
+		np, err := n.property(joinField(path, name), p)
+		if err != nil {
+			return nil, err
+		}
+		normalized[name] = np
+	}
+	return normalized, nil
+}
+
+func (n schemaNormalizer) property(path string, p Property) (Property, error) {
+	var err error
+	p.Minimum, p.ExclusiveMinimum = n.exclusive(p.Minimum, p.ExclusiveMinimum, func(a, b float64) bool { return a > b })
+	p.Maximum, p.ExclusiveMaximum = n.exclusive(p.Maximum, p.ExclusiveMaximum, func(a, b float64) bool { return a < b })
+
+	if n.to == Draft04 {
+		if p.Const != nil {
+			var value *string
+			if err := json.Unmarshal(p.Const, &value); err != nil {
+				return p, errors.Errorf("%s: const %s cannot be expressed in draft-04", path, p.Const)
+			}
+			p.Enum = []*string{value}
+			p.Const = nil
+		}
+		if p.Contains != nil {
+			return p, errors.Errorf("%s: contains cannot be expressed in draft-04", path)
+		}
+	}
+
+	if p.Items != nil {
+		items, err := n.property(path+"[]", *p.Items)
+		if err != nil {
+			return p, err
+		}
+		p.Items = &items
+	}
+	if p.Contains != nil {
+		contains, err := n.property(path+".contains", *p.Contains)
+		if err != nil {
+			return p, err
+		}
+		p.Contains = &contains
+	}
+	if m, ok := p.AdditionalProperties.(map[string]interface{}); ok {
+		additional, err := decodeProperty(m)
+		if err != nil {
+			return p, errors.Wrapf(err, "%s: invalid additionalProperties", path)
+		}
+		if p.AdditionalProperties, err = n.property(path+".additionalProperties", additional); err != nil {
+			return p, err
+		}
+	}
+	for _, list := range []struct {
+		keyword string
+		schemas *[]Property
+	}{{"allOf", &p.AllOf}, {"anyOf", &p.AnyOf}, {"oneOf", &p.OneOf}} {
+		if *list.schemas == nil {
+			continue
+		}
+		schemas := make([]Property, len(*list.schemas))
+		for i, s := range *list.schemas {
+			if schemas[i], err = n.property(fmt.Sprintf("%s.%s[%d]", path, list.keyword, i), s); err != nil {
+				return p, err
+			}
+		}
+		*list.schemas = schemas
+	}
+	p.Properties, err = n.properties(path, p.Properties)
+	return p, err
+}
+
+// exclusive converts an exclusive bound between its draft-04 boolean form and
+// the numeric form of later drafts. stricter reports whether inclusive limit
+// a excludes more values than exclusive limit b.
+func (n schemaNormalizer) exclusive(limit *float64, exclusive interface{}, stricter func(a, b float64) bool) (*float64, interface{}) {
+	switch v := exclusive.(type) {
+	case bool:
+		if n.to == Draft04 {
+			return limit, exclusive
+		}
+		if !v || limit == nil {
+			return limit, nil
+		}
+		return nil, *limit
+	case float64:
+		if n.to != Draft04 {
+			return limit, exclusive
+		}
+		// An inclusive limit stricter than the exclusive one makes it redundant.
+		if limit != nil && stricter(*limit, v) {
+			return limit, nil
+		}
+		return &v, true
+	}
+	return limit, exclusive
+}
+
+var ruleSectionNames = []string{"context", "properties", "traits"}
+
+type ruleSection struct {
+	name string
+	p    Properties
+}
+
+func ruleSections(r Rules) []ruleSection {
+	return []ruleSection{
+		{ruleSectionNames[0], r.Properties.Context},
+		{ruleSectionNames[1], r.Properties.Properties},
+		{ruleSectionNames[2], r.Properties.Traits},
+	}
+}
+
+// decodeProperty converts a schema decoded as a generic map, e.g. the value
+// of additionalProperties, into a Property.
+func decodeProperty(m map[string]interface{}) (Property, error) {
+	var p Property
+	data, err := json.Marshal(m)
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
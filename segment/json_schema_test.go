@@ -0,0 +1,178 @@
+package segment
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema_ParseSchemaDraft(t *testing.T) {
+	for schema, expected := range map[string]SchemaDraft{
+		"": DefaultSchemaDraft,
+		"http://json-schema.org/draft-04/schema#": Draft04,
+		"https://json-schema.org/draft-06/schema": Draft06,
+		" http://json-schema.org/draft-07/schema": Draft07,
+	} {
+		draft, err := ParseSchemaDraft(schema)
+		assert.NoError(t, err, schema)
+		assert.Equal(t, expected, draft, schema)
+	}
+
+	_, err := ParseSchemaDraft("https://json-schema.org/draft/2020-12/schema")
+	assert.EqualError(t, err, `unsupported $schema "https://json-schema.org/draft/2020-12/schema"`)
+}
+
+func TestJSONSchema_ValidTrackingPlan(t *testing.T) {
+	assert.NoError(t, ValidateTrackingPlanSchema(testTrackingPlan(t)))
+}
+
+func TestJSONSchema_ValidateTrackingPlanSchema(t *testing.T) {
+	min, max, minLength, maxLength := 10.0, 1.0, -1, 2
+	tp := TrackingPlan{Rules: RuleSet{
+		Global: Rules{Schema: "http://json-schema.org/draft-03/schema#"},
+		Events: []Event{{Name: "Order Completed", Rules: Rules{
+			Schema: string(Draft04),
+			Properties: RuleProperties{Properties: Properties{
+				Required: []string{"total", "total"},
+				Properties: map[string]Property{
+					"coupon": {Type: "string", Pattern: newString("(")},
+					"items": {Type: "array", Items: &Property{
+						Type:     []interface{}{"string", "text"},
+						Const:    json.RawMessage(`"a"`),
+						Contains: &Property{Type: "string"},
+					}},
+					"name":  {Type: "string", MinLength: &minLength, MaxLength: &maxLength},
+					"plan":  {Type: "string", Enum: []*string{}},
+					"total": {Type: "number", Minimum: &min, Maximum: &max, ExclusiveMaximum: 3.0},
+					"value": {AnyOf: []Property{}, OneOf: []Property{{Type: 1}}},
+				},
+			}},
+		}}},
+	}}
+
+	err := ValidateTrackingPlanSchema(tp)
+	if assert.IsType(t, &SchemaError{}, err) {
+		var problems []string
+		for _, p := range err.(*SchemaError).Problems {
+			problems = append(problems, p.String())
+		}
+		assert.Equal(t, []string{
+			`global rules: unsupported $schema "http://json-schema.org/draft-03/schema#"`,
+			`event "Order Completed", properties: required lists "total" more than once`,
+			`event "Order Completed", properties.coupon: invalid pattern "(": error parsing regexp: missing closing ): ` + "`(`",
+			`event "Order Completed", properties.items[]: unknown type text`,
+			`event "Order Completed", properties.items[]: const is not supported in draft-04`,
+			`event "Order Completed", properties.items[]: contains is not supported in draft-04`,
+			`event "Order Completed", properties.name: minLength must not be negative`,
+			`event "Order Completed", properties.plan: enum must have at least one value in draft-04`,
+			`event "Order Completed", properties.total: minimum 10 is greater than maximum 1`,
+			`event "Order Completed", properties.total: exclusiveMaximum must be a boolean in draft-04`,
+			`event "Order Completed", properties.value: anyOf must not be empty`,
+			`event "Order Completed", properties.value.oneOf[0]: type must be a string or a list of strings`,
+		}, problems)
+	}
+}
+
+func TestJSONSchema_NormalizeRules(t *testing.T) {
+	min, max := 0.0, 100.0
+	rules := Rules{
+		Schema: string(Draft04),
+		Properties: RuleProperties{Properties: Properties{
+			Properties: map[string]Property{
+				"total":    {Type: "number", Minimum: &min, ExclusiveMinimum: true, Maximum: &max, ExclusiveMaximum: false},
+				"quantity": {Type: "array", Items: &Property{Type: "integer", Minimum: &max, ExclusiveMinimum: true}},
+			},
+		}},
+	}
+
+	draft07, err := NormalizeRules(rules, Draft07)
+	assert.NoError(t, err)
+	assert.Equal(t, string(Draft07), draft07.Schema)
+	props := draft07.Properties.Properties.Properties
+	assert.Equal(t, Property{Type: "number", ExclusiveMinimum: 0.0, Maximum: &max}, props["total"])
+	assert.Equal(t, Property{Type: "integer", ExclusiveMinimum: 100.0}, *props["quantity"].Items)
+
+	draft04, err := NormalizeRules(draft07, Draft04)
+	assert.NoError(t, err)
+	props = draft04.Properties.Properties.Properties
+	assert.Equal(t, Property{Type: "number", Minimum: &min, ExclusiveMinimum: true, Maximum: &max}, props["total"])
+	assert.NoError(t, ValidateTrackingPlanSchema(TrackingPlan{Rules: RuleSet{Global: draft04}}))
+
+	// The original rules are left untouched.
+	assert.Equal(t, true, rules.Properties.Properties.Properties["total"].ExclusiveMinimum)
+}
+
+func TestJSONSchema_NormalizeRules_StricterBound(t *testing.T) {
+	min := 5.0
+	rules := Rules{Properties: RuleProperties{Properties: Properties{
+		Properties: map[string]Property{"total": {Minimum: &min, ExclusiveMinimum: 1.0}},
+	}}}
+
+	draft04, err := NormalizeRules(rules, Draft04)
+	assert.NoError(t, err)
+	assert.Equal(t, Property{Minimum: &min}, draft04.Properties.Properties.Properties["total"])
+}
+
+func TestJSONSchema_NormalizeRules_Const(t *testing.T) {
+	rules := Rules{Properties: RuleProperties{Properties: Properties{
+		Properties: map[string]Property{
+			"plan":   {Const: json.RawMessage(`"pro"`)},
+			"coupon": {Const: json.RawMessage(`null`)},
+		},
+	}}}
+
+	draft04, err := NormalizeRules(rules, Draft04)
+	assert.NoError(t, err)
+	props := draft04.Properties.Properties.Properties
+	assert.Equal(t, Property{Enum: []*string{newString("pro")}}, props["plan"])
+	assert.Equal(t, Property{Enum: []*string{nil}}, props["coupon"])
+
+	rules.Properties.Properties.Properties["count"] = Property{OneOf: []Property{{Const: json.RawMessage(`1`)}}}
+	_, err = NormalizeRules(rules, Draft04)
+	assert.EqualError(t, err, "properties.count.oneOf[0]: const 1 cannot be expressed in draft-04")
+
+	_, err = NormalizeRules(rules, "draft-05")
+	assert.EqualError(t, err, `unsupported $schema "draft-05"`)
+}
+
+func TestJSONSchema_NormalizeTrackingPlan(t *testing.T) {
+	tp := testTrackingPlan(t)
+	tp.Rules.Events[0].Rules.Properties.Properties.Properties["items"] = Property{Contains: &Property{Type: "string"}}
+
+	_, err := NormalizeTrackingPlan(tp, Draft04)
+	assert.EqualError(t, err, "event Test Event Clicked@1: properties.items: contains cannot be expressed in draft-04")
+
+	normalized, err := NormalizeTrackingPlan(tp, Draft06)
+	assert.NoError(t, err)
+	assert.Equal(t, Rules{}, normalized.Rules.Identify)
+	for _, e := range normalized.Rules.Events {
+		assert.Equal(t, string(Draft06), e.Rules.Schema)
+	}
+}
+
+func TestJSONSchema_PropertyRoundTrip(t *testing.T) {
+	data := `{
+		"type": "number",
+		"minimum": 0,
+		"maximum": 10,
+		"exclusiveMinimum": true,
+		"exclusiveMaximum": 9.5,
+		"minLength": 1,
+		"maxLength": 3,
+		"oneOf": [{"type": "integer"}, {"const": null}],
+		"anyOf": [{"$ref": "#/definitions/price"}],
+		"allOf": [{"const": {"currency": "USD"}}],
+		"$ref": "#/definitions/total",
+		"const": null
+	}`
+
+	var p Property
+	assert.NoError(t, json.Unmarshal([]byte(data), &p))
+	assert.Equal(t, json.RawMessage(`null`), p.Const)
+	assert.Equal(t, "#/definitions/total", p.Ref)
+
+	encoded, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.JSONEq(t, data, string(encoded))
+}
@@ -0,0 +1,316 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PropertyLibraryRefPrefix is the $ref prefix of properties referencing a
+// PropertyLibrary definition
+const PropertyLibraryRefPrefix = "#/definitions/"
+
+// PropertyLibrary holds property definitions shared by many events, such as
+// order_id or currency. Events reference them with Ref and the references
+// are replaced by the definitions with ExpandTrackingPlan before the plan is
+// sent to Segment:
+//
+//	lib := segment.PropertyLibrary{}
+//	lib.Define("order_id", segment.Property{Type: "string", Description: "id of the order"})
+//	event.Rules.Properties.Properties.Properties = lib.Refs("order_id")
+//	tp, err := lib.ExpandTrackingPlan(tp)
+type PropertyLibrary struct {
+	Definitions map[string]Property `json:"definitions"`
+}
+
+// Define adds or replaces the named definition
+func (l *PropertyLibrary) Define(name string, p Property) {
+	if l.Definitions == nil {
+		l.Definitions = map[string]Property{}
+	}
+	l.Definitions[name] = p
+}
+
+// Ref returns a property referencing the named definition. It does not check
+// that the definition exists; ExpandTrackingPlan does.
+func (l PropertyLibrary) Ref(name string) Property {
+	return Property{Ref: PropertyLibraryRefPrefix + escapeJSONPointer(name)}
+}
+
+// Refs returns properties referencing the named definitions, keyed by name
+func (l PropertyLibrary) Refs(names ...string) map[string]Property {
+	props := make(map[string]Property, len(names))
+	for _, name := range names {
+		props[name] = l.Ref(name)
+	}
+	return props
+}
+
+// ExpandTrackingPlan replaces the library references in every set of rules
+// of a tracking plan with their definitions. See ExpandRules.
+func (l PropertyLibrary) ExpandTrackingPlan(tp TrackingPlan) (TrackingPlan, error) {
+	var err error
+	for _, r := range []struct {
+		section string
+		rules   *Rules
+	}{{SectionGlobal, &tp.Rules.Global}, {SectionIdentify, &tp.Rules.Identify}, {SectionGroup, &tp.Rules.Group}} {
+		if *r.rules, err = l.ExpandRules(*r.rules); err != nil {
+			return tp, errors.Wrapf(err, "%s rules", r.section)
+		}
+	}
+	events := make([]Event, len(tp.Rules.Events))
+	for i, e := range tp.Rules.Events {
+		if e.Rules, err = l.ExpandRules(e.Rules); err != nil {
+			return tp, errors.Wrapf(err, "event %s", eventKey(e))
+		}
+		events[i] = e
+	}
+	tp.Rules.Events = events
+	return tp, nil
+}
+
+// ExpandRules replaces the properties referencing a library definition with
+// a copy of the definition, at any depth. A description next to the
+// reference replaces the one of the definition. Other references, including
+// those to definitions of the rules themselves, are left as they are. It
+// fails for references to undefined or recursive definitions.
+func (l PropertyLibrary) ExpandRules(r Rules) (Rules, error) {
+	x := libraryExpander{library: l, local: ruleDefinitions(r), expanding: map[string]bool{}}
+	sections := []*Properties{&r.Properties.Context, &r.Properties.Properties, &r.Properties.Traits}
+	for i, s := range sections {
+		props, err := x.properties(ruleSectionNames[i], s.Properties)
+		if err != nil {
+			return r, err
+		}
+		s.Properties = props
+	}
+	return r, nil
+}
+
+type libraryExpander struct {
+	library PropertyLibrary
+	// local are the definitions of the rules themselves, which are kept
+	local     map[string]Property
+	expanding map[string]bool
+}
+
+func (x libraryExpander) properties(path string, props map[string]Property) (map[string]Property, error) {
+	if props == nil {
+		return nil, nil
+	}
+	expanded := make(map[string]Property, len(props))
+	for name, p := range props {
+		ep, err := x.property(joinField(path, name), p)
+		if err != nil {
+			return nil, err
+		}
+		expanded[name] = ep
+	}
+	return expanded, nil
+}
+
+func (x libraryExpander) property(path string, p Property) (Property, error) {
+	if name, ok := libraryRefName(p.Ref); ok {
+		def, ok := x.library.Definitions[name]
+		if !ok {
+			if _, ok := x.local[name]; ok {
+				return p, nil
+			}
+			return p, errors.Errorf("%s: undefined property %q", path, name)
+		}
+		if x.expanding[name] {
+			return p, errors.Errorf("%s: property %q references itself", path, name)
+		}
+		x.expanding[name] = true
+		defer delete(x.expanding, name)
+
+		description := p.Description
+		p = def
+		if description != "" {
+			p.Description = description
+		}
+	}
+
+	var err error
+	if p.Items != nil {
+		items, err := x.property(path+"[]", *p.Items)
+		if err != nil {
+			return p, err
+		}
+		p.Items = &items
+	}
+	if p.Contains != nil {
+		contains, err := x.property(path+".contains", *p.Contains)
+		if err != nil {
+			return p, err
+		}
+		p.Contains = &contains
+	}
+	switch additional := p.AdditionalProperties.(type) {
+	case Property:
+		if p.AdditionalProperties, err = x.property(path+".additionalProperties", additional); err != nil {
+			return p, err
+		}
+	case map[string]interface{}:
+		schema, err := decodeProperty(additional)
+		if err != nil {
+			return p, errors.Wrapf(err, "%s: invalid additionalProperties", path)
+		}
+		if p.AdditionalProperties, err = x.property(path+".additionalProperties", schema); err != nil {
+			return p, err
+		}
+	}
+	for _, list := range []struct {
+		keyword string
+		schemas *[]Property
+	}{{"allOf", &p.AllOf}, {"anyOf", &p.AnyOf}, {"oneOf", &p.OneOf}} {
+		if *list.schemas == nil {
+			continue
+		}
+		schemas := make([]Property, len(*list.schemas))
+		for i, s := range *list.schemas {
+			if schemas[i], err = x.property(fmt.Sprintf("%s.%s[%d]", path, list.keyword, i), s); err != nil {
+				return p, err
+			}
+		}
+		*list.schemas = schemas
+	}
+	p.Properties, err = x.properties(path, p.Properties)
+	return p, err
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+var jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+func escapeJSONPointer(s string) string {
+	return jsonPointerEscaper.Replace(s)
+}
+
+// libraryRefName returns the definition name of a library reference
+func libraryRefName(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, PropertyLibraryRefPrefix) {
+		return "", false
+	}
+	return jsonPointerUnescaper.Replace(strings.TrimPrefix(ref, PropertyLibraryRefPrefix)), true
+}
+
+// ruleDefinitions returns the definitions ($defs in newer drafts) kept in
+// the Extra fields of rules, which local references point to.
+func ruleDefinitions(r Rules) map[string]Property {
+	defs := map[string]Property{}
+	for _, keyword := range []string{"$defs", "definitions"} {
+		var m map[string]Property
+		if err := json.Unmarshal(r.Extra[keyword], &m); err != nil {
+			continue
+		}
+		for name, p := range m {
+			defs[name] = p
+		}
+	}
+	return defs
+}
+
+var localDefinitionPrefixes = []string{PropertyLibraryRefPrefix, "#/$defs/"}
+
+// resolveLocalRef returns the definition a local reference such as
+// "#/definitions/price" or "#/$defs/price" points to.
+func resolveLocalRef(defs map[string]Property, ref string) (Property, bool) {
+	for _, prefix := range localDefinitionPrefixes {
+		if strings.HasPrefix(ref, prefix) {
+			p, ok := defs[jsonPointerUnescaper.Replace(strings.TrimPrefix(ref, prefix))]
+			return p, ok
+		}
+	}
+	return Property{}, false
+}
+
+func isLocalDefinitionRef(ref string) bool {
+	for _, prefix := range localDefinitionPrefixes {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PropertyUsage locates a property in a tracking plan
+type PropertyUsage struct {
+	// Section, Event and Version locate the rules like in TrackingPlanChange
+	Section string `json:"section"`
+	Event   string `json:"event,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Path    string `json:"path"`
+}
+
+func (u PropertyUsage) String() string {
+	if u.Section != SectionEvent {
+		return fmt.Sprintf("%s rules", u.Section)
+	}
+	if u.Version > 1 {
+		return fmt.Sprintf("event %q (v%d)", u.Event, u.Version)
+	}
+	return fmt.Sprintf("event %q", u.Event)
+}
+
+// PropertyVariant is one of the definitions of a property that is defined
+// differently across a tracking plan, with where it is used
+type PropertyVariant struct {
+	Property Property        `json:"property"`
+	Usages   []PropertyUsage `json:"usages"`
+}
+
+// PropertyInconsistency is a property path, e.g. "properties.currency",
+// defined differently by different rules
+type PropertyInconsistency struct {
+	Path     string            `json:"path"`
+	Variants []PropertyVariant `json:"variants"`
+}
+
+func (i PropertyInconsistency) String() string {
+	variants := make([]string, 0, len(i.Variants))
+	for _, v := range i.Variants {
+		usages := make([]string, 0, len(v.Usages))
+		for _, u := range v.Usages {
+			usages = append(usages, u.String())
+		}
+		data, _ := json.Marshal(v.Property)
+		variants = append(variants, fmt.Sprintf("%s in %s", data, strings.Join(usages, ", ")))
+	}
+	return fmt.Sprintf("%s is defined %d ways: %s", i.Path, len(i.Variants), strings.Join(variants, "; "))
+}
+
+// FindInconsistentProperties finds the properties that share a path across
+// rules, e.g. properties.currency in several events, but whose definitions
+// differ. These are candidates for a PropertyLibrary definition. Variants
+// are ordered from the most to the least used.
+func FindInconsistentProperties(tp TrackingPlan) []PropertyInconsistency {
+	variants := map[string][]PropertyVariant{}
+	walkTrackingPlan(tp, func(loc LintFinding, name string, p Property) {
+		if name == "" {
+			return
+		}
+		usage := PropertyUsage{Section: loc.Section, Event: loc.Event, Version: loc.Version, Path: loc.Path}
+		key, _ := json.Marshal(p)
+		for i, v := range variants[loc.Path] {
+			if existing, _ := json.Marshal(v.Property); string(existing) == string(key) {
+				variants[loc.Path][i].Usages = append(v.Usages, usage)
+				return
+			}
+		}
+		variants[loc.Path] = append(variants[loc.Path], PropertyVariant{Property: p, Usages: []PropertyUsage{usage}})
+	}, nil)
+
+	var inconsistencies []PropertyInconsistency
+	for path, vs := range variants {
+		if len(vs) < 2 {
+			continue
+		}
+		sort.SliceStable(vs, func(i, j int) bool { return len(vs[i].Usages) > len(vs[j].Usages) })
+		inconsistencies = append(inconsistencies, PropertyInconsistency{Path: path, Variants: vs})
+	}
+	sort.Slice(inconsistencies, func(i, j int) bool { return inconsistencies[i].Path < inconsistencies[j].Path })
+	return inconsistencies
+}
@@ -0,0 +1,131 @@
+package segment
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPropertyLibrary() PropertyLibrary {
+	lib := PropertyLibrary{}
+	lib.Define("order_id", Property{Type: "string", Description: "id of the order"})
+	lib.Define("currency", Property{Type: "string", Enum: []*string{newString("USD"), newString("EUR")}})
+	lib.Define("product", Property{Type: "object", Properties: map[string]Property{
+		"sku":   {Type: "string"},
+		"price": lib.Ref("price"),
+	}})
+	lib.Define("price", Property{Type: "number", Minimum: new(float64)})
+	return lib
+}
+
+func TestPropertyLibrary_ExpandTrackingPlan(t *testing.T) {
+	lib := testPropertyLibrary()
+	props := lib.Refs("order_id", "currency")
+	props["products"] = Property{Type: "array", Items: &Property{Ref: "#/definitions/product"}}
+	props["refund_id"] = Property{Ref: "#/definitions/order_id", Description: "id of the refunded order"}
+	tp := TrackingPlan{Rules: RuleSet{Events: []Event{{
+		Name:  "Order Refunded",
+		Rules: Rules{Properties: RuleProperties{Properties: Properties{Type: "object", Properties: props}}},
+	}}}}
+
+	expanded, err := lib.ExpandTrackingPlan(tp)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Property{
+		"order_id":  {Type: "string", Description: "id of the order"},
+		"refund_id": {Type: "string", Description: "id of the refunded order"},
+		"currency":  lib.Definitions["currency"],
+		"products": {Type: "array", Items: &Property{Type: "object", Properties: map[string]Property{
+			"sku":   {Type: "string"},
+			"price": {Type: "number", Minimum: new(float64)},
+		}}},
+	}, expanded.Rules.Events[0].Rules.Properties.Properties.Properties)
+	assert.NoError(t, ValidateTrackingPlanSchema(expanded))
+
+	// The plan itself is left untouched.
+	assert.Equal(t, "#/definitions/order_id", tp.Rules.Events[0].Rules.Properties.Properties.Properties["order_id"].Ref)
+}
+
+func TestPropertyLibrary_ExpandErrors(t *testing.T) {
+	lib := testPropertyLibrary()
+	rules := Rules{Properties: RuleProperties{Traits: Properties{Properties: lib.Refs("email")}}}
+	_, err := lib.ExpandRules(rules)
+	assert.EqualError(t, err, `traits.email: undefined property "email"`)
+
+	_, err = lib.ExpandTrackingPlan(TrackingPlan{Rules: RuleSet{Identify: rules}})
+	assert.EqualError(t, err, `identify rules: traits.email: undefined property "email"`)
+
+	lib.Define("category", Property{Type: "object", Properties: map[string]Property{"parent": lib.Ref("category")}})
+	rules = Rules{Properties: RuleProperties{Properties: Properties{Properties: lib.Refs("category")}}}
+	_, err = lib.ExpandRules(rules)
+	assert.EqualError(t, err, `properties.category.parent: property "category" references itself`)
+}
+
+func TestPropertyLibrary_LocalDefinitionsAreKept(t *testing.T) {
+	rules := Rules{
+		Properties: RuleProperties{Properties: Properties{Properties: map[string]Property{
+			"price": {Ref: "#/definitions/price"},
+		}}},
+		Extra: map[string]json.RawMessage{"definitions": json.RawMessage(`{"price":{"type":"number"}}`)},
+	}
+
+	expanded, err := PropertyLibrary{}.ExpandRules(rules)
+	assert.NoError(t, err)
+	assert.Equal(t, rules, expanded)
+	assert.NoError(t, ValidateTrackingPlanSchema(TrackingPlan{Rules: RuleSet{Global: rules}}))
+
+	// Local references are resolved when validating events.
+	violations, err := ValidateEvent(TrackingPlan{Rules: RuleSet{Global: rules}}, map[string]interface{}{
+		"type":       "identify",
+		"properties": map[string]interface{}{"price": "free"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Type: ViolationInvalidType, Field: "properties.price", Description: "Invalid type. Expected: number, given: string"},
+	}, violations)
+}
+
+func TestPropertyLibrary_UnresolvedRef(t *testing.T) {
+	tp := TrackingPlan{Rules: RuleSet{Global: Rules{Properties: RuleProperties{Properties: Properties{
+		Properties: testPropertyLibrary().Refs("order_id"),
+	}}}}}
+
+	err := ValidateTrackingPlanSchema(tp)
+	assert.EqualError(t, err, `invalid tracking plan schema: global rules, properties.order_id: $ref "#/definitions/order_id" does not resolve to a definition of the rules`)
+}
+
+func TestPropertyLibrary_FindInconsistentProperties(t *testing.T) {
+	usd := []*string{newString("USD")}
+	tp := TrackingPlan{Rules: RuleSet{Events: []Event{
+		{Name: "Order Completed", Rules: Rules{Properties: RuleProperties{Properties: Properties{Properties: map[string]Property{
+			"order_id": {Type: "string"},
+			"currency": {Type: "string", Enum: usd},
+		}}}}},
+		{Name: "Order Refunded", Rules: Rules{Properties: RuleProperties{Properties: Properties{Properties: map[string]Property{
+			"order_id": {Type: "string"},
+			"currency": {Type: "string"},
+		}}}}},
+		{Name: "Order Cancelled", Rules: Rules{Properties: RuleProperties{Properties: Properties{Properties: map[string]Property{
+			"order_id": {Type: "string"},
+			"currency": {Type: "string", Enum: usd},
+		}}}}},
+	}}}
+
+	inconsistencies := FindInconsistentProperties(tp)
+	assert.Equal(t, []PropertyInconsistency{{
+		Path: "properties.currency",
+		Variants: []PropertyVariant{
+			{Property: Property{Type: "string", Enum: usd}, Usages: []PropertyUsage{
+				{Section: SectionEvent, Event: "Order Completed", Version: 1, Path: "properties.currency"},
+				{Section: SectionEvent, Event: "Order Cancelled", Version: 1, Path: "properties.currency"},
+			}},
+			{Property: Property{Type: "string"}, Usages: []PropertyUsage{
+				{Section: SectionEvent, Event: "Order Refunded", Version: 1, Path: "properties.currency"},
+			}},
+		},
+	}}, inconsistencies)
+	assert.Equal(t, `properties.currency is defined 2 ways: {"type":"string","enum":["USD"]} in event "Order Completed", event "Order Cancelled"; {"type":"string"} in event "Order Refunded"`,
+		inconsistencies[0].String())
+
+	assert.Empty(t, FindInconsistentProperties(testTrackingPlan(t)))
+}
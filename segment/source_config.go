@@ -0,0 +1,298 @@
+package segment
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SourceConfigPreset names a predefined schema config
+type SourceConfigPreset string
+
+// Presets accepted by NewSourceConfig
+const (
+	// PresetPermissive lets every event through: unplanned events, properties
+	// and traits are allowed, and so are events with violations.
+	PresetPermissive SourceConfigPreset = "permissive"
+	// PresetBlockUnplanned blocks unplanned events, properties and traits, but
+	// lets planned events with violations through.
+	PresetBlockUnplanned SourceConfigPreset = "block-unplanned"
+	// PresetStrict blocks unplanned events, properties and traits, and events
+	// with violations.
+	PresetStrict SourceConfigPreset = "strict"
+)
+
+// SourceConfigPresets lists the presets, from the least to the most strict
+var SourceConfigPresets = []SourceConfigPreset{PresetPermissive, PresetBlockUnplanned, PresetStrict}
+
+// SourceConfigField is a setting of a SourceConfig, named as in the API
+type SourceConfigField string
+
+// Settings of a SourceConfig that can be updated
+const (
+	SourceConfigAllowUnplannedTrackEvents           SourceConfigField = "allow_unplanned_track_events"
+	SourceConfigAllowUnplannedIdentifyTraits        SourceConfigField = "allow_unplanned_identify_traits"
+	SourceConfigAllowUnplannedGroupTraits           SourceConfigField = "allow_unplanned_group_traits"
+	SourceConfigForwardingBlockedEventsTo           SourceConfigField = "forwarding_blocked_events_to"
+	SourceConfigAllowUnplannedTrackEventsProperties SourceConfigField = "allow_unplanned_track_event_properties"
+	SourceConfigAllowTrackEventOnViolations         SourceConfigField = "allow_track_event_on_violations"
+	SourceConfigAllowIdentifyTraitsOnViolations     SourceConfigField = "allow_identify_traits_on_violations"
+	SourceConfigAllowGroupTraitsOnViolations        SourceConfigField = "allow_group_traits_on_violations"
+	SourceConfigForwardingViolationsTo              SourceConfigField = "forwarding_violations_to"
+	SourceConfigAllowTrackPropertiesOnViolations    SourceConfigField = "allow_track_properties_on_violations"
+	SourceConfigCommonTrackEventOnViolations        SourceConfigField = "common_track_event_on_violations"
+	SourceConfigCommonIdentifyEventOnViolations     SourceConfigField = "common_identify_event_on_violations"
+	SourceConfigCommonGroupEventOnViolations        SourceConfigField = "common_group_event_on_violations"
+)
+
+// SourceConfigFields lists every setting of a SourceConfig
+var SourceConfigFields = []SourceConfigField{
+	SourceConfigAllowUnplannedTrackEvents,
+	SourceConfigAllowUnplannedIdentifyTraits,
+	SourceConfigAllowUnplannedGroupTraits,
+	SourceConfigForwardingBlockedEventsTo,
+	SourceConfigAllowUnplannedTrackEventsProperties,
+	SourceConfigAllowTrackEventOnViolations,
+	SourceConfigAllowIdentifyTraitsOnViolations,
+	SourceConfigAllowGroupTraitsOnViolations,
+	SourceConfigForwardingViolationsTo,
+	SourceConfigAllowTrackPropertiesOnViolations,
+	SourceConfigCommonTrackEventOnViolations,
+	SourceConfigCommonIdentifyEventOnViolations,
+	SourceConfigCommonGroupEventOnViolations,
+}
+
+// SourceConfigError is returned for schema configs with invalid settings
+type SourceConfigError struct {
+	Problems []string
+}
+
+func (err *SourceConfigError) Error() string {
+	return "invalid source config: " + strings.Join(err.Problems, "; ")
+}
+
+// Validate checks that the violation settings hold values accepted for their
+// call type: OmitProps is only valid for track calls and OmitTraits only for
+// identify and group calls. The legacy booleans must agree with them, as
+// SourceConfigBuilder sets them. It returns a *SourceConfigError listing the
+// problems otherwise.
+func (c SourceConfig) Validate() error {
+	if problems := c.problems(SourceConfigFields); len(problems) > 0 {
+		return &SourceConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// problems lists the problems Validate finds in the given settings. Legacy
+// booleans are only checked against violation settings that are given too.
+func (c SourceConfig) problems(fields []SourceConfigField) []string {
+	given := stringSet(fieldNames(fields))
+	var problems []string
+	valid := map[SourceConfigField]bool{}
+	for _, s := range []struct {
+		field   SourceConfigField
+		value   CommonEventSettings
+		allowed []CommonEventSettings
+	}{
+		{SourceConfigCommonTrackEventOnViolations, c.CommonTrackEventOnViolations, []CommonEventSettings{Allow, OmitProps, Block}},
+		{SourceConfigCommonIdentifyEventOnViolations, c.CommonIdentifyEventOnViolations, []CommonEventSettings{Allow, OmitTraits, Block}},
+		{SourceConfigCommonGroupEventOnViolations, c.CommonGroupEventOnViolations, []CommonEventSettings{Allow, OmitTraits, Block}},
+	} {
+		if s.value == "" || !given[string(s.field)] {
+			continue
+		}
+		for _, a := range s.allowed {
+			valid[s.field] = valid[s.field] || s.value == a
+		}
+		if !valid[s.field] {
+			allowed := make([]string, len(s.allowed))
+			for i, a := range s.allowed {
+				allowed[i] = string(a)
+			}
+			problems = append(problems, fmt.Sprintf("%s is %s, expected one of %s", s.field, s.value, strings.Join(allowed, ", ")))
+		}
+	}
+
+	// Each legacy boolean is true exactly under the listed violation settings
+	for _, s := range []struct {
+		field    SourceConfigField
+		value    bool
+		setting  SourceConfigField
+		common   CommonEventSettings
+		whenTrue []CommonEventSettings
+	}{
+		{SourceConfigAllowTrackEventOnViolations, c.AllowTrackEventOnViolations,
+			SourceConfigCommonTrackEventOnViolations, c.CommonTrackEventOnViolations, []CommonEventSettings{Allow, OmitProps}},
+		{SourceConfigAllowTrackPropertiesOnViolations, c.AllowTrackPropertiesOnViolations,
+			SourceConfigCommonTrackEventOnViolations, c.CommonTrackEventOnViolations, []CommonEventSettings{Allow}},
+		{SourceConfigAllowIdentifyTraitsOnViolations, c.AllowIdentifyTraitsOnViolations,
+			SourceConfigCommonIdentifyEventOnViolations, c.CommonIdentifyEventOnViolations, []CommonEventSettings{Allow}},
+		{SourceConfigAllowGroupTraitsOnViolations, c.AllowGroupTraitsOnViolations,
+			SourceConfigCommonGroupEventOnViolations, c.CommonGroupEventOnViolations, []CommonEventSettings{Allow}},
+	} {
+		if !valid[s.setting] || !given[string(s.field)] {
+			continue
+		}
+		expected := false
+		for _, t := range s.whenTrue {
+			expected = expected || s.common == t
+		}
+		if s.value != expected {
+			problems = append(problems, fmt.Sprintf("%s is %t, which contradicts %s %s", s.field, s.value, s.setting, s.common))
+		}
+	}
+	return problems
+}
+
+// ValidateSourceConfig checks a schema config like SourceConfig.Validate, and
+// that the sources blocked events and violations are forwarded to exist in
+// the workspace and are not the source itself.
+func (c *Client) ValidateSourceConfig(srcName string, config SourceConfig) error {
+	return c.validateSourceConfig(srcName, config, SourceConfigFields)
+}
+
+// validateSourceConfig checks the given settings like ValidateSourceConfig
+func (c *Client) validateSourceConfig(srcName string, config SourceConfig, fields []SourceConfigField) error {
+	given := stringSet(fieldNames(fields))
+	problems := config.problems(fields)
+
+	forwardBlocked := given[string(SourceConfigForwardingBlockedEventsTo)] && config.ForwardingBlockedEventsTo != ""
+	forwardViolations := given[string(SourceConfigForwardingViolationsTo)] && config.ForwardingViolationsTo != ""
+	if forwardBlocked || forwardViolations {
+		sources, err := c.ListSources()
+		if err != nil {
+			return errors.Wrap(err, "listing the sources to forward to failed")
+		}
+		exists := map[string]bool{}
+		for _, src := range sources.Sources {
+			exists[path.Base(src.Name)] = true
+		}
+		for _, f := range []struct {
+			field  SourceConfigField
+			source string
+		}{
+			{SourceConfigForwardingBlockedEventsTo, config.ForwardingBlockedEventsTo},
+			{SourceConfigForwardingViolationsTo, config.ForwardingViolationsTo},
+		} {
+			switch name := path.Base(f.source); {
+			case f.source == "" || !given[string(f.field)]:
+			case name == path.Base(srcName):
+				problems = append(problems, fmt.Sprintf("%s is the source itself", f.field))
+			case !exists[name]:
+				problems = append(problems, fmt.Sprintf("%s is %s, which is not a source of the workspace", f.field, f.source))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &SourceConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// SourceConfigBuilder builds a SourceConfig whose legacy booleans agree with
+// its violation settings, e.g.
+//
+//	config, err := segment.NewSourceConfig(segment.PresetBlockUnplanned).
+//		OnTrackViolations(segment.OmitProps).
+//		ForwardViolationsTo("js-violations").
+//		Build()
+type SourceConfigBuilder struct {
+	config SourceConfig
+	err    error
+}
+
+// NewSourceConfig starts building a schema config from a preset
+func NewSourceConfig(preset SourceConfigPreset) *SourceConfigBuilder {
+	b := &SourceConfigBuilder{}
+	switch preset {
+	case PresetPermissive:
+		b.UnplannedTrackEvents(true).UnplannedTrackProperties(true).UnplannedIdentifyTraits(true).UnplannedGroupTraits(true).
+			OnTrackViolations(Allow).OnIdentifyViolations(Allow).OnGroupViolations(Allow)
+	case PresetBlockUnplanned:
+		b.OnTrackViolations(Allow).OnIdentifyViolations(Allow).OnGroupViolations(Allow)
+	case PresetStrict:
+		b.OnTrackViolations(Block).OnIdentifyViolations(Block).OnGroupViolations(Block)
+	default:
+		b.err = errors.Errorf("unknown source config preset %q", preset)
+	}
+	return b
+}
+
+// UnplannedTrackEvents sets whether track calls of events missing from the
+// tracking plan are allowed
+func (b *SourceConfigBuilder) UnplannedTrackEvents(allow bool) *SourceConfigBuilder {
+	b.config.AllowUnplannedTrackEvents = allow
+	return b
+}
+
+// UnplannedTrackProperties sets whether properties missing from the tracking
+// plan are kept in track calls
+func (b *SourceConfigBuilder) UnplannedTrackProperties(allow bool) *SourceConfigBuilder {
+	b.config.AllowUnplannedTrackEventsProperties = allow
+	return b
+}
+
+// UnplannedIdentifyTraits sets whether traits missing from the tracking plan
+// are kept in identify calls
+func (b *SourceConfigBuilder) UnplannedIdentifyTraits(allow bool) *SourceConfigBuilder {
+	b.config.AllowUnplannedIdentifyTraits = allow
+	return b
+}
+
+// UnplannedGroupTraits sets whether traits missing from the tracking plan are
+// kept in group calls
+func (b *SourceConfigBuilder) UnplannedGroupTraits(allow bool) *SourceConfigBuilder {
+	b.config.AllowUnplannedGroupTraits = allow
+	return b
+}
+
+// OnTrackViolations sets what happens to track calls with violations: Allow,
+// OmitProps or Block
+func (b *SourceConfigBuilder) OnTrackViolations(s CommonEventSettings) *SourceConfigBuilder {
+	b.config.CommonTrackEventOnViolations = s
+	b.config.AllowTrackEventOnViolations = s == Allow || s == OmitProps
+	b.config.AllowTrackPropertiesOnViolations = s == Allow
+	return b
+}
+
+// OnIdentifyViolations sets what happens to identify calls with violations:
+// Allow, OmitTraits or Block
+func (b *SourceConfigBuilder) OnIdentifyViolations(s CommonEventSettings) *SourceConfigBuilder {
+	b.config.CommonIdentifyEventOnViolations = s
+	b.config.AllowIdentifyTraitsOnViolations = s == Allow
+	return b
+}
+
+// OnGroupViolations sets what happens to group calls with violations: Allow,
+// OmitTraits or Block
+func (b *SourceConfigBuilder) OnGroupViolations(s CommonEventSettings) *SourceConfigBuilder {
+	b.config.CommonGroupEventOnViolations = s
+	b.config.AllowGroupTraitsOnViolations = s == Allow
+	return b
+}
+
+// ForwardBlockedEventsTo forwards the blocked events to another source
+func (b *SourceConfigBuilder) ForwardBlockedEventsTo(srcName string) *SourceConfigBuilder {
+	b.config.ForwardingBlockedEventsTo = srcName
+	return b
+}
+
+// ForwardViolationsTo forwards the events with violations to another source
+func (b *SourceConfigBuilder) ForwardViolationsTo(srcName string) *SourceConfigBuilder {
+	b.config.ForwardingViolationsTo = srcName
+	return b
+}
+
+// Build returns the schema config after checking it with SourceConfig.Validate
+func (b *SourceConfigBuilder) Build() (SourceConfig, error) {
+	if b.err != nil {
+		return SourceConfig{}, b.err
+	}
+	if err := b.config.Validate(); err != nil {
+		return SourceConfig{}, err
+	}
+	return b.config, nil
+}
@@ -0,0 +1,222 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceConfig_Validate(t *testing.T) {
+	assert.NoError(t, SourceConfig{}.Validate())
+	assert.NoError(t, SourceConfig{
+		AllowTrackEventOnViolations:     true,
+		CommonTrackEventOnViolations:    OmitProps,
+		CommonIdentifyEventOnViolations: OmitTraits,
+		CommonGroupEventOnViolations:    Block,
+	}.Validate())
+
+	err := SourceConfig{
+		CommonTrackEventOnViolations:    OmitTraits,
+		CommonIdentifyEventOnViolations: OmitProps,
+		CommonGroupEventOnViolations:    "DROP",
+	}.Validate()
+	assert.EqualError(t, err, "invalid source config: "+
+		"common_track_event_on_violations is OMIT_TRAITS, expected one of ALLOW, OMIT_PROPERTIES, BLOCK; "+
+		"common_identify_event_on_violations is OMIT_PROPERTIES, expected one of ALLOW, OMIT_TRAITS, BLOCK; "+
+		"common_group_event_on_violations is DROP, expected one of ALLOW, OMIT_TRAITS, BLOCK")
+	assert.Len(t, err.(*SourceConfigError).Problems, 3)
+
+	err = SourceConfig{
+		AllowTrackEventOnViolations:      false,
+		AllowTrackPropertiesOnViolations: true,
+		AllowIdentifyTraitsOnViolations:  true,
+		CommonTrackEventOnViolations:     OmitProps,
+		CommonIdentifyEventOnViolations:  Block,
+		CommonGroupEventOnViolations:     Allow,
+	}.Validate()
+	assert.EqualError(t, err, "invalid source config: "+
+		"allow_track_event_on_violations is false, which contradicts common_track_event_on_violations OMIT_PROPERTIES; "+
+		"allow_track_properties_on_violations is true, which contradicts common_track_event_on_violations OMIT_PROPERTIES; "+
+		"allow_identify_traits_on_violations is true, which contradicts common_identify_event_on_violations BLOCK; "+
+		"allow_group_traits_on_violations is false, which contradicts common_group_event_on_violations ALLOW")
+}
+
+func TestSourceConfig_Presets(t *testing.T) {
+	permissive, err := NewSourceConfig(PresetPermissive).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, SourceConfig{
+		AllowUnplannedTrackEvents:           true,
+		AllowUnplannedIdentifyTraits:        true,
+		AllowUnplannedGroupTraits:           true,
+		AllowTrackEventOnViolations:         true,
+		AllowIdentifyTraitsOnViolations:     true,
+		AllowGroupTraitsOnViolations:        true,
+		AllowUnplannedTrackEventsProperties: true,
+		AllowTrackPropertiesOnViolations:    true,
+		CommonTrackEventOnViolations:        Allow,
+		CommonIdentifyEventOnViolations:     Allow,
+		CommonGroupEventOnViolations:        Allow,
+	}, permissive)
+
+	blockUnplanned, err := NewSourceConfig(PresetBlockUnplanned).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, SourceConfig{
+		AllowTrackEventOnViolations:      true,
+		AllowIdentifyTraitsOnViolations:  true,
+		AllowGroupTraitsOnViolations:     true,
+		AllowTrackPropertiesOnViolations: true,
+		CommonTrackEventOnViolations:     Allow,
+		CommonIdentifyEventOnViolations:  Allow,
+		CommonGroupEventOnViolations:     Allow,
+	}, blockUnplanned)
+
+	strict, err := NewSourceConfig(PresetStrict).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, SourceConfig{
+		CommonTrackEventOnViolations:    Block,
+		CommonIdentifyEventOnViolations: Block,
+		CommonGroupEventOnViolations:    Block,
+	}, strict)
+
+	_, err = NewSourceConfig("lenient").Build()
+	assert.EqualError(t, err, `unknown source config preset "lenient"`)
+}
+
+func TestSourceConfig_Builder(t *testing.T) {
+	config, err := NewSourceConfig(PresetStrict).
+		UnplannedTrackEvents(true).
+		OnTrackViolations(OmitProps).
+		OnIdentifyViolations(OmitTraits).
+		ForwardBlockedEventsTo("js-blocked").
+		ForwardViolationsTo("js-violations").
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, SourceConfig{
+		AllowUnplannedTrackEvents:       true,
+		AllowTrackEventOnViolations:     true,
+		ForwardingBlockedEventsTo:       "js-blocked",
+		ForwardingViolationsTo:          "js-violations",
+		CommonTrackEventOnViolations:    OmitProps,
+		CommonIdentifyEventOnViolations: OmitTraits,
+		CommonGroupEventOnViolations:    Block,
+	}, config)
+
+	_, err = NewSourceConfig(PresetStrict).OnGroupViolations(OmitProps).Build()
+	assert.EqualError(t, err, "invalid source config: common_group_event_on_violations is OMIT_PROPERTIES, expected one of ALLOW, OMIT_TRAITS, BLOCK")
+}
+
+func TestSourceConfig_ValidateSourceConfig(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"sources": [
+			{"name": "workspaces/test-workspace/sources/js"},
+			{"name": "workspaces/test-workspace/sources/js-violations"}
+		]}`)
+	})
+
+	assert.NoError(t, client.ValidateSourceConfig("js", SourceConfig{ForwardingViolationsTo: "js-violations"}))
+	assert.NoError(t, client.ValidateSourceConfig("js", SourceConfig{ForwardingViolationsTo: "workspaces/test-workspace/sources/js-violations"}))
+
+	err := client.ValidateSourceConfig("js", SourceConfig{
+		ForwardingBlockedEventsTo:    "js",
+		ForwardingViolationsTo:       "missing",
+		CommonTrackEventOnViolations: OmitTraits,
+	})
+	assert.EqualError(t, err, "invalid source config: "+
+		"common_track_event_on_violations is OMIT_TRAITS, expected one of ALLOW, OMIT_PROPERTIES, BLOCK; "+
+		"forwarding_blocked_events_to is the source itself; "+
+		"forwarding_violations_to is missing, which is not a source of the workspace")
+}
+
+func TestSourceConfig_UpdateRejectsInvalidConfig(t *testing.T) {
+	setup()
+	defer teardown()
+
+	called := false
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/js/schema-config", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, _ *http.Request) {
+		called = true
+	})
+
+	_, err := client.UpdateSourceConfig("js", SourceConfig{CommonIdentifyEventOnViolations: OmitProps})
+	assert.Error(t, err)
+	assert.False(t, called)
+}
+
+func TestSourceConfig_PatchValidatesGivenSettings(t *testing.T) {
+	setup()
+	defer teardown()
+
+	patches := 0
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/js/schema-config", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, _ *http.Request) {
+		patches++
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"sources": [{"name": "workspaces/test-workspace/sources/js"}]}`)
+	})
+
+	// Settings that are not sent are not checked
+	config := SourceConfig{AllowTrackEventOnViolations: true, CommonTrackEventOnViolations: Block, ForwardingViolationsTo: "missing"}
+	_, err := client.PatchSourceConfig("js", config, SourceConfigAllowTrackEventOnViolations)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, patches)
+
+	_, err = client.PatchSourceConfig("js", config, SourceConfigAllowTrackEventOnViolations, SourceConfigCommonTrackEventOnViolations)
+	assert.EqualError(t, err, "invalid source config: allow_track_event_on_violations is true, which contradicts common_track_event_on_violations BLOCK")
+	_, err = client.PatchSourceConfig("js", config, SourceConfigForwardingViolationsTo)
+	assert.EqualError(t, err, "invalid source config: forwarding_violations_to is missing, which is not a source of the workspace")
+	assert.Equal(t, 1, patches)
+}
+
+func TestSourceConfig_PatchSourceConfig(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var body map[string]interface{}
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/js/schema-config", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"name": "workspaces/test-workspace/sources/js/schema-config", "allow_unplanned_track_events": true, "allow_unplanned_identify_traits": true}`)
+			return
+		}
+		assert.Equal(t, http.MethodPatch, r.Method)
+		body = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		fmt.Fprint(w, `{"name": "workspaces/test-workspace/sources/js/schema-config", "allow_unplanned_identify_traits": true}`)
+	})
+
+	config := SourceConfig{AllowUnplannedTrackEvents: false, ForwardingViolationsTo: "", AllowUnplannedIdentifyTraits: true}
+	result, err := client.PatchSourceConfig("js", config,
+		SourceConfigAllowUnplannedTrackEvents, SourceConfigForwardingViolationsTo, SourceConfigAllowUnplannedTrackEvents)
+	assert.NoError(t, err)
+	assert.Equal(t, SourceConfig{Name: "workspaces/test-workspace/sources/js/schema-config", AllowUnplannedIdentifyTraits: true}, result)
+	assert.Equal(t, map[string]interface{}{
+		"schema_config": map[string]interface{}{
+			"allow_unplanned_track_events": false,
+			"forwarding_violations_to":     "",
+		},
+		"update_mask": map[string]interface{}{"paths": []interface{}{
+			"schema_config.allow_unplanned_track_events",
+			"schema_config.forwarding_violations_to",
+		}},
+	}, body)
+
+	// A full update sends the settings that differ from the stored config,
+	// false ones included.
+	body = nil
+	_, err = client.UpdateSourceConfig("js", config)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"schema_config": map[string]interface{}{"allow_unplanned_track_events": false},
+		"update_mask":   map[string]interface{}{"paths": []interface{}{"schema_config.allow_unplanned_track_events"}},
+	}, body)
+
+	_, err = client.PatchSourceConfig("js", config)
+	assert.EqualError(t, err, "no source config fields to update")
+	_, err = client.PatchSourceConfig("js", config, "name")
+	assert.EqualError(t, err, `unknown source config field "name"`)
+}
@@ -99,31 +99,53 @@ func (c *Client) GetSourceConfig(srcName string) (SourceConfig, error) {
 	return result, nil
 }
 
-// UpdateSourceConfig updates the schema config of a given source
+// UpdateSourceConfig updates the schema config of a given source. Configs
+// that fail SourceConfig.Validate are rejected without calling the API. The
+// config is read first, and only the settings that differ from it are sent;
+// nothing is sent when none do.
 // API Doc: https://reference.segmentapis.com/#af54244f-4ec7-4e78-96e9-8966dd18e56f
 func (c *Client) UpdateSourceConfig(srcName string, config SourceConfig) (SourceConfig, error) {
+	if err := config.Validate(); err != nil {
+		return SourceConfig{}, err
+	}
+	current, err := c.GetSourceConfig(srcName)
+	if err != nil {
+		return current, err
+	}
+	return c.patchChangedSourceConfigFields(srcName, current, config)
+}
+
+// patchChangedSourceConfigFields sends the settings of config that differ
+// from current
+func (c *Client) patchChangedSourceConfigFields(srcName string, current SourceConfig, config SourceConfig) (SourceConfig, error) {
+	changed, err := changedFields(current, config, fieldNames(SourceConfigFields))
+	if err != nil || len(changed) == 0 {
+		return current, err
+	}
+	fields := make([]SourceConfigField, len(changed))
+	for i, name := range changed {
+		fields[i] = SourceConfigField(name)
+	}
+	return c.PatchSourceConfig(srcName, config, fields...)
+}
+
+// PatchSourceConfig updates the given settings of the schema config of a
+// source to their values in config, leaving the others unchanged. Settings
+// are sent even when false or empty, so they can be turned off or cleared.
+// The given settings are checked like ValidateSourceConfig checks a whole
+// config, and rejected without being sent if they are invalid.
+func (c *Client) PatchSourceConfig(srcName string, config SourceConfig, fields ...SourceConfigField) (SourceConfig, error) {
 	var result SourceConfig
+	values, mask, err := updateFields("source config", "schema_config", config, fieldNames(fields), fieldNames(SourceConfigFields))
+	if err != nil {
+		return result, err
+	}
+	if err := c.validateSourceConfig(srcName, config, fields); err != nil {
+		return result, err
+	}
 
-	req := sourceConfigUpdateRequest{
-		Config: config,
-		UpdateMask: UpdateMask{Paths: []string{
-			"schema_config.allow_unplanned_track_events",
-			"schema_config.allow_unplanned_identify_traits",
-			"schema_config.allow_unplanned_group_traits",
-			"schema_config.forwarding_blocked_events_to",
-			"schema_config.allow_unplanned_track_event_properties",
-			"schema_config.allow_track_event_on_violations",
-			"schema_config.allow_identify_traits_on_violations",
-			"schema_config.allow_group_traits_on_violations",
-			"schema_config.forwarding_violations_to",
-			"schema_config.allow_track_properties_on_violations",
-			"schema_config.common_track_event_on_violations",
-			"schema_config.common_identify_event_on_violations",
-			"schema_config.common_group_event_on_violations",
-		}},
-	}
-
-	response, err := c.doRequest(http.MethodPatch, fmt.Sprintf("%s/%s/%s/%s/schema-config", WorkspacesEndpoint, c.workspace, SourceEndpoint, srcName), req)
+	response, err := c.doRequest(http.MethodPatch, fmt.Sprintf("%s/%s/%s/%s/schema-config", WorkspacesEndpoint, c.workspace, SourceEndpoint, srcName),
+		updateRequest("schema_config", values, mask))
 	if err != nil {
 		return result, err
 	}
@@ -194,11 +194,11 @@ func TestSources_UpdateSourceConfig(t *testing.T) {
 			"allow_unplanned_group_traits": false,
 			"forwarding_blocked_events_to": "forwarding_blocked_events_to_source_slug",
 			"allow_unplanned_track_event_properties": true,
-			"allow_track_event_on_violations": false,
+			"allow_track_event_on_violations": true,
 			"allow_identify_traits_on_violations": true,
-			"allow_group_traits_on_violations": false,
+			"allow_group_traits_on_violations": true,
 			"forwarding_violations_to": "forwarding_violations_to_source_slug",
-			"allow_track_properties_on_violations": false,
+			"allow_track_properties_on_violations": true,
 			"common_track_event_on_violations": "ALLOW",
 			"common_identify_event_on_violations": "ALLOW",
 			"common_group_event_on_violations": "ALLOW"
@@ -213,11 +213,11 @@ func TestSources_UpdateSourceConfig(t *testing.T) {
 		AllowUnplannedGroupTraits:           false,
 		ForwardingBlockedEventsTo:           "forwarding_blocked_events_to_source_slug",
 		AllowUnplannedTrackEventsProperties: true,
-		AllowTrackEventOnViolations:         false,
+		AllowTrackEventOnViolations:         true,
 		AllowIdentifyTraitsOnViolations:     true,
-		AllowGroupTraitsOnViolations:        false,
+		AllowGroupTraitsOnViolations:        true,
 		ForwardingViolationsTo:              "forwarding_violations_to_source_slug",
-		AllowTrackPropertiesOnViolations:    false,
+		AllowTrackPropertiesOnViolations:    true,
 		CommonTrackEventOnViolations:        Allow,
 		CommonIdentifyEventOnViolations:     Allow,
 		CommonGroupEventOnViolations:        Allow,
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -68,21 +70,44 @@ func (c *Client) CreateTrackingPlan(data TrackingPlan) (TrackingPlan, error) {
 	return tp, nil
 }
 
-// UpdateTrackingPlan updates a tracking plan
+// UpdateTrackingPlan updates the display name and rules of a tracking plan.
+// The plan is read first, and only the fields that differ from it are sent;
+// nothing is sent when none do.
 func (c *Client) UpdateTrackingPlan(trackingPlanID string, data TrackingPlan) (TrackingPlan, error) {
-	var tp TrackingPlan
+	current, err := c.GetTrackingPlan(trackingPlanID)
+	if err != nil {
+		return current, err
+	}
+	return c.updateChangedTrackingPlanFields(trackingPlanID, current, data)
+}
 
-	um := UpdateMask{
-		Paths: []string{"tracking_plan.display_name", "tracking_plan.rules"},
+// updateChangedTrackingPlanFields sends the fields of data that differ from
+// current
+func (c *Client) updateChangedTrackingPlanFields(trackingPlanID string, current TrackingPlan, data TrackingPlan) (TrackingPlan, error) {
+	changed, err := changedFields(current, data, fieldNames(TrackingPlanFields))
+	if err != nil || len(changed) == 0 {
+		return current, err
 	}
-	tpUpdateReq := trackingPlanUpdateRequest{
-		UpdateMask:   um,
-		TrackingPlan: data,
+	fields := make([]TrackingPlanField, len(changed))
+	for i, name := range changed {
+		fields[i] = TrackingPlanField(name)
+	}
+	return c.UpdateTrackingPlanFields(trackingPlanID, data, fields...)
+}
+
+// UpdateTrackingPlanFields updates the given fields of a tracking plan to
+// their values in data, leaving the others unchanged
+func (c *Client) UpdateTrackingPlanFields(trackingPlanID string, data TrackingPlan, fields ...TrackingPlanField) (TrackingPlan, error) {
+	var tp TrackingPlan
+	values, mask, err := updateFields("tracking plan", "tracking_plan", data, fieldNames(fields), fieldNames(TrackingPlanFields))
+	if err != nil {
+		return tp, err
 	}
+
 	responseBody, err := c.doRequest(http.MethodPut,
 		fmt.Sprintf("%s/%s/%s/%s/",
 			WorkspacesEndpoint, c.workspace, TrackingPlanEndpoint, trackingPlanID),
-		tpUpdateReq)
+		updateRequest("tracking_plan", values, mask))
 
 	if err != nil {
 		return tp, err
@@ -166,4 +191,254 @@ func (c *Client) DeleteTrackingPlanSourceConnection(planId string, sourceName st
 	return nil
 }
 
-// TODO: Batch create tracking plan source connections
+// ErrNoTrackingPlan is the cause of the error returned by
+// GetSourceTrackingPlan for sources without a tracking plan
+var ErrNoTrackingPlan = errors.New("source is not connected to a tracking plan")
+
+// GetSourceTrackingPlan returns the tracking plan a source is connected to.
+// The source can be given by its short or full name. The API only lists the
+// sources of a plan, so the sources of every plan of the workspace are
+// listed, see GetSourceTrackingPlans.
+func (c *Client) GetSourceTrackingPlan(srcName string) (TrackingPlan, error) {
+	plans, err := c.sourceTrackingPlans()
+	if err != nil {
+		return TrackingPlan{}, err
+	}
+	tp, ok := plans[path.Base(srcName)]
+	if !ok {
+		return TrackingPlan{}, errors.Wrapf(ErrNoTrackingPlan, "source %s", srcName)
+	}
+	return tp, nil
+}
+
+// GetSourceTrackingPlans returns the tracking plan of every source of the
+// workspace, and the sources that have none. The sources of the tracking
+// plans are listed concurrently.
+func (c *Client) GetSourceTrackingPlans() (SourceTrackingPlans, error) {
+	var result SourceTrackingPlans
+	plans, err := c.sourceTrackingPlans()
+	if err != nil {
+		return result, err
+	}
+	sources, err := c.ListSources()
+	if err != nil {
+		return result, err
+	}
+
+	result.Plans = plans
+	for _, src := range sources.Sources {
+		name := path.Base(src.Name)
+		if _, ok := plans[name]; !ok {
+			result.Unconnected = append(result.Unconnected, name)
+		}
+	}
+	sort.Strings(result.Unconnected)
+	return result, nil
+}
+
+// sourceTrackingPlans maps source names to the tracking plans they are
+// connected to
+func (c *Client) sourceTrackingPlans() (map[string]TrackingPlan, error) {
+	tps, err := c.ListTrackingPlans()
+	if err != nil {
+		return nil, err
+	}
+
+	connections := make([][]TrackingPlanSourceConnection, len(tps.TrackingPlans))
+	err = forEachConcurrently(len(tps.TrackingPlans), maxConcurrentRequests, func(i int) error {
+		planID := path.Base(tps.TrackingPlans[i].Name)
+		conns, err := c.ListTrackingPlanSources(planID)
+		if err != nil {
+			return errors.Wrapf(err, "listing the sources of tracking plan %s failed", planID)
+		}
+		connections[i] = conns
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plans := map[string]TrackingPlan{}
+	for i, conns := range connections {
+		for _, conn := range conns {
+			plans[path.Base(conn.Source)] = tps.TrackingPlans[i]
+		}
+	}
+	return plans, nil
+}
+
+// BatchCreateTrackingPlanSourceConnections connects several sources to a
+// tracking plan with a single request to the batch endpoint. The API rejects
+// the whole batch when one of the sources cannot be connected, in which case
+// the sources are connected one by one to find out which. The result of each
+// source is returned in the order given, and a *BatchConnectionError lists
+// the sources that failed. Sources may be given by short or full name; the
+// results use the short name.
+func (c *Client) BatchCreateTrackingPlanSourceConnections(planId string, sourceNames []string) ([]TrackingPlanSourceConnectionResult, error) {
+	sourceNames = uniqueStrings(baseNames(sourceNames))
+	if len(sourceNames) == 0 {
+		return nil, nil
+	}
+
+	req := trackingPlanSourceConnectionBatchCreateRequest{}
+	for _, name := range sourceNames {
+		req.Requests = append(req.Requests,
+			trackingPlanSourceConnectionCreateRequest{Name: fmt.Sprintf("workspaces/%s/sources/%s", c.workspace, name)})
+	}
+	data, err := c.doRequest(http.MethodPost,
+		fmt.Sprintf("%s/%s/%s/%s/source-connections:batchCreate",
+			WorkspacesEndpoint, c.workspace, TrackingPlanEndpoint, planId),
+		req)
+	if rejectedBatch(err) && len(sourceNames) > 1 {
+		return c.createTrackingPlanSourceConnections(planId, sourceNames)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var connections TrackingPlanSourceConnections
+	if err := json.Unmarshal(data, &connections); err != nil {
+		return nil, errors.Errorf("Unexpected response body: %s", string(data))
+	}
+	connected := map[string]TrackingPlanSourceConnection{}
+	for _, conn := range connections.Connections {
+		connected[path.Base(conn.Source)] = conn
+	}
+
+	results := make([]TrackingPlanSourceConnectionResult, len(sourceNames))
+	for i, name := range sourceNames {
+		results[i].Source = name
+		if conn, ok := connected[name]; ok {
+			results[i].Connection = &conn
+		} else {
+			results[i].Err = errors.New("source is missing from the batch response")
+		}
+	}
+	return results, batchConnectionError(results)
+}
+
+// rejectedBatch reports whether the API refused the batch itself, as opposed
+// to the request failing for reasons that apply to any request, such as an
+// invalid token or rate limiting
+func rejectedBatch(err error) bool {
+	apiErr, ok := err.(*SegmentApiError)
+	if !ok {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+// createTrackingPlanSourceConnections connects the sources one at a time
+func (c *Client) createTrackingPlanSourceConnections(planId string, sourceNames []string) ([]TrackingPlanSourceConnectionResult, error) {
+	results := make([]TrackingPlanSourceConnectionResult, len(sourceNames))
+	for i, name := range sourceNames {
+		results[i].Source = name
+		if results[i].Err = c.CreateTrackingPlanSourceConnection(planId, name); results[i].Err == nil {
+			results[i].Connection = &TrackingPlanSourceConnection{
+				Source:         fmt.Sprintf("workspaces/%s/sources/%s", c.workspace, name),
+				TrackingPlanId: planId,
+			}
+		}
+	}
+	return results, batchConnectionError(results)
+}
+
+// SyncTrackingPlanSources makes the sources connected to a tracking plan
+// exactly sourceNames: missing sources are connected in a batch and the
+// others are disconnected. Failures do not stop the sync; they are listed in
+// the returned sync and in a *BatchConnectionError. Sources may be given by
+// short or full name.
+func (c *Client) SyncTrackingPlanSources(planId string, sourceNames []string) (TrackingPlanSourcesSync, error) {
+	var sync TrackingPlanSourcesSync
+	sourceNames = baseNames(sourceNames)
+	current, err := c.ListTrackingPlanSources(planId)
+	if err != nil {
+		return sync, err
+	}
+
+	desired := map[string]bool{}
+	for _, name := range sourceNames {
+		desired[name] = true
+	}
+	connected := map[string]bool{}
+	for _, conn := range current {
+		connected[path.Base(conn.Source)] = true
+	}
+
+	var add []string
+	for _, name := range uniqueStrings(sourceNames) {
+		if !connected[name] {
+			add = append(add, name)
+		}
+	}
+	total := len(add)
+	results, err := c.BatchCreateTrackingPlanSourceConnections(planId, add)
+	if _, ok := err.(*BatchConnectionError); err != nil && !ok {
+		return sync, err
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			sync.Failed = append(sync.Failed, r)
+		} else {
+			sync.Connected = append(sync.Connected, r.Source)
+		}
+	}
+
+	for _, conn := range current {
+		name := path.Base(conn.Source)
+		if desired[name] {
+			continue
+		}
+		total++
+		if err := c.DeleteTrackingPlanSourceConnection(planId, name); err != nil {
+			sync.Failed = append(sync.Failed, TrackingPlanSourceConnectionResult{Source: name, Err: err})
+		} else {
+			sync.Disconnected = append(sync.Disconnected, name)
+		}
+	}
+	if len(sync.Failed) > 0 {
+		return sync, &BatchConnectionError{Total: total, Failed: sync.Failed}
+	}
+	return sync, nil
+}
+
+// batchConnectionError returns a *BatchConnectionError for the failed
+// results, or nil if there are none
+func batchConnectionError(results []TrackingPlanSourceConnectionResult) error {
+	err := &BatchConnectionError{Total: len(results)}
+	for _, r := range results {
+		if r.Err != nil {
+			err.Failed = append(err.Failed, r)
+		}
+	}
+	if len(err.Failed) == 0 {
+		return nil
+	}
+	return err
+}
+
+// baseNames returns the short names of resources given by short or full name
+func baseNames(names []string) []string {
+	short := make([]string, len(names))
+	for i, name := range names {
+		short[i] = path.Base(name)
+	}
+	return short
+}
+
+// uniqueStrings returns the strings without duplicates, in their first order
+func uniqueStrings(list []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
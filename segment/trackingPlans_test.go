@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -238,6 +240,8 @@ func TestTrackingPlans_GetTrackingPlan(t *testing.T) {
 							Properties: Properties{
 								Required: []string{"user_id", "email"},
 								Type:     "object",
+								// The response has a context field here, which is kept as is.
+								Extra: map[string]json.RawMessage{"context": json.RawMessage(`{}`)},
 								Properties: map[string]Property{
 									"user_id": {
 										Description: "unique id of the user",
@@ -349,6 +353,8 @@ func TestTrackingPlans_CreateTrackingPlan(t *testing.T) {
 							Properties: Properties{
 								Required: []string{"user_id", "email"},
 								Type:     "object",
+								// The response has a context field here, which is kept as is.
+								Extra: map[string]json.RawMessage{"context": json.RawMessage(`{}`)},
 								Properties: map[string]Property{
 									"user_id": {
 										Description: "unique id of the user",
@@ -464,6 +470,8 @@ func TestTrackingPlans_UpdateTrackingPlan(t *testing.T) {
 							Properties: Properties{
 								Required: []string{"user_id", "email"},
 								Type:     "object",
+								// The response has a context field here, which is kept as is.
+								Extra: map[string]json.RawMessage{"context": json.RawMessage(`{}`)},
 								Properties: map[string]Property{
 									"user_id": {
 										Description: "unique id of the user",
@@ -607,3 +615,223 @@ func TestTrackingPlans_DeleteTrackingPlansSourceConnection(t *testing.T) {
 	err := client.DeleteTrackingPlanSourceConnection(testTrackingPlanID, "test_source1")
 	assert.NoError(t, err)
 }
+
+func TestTrackingPlans_BatchCreateTrackingPlanSourceConnections(t *testing.T) {
+	setup()
+	defer teardown()
+
+	endpoint := fmt.Sprintf("/%s/%s/%s/%s/%s/source-connections:batchCreate", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint, testTrackingPlanID)
+
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		var j bytes.Buffer
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Compact(&j, b))
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, fmt.Sprintf(`{"requests":[{"source_name":"workspaces/%[1]s/sources/test_source1"},{"source_name":"workspaces/%[1]s/sources/test_source2"}]}`, testWorkspace), j.String())
+		fmt.Fprintf(w, `{"connections": [
+			{"source_name": "workspaces/%[1]s/sources/test_source2", "tracking_plan_id": "%[2]s"},
+			{"source_name": "workspaces/%[1]s/sources/test_source1", "tracking_plan_id": "%[2]s"}
+		]}`, testWorkspace, testTrackingPlanID)
+	})
+
+	results, err := client.BatchCreateTrackingPlanSourceConnections(testTrackingPlanID, []string{"test_source1", "test_source2", "test_source1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []TrackingPlanSourceConnectionResult{
+		{Source: "test_source1", Connection: &TrackingPlanSourceConnection{Source: "workspaces/test-workspace/sources/test_source1", TrackingPlanId: testTrackingPlanID}},
+		{Source: "test_source2", Connection: &TrackingPlanSourceConnection{Source: "workspaces/test-workspace/sources/test_source2", TrackingPlanId: testTrackingPlanID}},
+	}, results)
+
+	results, err = client.BatchCreateTrackingPlanSourceConnections(testTrackingPlanID, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestTrackingPlans_BatchCreateTrackingPlanSourceConnectionsPartialFailure(t *testing.T) {
+	setup()
+	defer teardown()
+
+	base := fmt.Sprintf("/%s/%s/%s/%s/%s/source-connections", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint, testTrackingPlanID)
+
+	mux.HandleFunc(base+":batchCreate", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": "source not found", "code": 5}`)
+	})
+	mux.HandleFunc(base, func(w http.ResponseWriter, r *http.Request) {
+		var req trackingPlanSourceConnectionCreateRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Name == "workspaces/test-workspace/sources/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"source_name": "%s", "tracking_plan_id": "%s"}`, req.Name, testTrackingPlanID)
+	})
+
+	results, err := client.BatchCreateTrackingPlanSourceConnections(testTrackingPlanID, []string{"test_source1", "missing"})
+	assert.Len(t, results, 2)
+	assert.Equal(t, "test_source1", results[0].Source)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, &TrackingPlanSourceConnection{Source: "workspaces/test-workspace/sources/test_source1", TrackingPlanId: testTrackingPlanID}, results[0].Connection)
+	assert.Equal(t, "missing", results[1].Source)
+	assert.Nil(t, results[1].Connection)
+	assert.Error(t, results[1].Err)
+
+	batchErr, ok := err.(*BatchConnectionError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, batchErr.Total)
+	assert.Equal(t, []TrackingPlanSourceConnectionResult{results[1]}, batchErr.Failed)
+	assert.Equal(t, fmt.Sprintf("1 of 2 sources failed: missing: %v", results[1].Err), err.Error())
+}
+
+func TestTrackingPlans_SyncTrackingPlanSources(t *testing.T) {
+	setup()
+	defer teardown()
+
+	base := fmt.Sprintf("/%s/%s/%s/%s/%s/source-connections", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint, testTrackingPlanID)
+
+	mux.HandleFunc(base, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, testSourcesResponse)
+		}
+	})
+	mux.HandleFunc(base+":batchCreate", func(w http.ResponseWriter, r *http.Request) {
+		var req trackingPlanSourceConnectionBatchCreateRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, []trackingPlanSourceConnectionCreateRequest{{Name: "workspaces/test-workspace/sources/test_source3"}}, req.Requests)
+		fmt.Fprintf(w, `{"connections": [{"source_name": "workspaces/test-workspace/sources/test_source3", "tracking_plan_id": "%s"}]}`, testTrackingPlanID)
+	})
+	var deleted []string
+	mux.HandleFunc(base+"/test_source2", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, "test_source2")
+			fmt.Fprint(w, "{}")
+		}
+	})
+
+	sync, err := client.SyncTrackingPlanSources(testTrackingPlanID, []string{"test_source1", "test_source3"})
+	assert.NoError(t, err)
+	assert.Equal(t, TrackingPlanSourcesSync{
+		Connected:    []string{"test_source3"},
+		Disconnected: []string{"test_source2"},
+	}, sync)
+	assert.Equal(t, []string{"test_source2"}, deleted)
+}
+
+func TestTrackingPlans_SyncTrackingPlanSourcesFullNames(t *testing.T) {
+	setup()
+	defer teardown()
+
+	base := fmt.Sprintf("/%s/%s/%s/%s/%s/source-connections", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint, testTrackingPlanID)
+
+	mux.HandleFunc(base, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, testSourcesResponse)
+		}
+	})
+	mux.HandleFunc(base+":batchCreate", func(w http.ResponseWriter, r *http.Request) {
+		var req trackingPlanSourceConnectionBatchCreateRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, []trackingPlanSourceConnectionCreateRequest{{Name: "workspaces/test-workspace/sources/test_source3"}}, req.Requests)
+		fmt.Fprintf(w, `{"connections": [{"source_name": "workspaces/test-workspace/sources/test_source3", "tracking_plan_id": "%s"}]}`, testTrackingPlanID)
+	})
+	var deleted []string
+	mux.HandleFunc(base+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, path.Base(r.URL.Path))
+			fmt.Fprint(w, "{}")
+		}
+	})
+
+	sync, err := client.SyncTrackingPlanSources(testTrackingPlanID, []string{
+		"workspaces/test-workspace/sources/test_source1",
+		"workspaces/test-workspace/sources/test_source3",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, TrackingPlanSourcesSync{
+		Connected:    []string{"test_source3"},
+		Disconnected: []string{"test_source2"},
+	}, sync)
+	assert.Equal(t, []string{"test_source2"}, deleted)
+}
+
+func setupSourceTrackingPlans() {
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tracking_plans": [
+			{"name": "workspaces/test-workspace/tracking-plans/rs_123abc", "display_name": "Web"},
+			{"name": "workspaces/test-workspace/tracking-plans/rs_456def", "display_name": "Mobile"},
+			{"name": "workspaces/test-workspace/tracking-plans/rs_789ghi", "display_name": "Unused"}
+		]}`)
+	})
+	connections := map[string]string{
+		"rs_123abc": `{"connections": [{"source_name": "workspaces/test-workspace/sources/js", "tracking_plan_id": "rs_123abc"}]}`,
+		"rs_456def": `{"connections": [
+			{"source_name": "workspaces/test-workspace/sources/ios", "tracking_plan_id": "rs_456def"},
+			{"source_name": "workspaces/test-workspace/sources/android", "tracking_plan_id": "rs_456def"}
+		]}`,
+		"rs_789ghi": `{}`,
+	}
+	for id, body := range connections {
+		body := body
+		mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/%s/source-connections", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint, id), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		})
+	}
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sources": [
+			{"name": "workspaces/test-workspace/sources/server"},
+			{"name": "workspaces/test-workspace/sources/ios"},
+			{"name": "workspaces/test-workspace/sources/js"},
+			{"name": "workspaces/test-workspace/sources/android"},
+			{"name": "workspaces/test-workspace/sources/backfill"}
+		]}`)
+	})
+}
+
+func TestTrackingPlans_GetSourceTrackingPlan(t *testing.T) {
+	setup()
+	defer teardown()
+	setupSourceTrackingPlans()
+
+	tp, err := client.GetSourceTrackingPlan("android")
+	assert.NoError(t, err)
+	assert.Equal(t, TrackingPlan{Name: "workspaces/test-workspace/tracking-plans/rs_456def", DisplayName: "Mobile"}, tp)
+
+	tp, err = client.GetSourceTrackingPlan("workspaces/test-workspace/sources/android")
+	assert.NoError(t, err)
+	assert.Equal(t, "Mobile", tp.DisplayName)
+
+	_, err = client.GetSourceTrackingPlan("server")
+	assert.EqualError(t, err, "source server: source is not connected to a tracking plan")
+	assert.Equal(t, ErrNoTrackingPlan, errors.Cause(err))
+}
+
+func TestTrackingPlans_GetSourceTrackingPlans(t *testing.T) {
+	setup()
+	defer teardown()
+	setupSourceTrackingPlans()
+
+	actual, err := client.GetSourceTrackingPlans()
+	assert.NoError(t, err)
+	web := TrackingPlan{Name: "workspaces/test-workspace/tracking-plans/rs_123abc", DisplayName: "Web"}
+	mobile := TrackingPlan{Name: "workspaces/test-workspace/tracking-plans/rs_456def", DisplayName: "Mobile"}
+	assert.Equal(t, SourceTrackingPlans{
+		Plans:       map[string]TrackingPlan{"js": web, "ios": mobile, "android": mobile},
+		Unconnected: []string{"backfill", "server"},
+	}, actual)
+}
+
+func TestTrackingPlans_GetSourceTrackingPlansError(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tracking_plans": [{"name": "workspaces/test-workspace/tracking-plans/rs_123abc"}]}`)
+	})
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/rs_123abc/source-connections", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := client.GetSourceTrackingPlans()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "listing the sources of tracking plan rs_123abc failed")
+}
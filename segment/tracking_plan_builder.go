@@ -0,0 +1,358 @@
+package segment
+
+import (
+	"github.com/pkg/errors"
+)
+
+// TrackingPlanBuilder builds a TrackingPlan with the schema boilerplate
+// filled in: every set of rules gets a $schema and the object types, and
+// required properties are listed in their parent.
+//
+//	tp, err := segment.NewTrackingPlan("Shop").
+//		Event("Order Completed").
+//		Description("An order was completed").
+//		Property("order_id", segment.String().Required()).
+//		Property("total", segment.Number().Min(0)).
+//		Event("Signed Up").
+//		Property("plan", segment.String().Enum("free", "pro")).
+//		Build()
+//
+// The Event, Global, Identify and Group methods are available at any point
+// of the chain to start another set of rules.
+type TrackingPlanBuilder struct {
+	tp      TrackingPlan
+	library *PropertyLibrary
+	err     error
+}
+
+// NewTrackingPlan starts building a tracking plan with a display name
+func NewTrackingPlan(displayName string) *TrackingPlanBuilder {
+	return &TrackingPlanBuilder{tp: TrackingPlan{DisplayName: displayName}}
+}
+
+// Library sets the library whose definitions Ref properties point to
+func (b *TrackingPlanBuilder) Library(lib PropertyLibrary) *TrackingPlanBuilder {
+	b.library = &lib
+	return b
+}
+
+// Event starts a new event. Unversioned events are version 1.
+func (b *TrackingPlanBuilder) Event(name string) *EventBuilder {
+	b.tp.Rules.Events = append(b.tp.Rules.Events, Event{Name: name, Rules: newBuilderRules()})
+	return &EventBuilder{TrackingPlanBuilder: b, index: len(b.tp.Rules.Events) - 1}
+}
+
+// Global continues with the rules applied to all calls
+func (b *TrackingPlanBuilder) Global() *RulesBuilder {
+	return &RulesBuilder{TrackingPlanBuilder: b, rules: &b.tp.Rules.Global}
+}
+
+// Identify continues with the rules of identify calls
+func (b *TrackingPlanBuilder) Identify() *RulesBuilder {
+	return &RulesBuilder{TrackingPlanBuilder: b, rules: &b.tp.Rules.Identify}
+}
+
+// Group continues with the rules of group calls
+func (b *TrackingPlanBuilder) Group() *RulesBuilder {
+	return &RulesBuilder{TrackingPlanBuilder: b, rules: &b.tp.Rules.Group}
+}
+
+// Build returns the tracking plan. Library references are expanded and the
+// result is checked with ValidateTrackingPlanSchema. It fails on the first
+// mistake made while building, such as a property added twice.
+func (b *TrackingPlanBuilder) Build() (TrackingPlan, error) {
+	if b.err != nil {
+		return TrackingPlan{}, b.err
+	}
+
+	seen := map[string]bool{}
+	for _, e := range b.tp.Rules.Events {
+		if seen[eventKey(e)] {
+			return TrackingPlan{}, errors.Errorf("event %s is defined more than once", eventKey(e))
+		}
+		seen[eventKey(e)] = true
+	}
+
+	library := PropertyLibrary{}
+	if b.library != nil {
+		library = *b.library
+	}
+	tp, err := library.ExpandTrackingPlan(b.tp)
+	if err != nil {
+		return TrackingPlan{}, err
+	}
+	if err := ValidateTrackingPlanSchema(tp); err != nil {
+		return TrackingPlan{}, err
+	}
+	return tp, nil
+}
+
+func (b *TrackingPlanBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// newBuilderRules returns the rules of an event, which are always set
+func newBuilderRules() Rules {
+	return Rules{Schema: string(DefaultSchemaDraft), Type: "object"}
+}
+
+// EventBuilder adds properties to an event of a TrackingPlanBuilder
+type EventBuilder struct {
+	*TrackingPlanBuilder
+	index int
+}
+
+func (b *EventBuilder) event() *Event {
+	return &b.tp.Rules.Events[b.index]
+}
+
+// Description sets the description of the event
+func (b *EventBuilder) Description(description string) *EventBuilder {
+	b.event().Description = description
+	return b
+}
+
+// Version sets the version of the event
+func (b *EventBuilder) Version(version int) *EventBuilder {
+	b.event().Version = &version
+	return b
+}
+
+// Property adds a property to the event's properties
+func (b *EventBuilder) Property(name string, p *PropertyBuilder) *EventBuilder {
+	b.addProperty(b.event(), "properties", &b.event().Rules.Properties.Properties, name, p)
+	return b
+}
+
+// Context adds a property to the event's context
+func (b *EventBuilder) Context(name string, p *PropertyBuilder) *EventBuilder {
+	b.addProperty(b.event(), "context", &b.event().Rules.Properties.Context, name, p)
+	return b
+}
+
+// RulesBuilder adds properties to the global, identify or group rules of a
+// TrackingPlanBuilder
+type RulesBuilder struct {
+	*TrackingPlanBuilder
+	rules *Rules
+}
+
+// Property adds a property to the rules' properties
+func (b *RulesBuilder) Property(name string, p *PropertyBuilder) *RulesBuilder {
+	b.addRulesProperty(&b.rules.Properties.Properties, "properties", name, p)
+	return b
+}
+
+// Context adds a property to the rules' context
+func (b *RulesBuilder) Context(name string, p *PropertyBuilder) *RulesBuilder {
+	b.addRulesProperty(&b.rules.Properties.Context, "context", name, p)
+	return b
+}
+
+// Trait adds a property to the rules' traits
+func (b *RulesBuilder) Trait(name string, p *PropertyBuilder) *RulesBuilder {
+	b.addRulesProperty(&b.rules.Properties.Traits, "traits", name, p)
+	return b
+}
+
+func (b *RulesBuilder) addRulesProperty(section *Properties, sectionName, name string, p *PropertyBuilder) {
+	if b.rules.Schema == "" {
+		*b.rules = Rules{Schema: string(DefaultSchemaDraft), Type: "object", Properties: b.rules.Properties}
+	}
+	b.addProperty(nil, sectionName, section, name, p)
+}
+
+func (b *TrackingPlanBuilder) addProperty(e *Event, sectionName string, section *Properties, name string, p *PropertyBuilder) {
+	where := "rules"
+	if e != nil {
+		where = "event " + eventKey(*e)
+	}
+	if _, ok := section.Properties[name]; ok {
+		b.setErr(errors.Errorf("%s: property %s is added more than once", where, joinField(sectionName, name)))
+		return
+	}
+	if p.err != nil {
+		b.setErr(errors.Wrapf(p.err, "%s: property %s", where, joinField(sectionName, name)))
+		return
+	}
+	if section.Properties == nil {
+		section.Properties = map[string]Property{}
+	}
+	section.Type = "object"
+	section.Properties[name] = p.Build()
+	if p.required {
+		section.Required = append(section.Required, name)
+	}
+}
+
+// PropertyBuilder builds a Property. Start with one of the type constructors
+// such as String or Object. Mistakes such as adding a nested
+// property twice are reported by the Build method of the tracking plan.
+type PropertyBuilder struct {
+	p        Property
+	required bool
+	err      error
+}
+
+func newPropertyBuilder(t string) *PropertyBuilder {
+	return &PropertyBuilder{p: Property{Type: t}}
+}
+
+// String starts a string property
+func String() *PropertyBuilder { return newPropertyBuilder("string") }
+
+// Integer starts an integer property
+func Integer() *PropertyBuilder { return newPropertyBuilder("integer") }
+
+// Number starts a number property
+func Number() *PropertyBuilder { return newPropertyBuilder("number") }
+
+// Boolean starts a boolean property
+func Boolean() *PropertyBuilder { return newPropertyBuilder("boolean") }
+
+// Object starts an object property, whose properties are added with Property
+func Object() *PropertyBuilder { return newPropertyBuilder("object") }
+
+// DateTime starts a string property in the date-time format
+func DateTime() *PropertyBuilder { return String().Format("date-time") }
+
+// Array starts an array property with items of the given kind
+func Array(items *PropertyBuilder) *PropertyBuilder {
+	b := newPropertyBuilder("array")
+	item := items.Build()
+	b.p.Items = &item
+	if items.err != nil {
+		b.err = errors.Wrap(items.err, "items")
+	}
+	return b
+}
+
+// Ref starts a property referencing a definition of the library set with
+// TrackingPlanBuilder.Library
+func Ref(name string) *PropertyBuilder {
+	return &PropertyBuilder{p: PropertyLibrary{}.Ref(name)}
+}
+
+// Required marks the property as required in its parent
+func (b *PropertyBuilder) Required() *PropertyBuilder {
+	b.required = true
+	return b
+}
+
+// Nullable also allows null values. It has no effect on properties without
+// a type, such as references.
+func (b *PropertyBuilder) Nullable() *PropertyBuilder {
+	types := propertyTypes(b.p.Type)
+	if len(types) == 0 {
+		return b
+	}
+	for _, t := range types {
+		if t == "null" {
+			return b
+		}
+	}
+	list := make([]interface{}, 0, len(types)+1)
+	for _, t := range types {
+		list = append(list, t)
+	}
+	b.p.Type = append(list, "null")
+	return b
+}
+
+// Description sets the description of the property
+func (b *PropertyBuilder) Description(description string) *PropertyBuilder {
+	b.p.Description = description
+	return b
+}
+
+// Enum restricts the property to the given values
+func (b *PropertyBuilder) Enum(values ...string) *PropertyBuilder {
+	b.p.Enum = make([]*string, len(values))
+	for i := range values {
+		b.p.Enum[i] = &values[i]
+	}
+	return b
+}
+
+// Pattern sets the regular expression string values must match
+func (b *PropertyBuilder) Pattern(pattern string) *PropertyBuilder {
+	b.p.Pattern = &pattern
+	return b
+}
+
+// Format sets the format of string values, e.g. "email"
+func (b *PropertyBuilder) Format(format string) *PropertyBuilder {
+	b.p.Format = &format
+	return b
+}
+
+// Min sets the inclusive minimum of numeric values
+func (b *PropertyBuilder) Min(min float64) *PropertyBuilder {
+	b.p.Minimum = &min
+	return b
+}
+
+// Max sets the inclusive maximum of numeric values
+func (b *PropertyBuilder) Max(max float64) *PropertyBuilder {
+	b.p.Maximum = &max
+	return b
+}
+
+// MinLength sets the minimum length of string values
+func (b *PropertyBuilder) MinLength(n int) *PropertyBuilder {
+	b.p.MinLength = &n
+	return b
+}
+
+// MaxLength sets the maximum length of string values
+func (b *PropertyBuilder) MaxLength(n int) *PropertyBuilder {
+	b.p.MaxLength = &n
+	return b
+}
+
+// MinItems sets the minimum number of items of array values
+func (b *PropertyBuilder) MinItems(n int) *PropertyBuilder {
+	b.p.MinItems = &n
+	return b
+}
+
+// Property adds a property to an object property. Like the other Property
+// methods, adding a property twice is an error.
+func (b *PropertyBuilder) Property(name string, p *PropertyBuilder) *PropertyBuilder {
+	if _, ok := b.p.Properties[name]; ok {
+		b.setErr(errors.Errorf("property %s is added more than once", name))
+		return b
+	}
+	if p.err != nil {
+		b.setErr(errors.Wrapf(p.err, "property %s", name))
+		return b
+	}
+	if b.p.Properties == nil {
+		b.p.Properties = map[string]Property{}
+	}
+	b.p.Properties[name] = p.Build()
+	if p.required {
+		b.p.Required = append(b.p.Required, name)
+	}
+	return b
+}
+
+func (b *PropertyBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// AdditionalProperties sets whether an object property accepts properties
+// that were not added with Property
+func (b *PropertyBuilder) AdditionalProperties(allowed bool) *PropertyBuilder {
+	b.p.AdditionalProperties = allowed
+	return b
+}
+
+// Build returns the property
+func (b *PropertyBuilder) Build() Property {
+	return b.p
+}
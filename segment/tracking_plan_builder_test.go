@@ -0,0 +1,130 @@
+package segment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackingPlanBuilder_Build(t *testing.T) {
+	tp, err := NewTrackingPlan("Shop").
+		Global().
+		Context("app", Object().Property("version", String().Required())).
+		Identify().
+		Trait("email", String().Format("email").Required()).
+		Event("Order Completed").
+		Description("An order was completed").
+		Property("order_id", String().Description("id of the order").Required()).
+		Property("total", Number().Min(0)).
+		Property("coupon", String().Nullable()).
+		Property("products", Array(Object().Property("sku", String().Pattern("^[A-Z]+$").Required())).MinItems(1)).
+		Event("Order Completed").
+		Version(2).
+		Property("placed_at", DateTime().Required()).
+		Build()
+	assert.NoError(t, err)
+
+	min, minItems, version := 0.0, 1, 2
+	assert.Equal(t, TrackingPlan{
+		DisplayName: "Shop",
+		Rules: RuleSet{
+			Global: Rules{Schema: string(Draft07), Type: "object", Properties: RuleProperties{
+				Context: Properties{Type: "object", Properties: map[string]Property{
+					"app": {Type: "object", Properties: map[string]Property{"version": {Type: "string"}}, Required: []string{"version"}},
+				}},
+			}},
+			Identify: Rules{Schema: string(Draft07), Type: "object", Properties: RuleProperties{
+				Traits: Properties{Type: "object", Required: []string{"email"}, Properties: map[string]Property{
+					"email": {Type: "string", Format: newString("email")},
+				}},
+			}},
+			Events: []Event{
+				{
+					Name:        "Order Completed",
+					Description: "An order was completed",
+					Rules: Rules{Schema: string(Draft07), Type: "object", Properties: RuleProperties{
+						Properties: Properties{Type: "object", Required: []string{"order_id"}, Properties: map[string]Property{
+							"order_id": {Type: "string", Description: "id of the order"},
+							"total":    {Type: "number", Minimum: &min},
+							"coupon":   {Type: []interface{}{"string", "null"}},
+							"products": {Type: "array", MinItems: &minItems, Items: &Property{
+								Type:       "object",
+								Properties: map[string]Property{"sku": {Type: "string", Pattern: newString("^[A-Z]+$")}},
+								Required:   []string{"sku"},
+							}},
+						}},
+					}},
+				},
+				{
+					Name:    "Order Completed",
+					Version: &version,
+					Rules: Rules{Schema: string(Draft07), Type: "object", Properties: RuleProperties{
+						Properties: Properties{Type: "object", Required: []string{"placed_at"}, Properties: map[string]Property{
+							"placed_at": {Type: "string", Format: newString("date-time")},
+						}},
+					}},
+				},
+			},
+		},
+	}, tp)
+	assert.Empty(t, LintTrackingPlan(tp, LintRule{Name: LintRulePropertyType, Severity: LintError, Check: lintPropertyTypes}))
+}
+
+func TestTrackingPlanBuilder_Library(t *testing.T) {
+	tp, err := NewTrackingPlan("Shop").
+		Library(testPropertyLibrary()).
+		Event("Order Completed").
+		Property("order_id", Ref("order_id").Required()).
+		Build()
+	assert.NoError(t, err)
+	props := tp.Rules.Events[0].Rules.Properties.Properties
+	assert.Equal(t, Property{Type: "string", Description: "id of the order"}, props.Properties["order_id"])
+	assert.Equal(t, []string{"order_id"}, props.Required)
+
+	_, err = NewTrackingPlan("Shop").Event("Order Completed").Property("order_id", Ref("order_id")).Build()
+	assert.EqualError(t, err, `event Order Completed@1: properties.order_id: undefined property "order_id"`)
+}
+
+func TestTrackingPlanBuilder_Errors(t *testing.T) {
+	_, err := NewTrackingPlan("Shop").
+		Event("Order Completed").
+		Property("total", Number()).
+		Property("total", Integer()).
+		Build()
+	assert.EqualError(t, err, "event Order Completed@1: property properties.total is added more than once")
+
+	_, err = NewTrackingPlan("Shop").
+		Event("Order Completed").
+		Property("products", Array(Object().
+			Property("sku", String().Required()).
+			Property("sku", String()))).
+		Build()
+	assert.EqualError(t, err, "event Order Completed@1: property properties.products: items: property sku is added more than once")
+
+	_, err = NewTrackingPlan("Shop").
+		Global().
+		Context("app", Object().Property("version", String()).Property("version", Integer())).
+		Build()
+	assert.EqualError(t, err, "rules: property context.app: property version is added more than once")
+
+	_, err = NewTrackingPlan("Shop").Event("Signed Up").Event("Signed Up").Build()
+	assert.EqualError(t, err, "event Signed Up@1 is defined more than once")
+
+	_, err = NewTrackingPlan("Shop").Event("Signed Up").Property("plan", String().Pattern("(")).Build()
+	assert.Error(t, err)
+	assert.IsType(t, &SchemaError{}, err)
+}
+
+func TestTrackingPlanBuilder_PropertyBuilder(t *testing.T) {
+	maxLength := 3
+	assert.Equal(t, Property{Type: "string", Enum: []*string{newString("USD"), newString("EUR")}, MaxLength: &maxLength},
+		String().Enum("USD", "EUR").MaxLength(3).Build())
+	assert.Equal(t, Property{Type: []interface{}{"integer", "null"}}, Integer().Nullable().Nullable().Build())
+	assert.Equal(t, Property{Type: "object", AdditionalProperties: false}, Object().AdditionalProperties(false).Build())
+	assert.Equal(t, Property{Ref: "#/definitions/a~1b"}, Ref("a/b").Nullable().Build())
+
+	// The first of two properties with the same name is kept, required or not
+	object := Object().Property("sku", String().Required()).Property("sku", Integer()).Build()
+	assert.Equal(t, []string{"sku"}, object.Required)
+	assert.Equal(t, "string", object.Properties["sku"].Type)
+}
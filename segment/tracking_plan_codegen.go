@@ -0,0 +1,391 @@
+package segment
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// GoCodegenOptions configures the code generated by GenerateGo
+type GoCodegenOptions struct {
+	// Package is the name of the generated package, "events" by default
+	Package string
+}
+
+// goInitialisms are the words written in upper case in Go identifiers
+var goInitialisms = map[string]bool{
+	"api": true, "id": true, "ids": true, "ip": true, "http": true, "https": true, "json": true,
+	"sku": true, "sms": true, "sql": true, "ui": true, "uri": true, "url": true, "utm": true, "uuid": true,
+}
+
+const goTrackType = `// Track is a Segment track call, ready to be encoded as JSON and sent to the
+// tracking API. Set UserID or AnonymousID before sending it.
+type Track struct {
+	Type        string                 ` + "`json:\"type\"`" + `
+	Event       string                 ` + "`json:\"event\"`" + `
+	UserID      string                 ` + "`json:\"userId,omitempty\"`" + `
+	AnonymousID string                 ` + "`json:\"anonymousId,omitempty\"`" + `
+	Properties  interface{}            ` + "`json:\"properties\"`" + `
+	Context     map[string]interface{} ` + "`json:\"context,omitempty\"`" + `
+}
+`
+
+// GenerateGo generates a Go source file with a struct per event of the
+// tracking plan and a constructor returning the Segment track call of the
+// event. Property types map to Go types, string enums to named types with a
+// constant per value, and optional or nullable properties to pointers.
+//
+// Nested types are named after their event and property path. When two of
+// them would get the same name, the one adding the shortest part to its
+// parent's name keeps it and the others get a suffix derived from their full
+// property path, so that adding or reordering events does not rename the
+// existing types. Event types clashing with other types get a number suffix.
+func GenerateGo(tp TrackingPlan, opts GoCodegenOptions) ([]byte, error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "events"
+	}
+
+	// A first pass collects the names the nested types would get, so that
+	// the names can be assigned independently of the order of the events.
+	g := &goGenerator{}
+	for _, e := range tp.Rules.Events {
+		base := eventTypeName(e)
+		g.event(e, base, "New"+base)
+	}
+	g.resolve()
+
+	types := make([]string, len(tp.Rules.Events))
+	constructors := make([]string, len(tp.Rules.Events))
+	for i, e := range tp.Rules.Events {
+		base := eventTypeName(e)
+		types[i] = g.unique(base)
+		constructors[i] = g.unique("New" + base)
+	}
+
+	g.decls, g.usesTime = nil, false
+	for i, e := range tp.Rules.Events {
+		g.event(e, types[i], constructors[i])
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by segment-config-go from tracking plan %q. DO NOT EDIT.\n\n", tp.DisplayName)
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if g.usesTime {
+		buf.WriteString("import \"time\"\n\n")
+	}
+	buf.WriteString(goTrackType)
+	for _, decl := range g.decls {
+		buf.WriteString("\n")
+		buf.WriteString(decl)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "formatting generated code failed")
+	}
+	return src, nil
+}
+
+type goGenerator struct {
+	decls    []string
+	usesTime bool
+	// claims are the names wanted by the nested types, collected until
+	// resolve assigns them to names by property path
+	claims []nameClaim
+	names  map[string]string
+	taken  map[string]bool
+}
+
+// nameClaim is the name wanted by the type of the property at path, with own
+// the part it adds to the name of its parent.
+type nameClaim struct {
+	name, own, path string
+}
+
+// name returns the identifier of the nested type of the property at path,
+// wanting name. Before resolve, the claim is recorded and name returned.
+func (g *goGenerator) name(name, own, path string) string {
+	if g.names == nil {
+		g.claims = append(g.claims, nameClaim{name: name, own: own, path: path})
+		return name
+	}
+	return g.names[path]
+}
+
+// resolve assigns the claimed names. Of the claims to the same name, the one
+// with the shortest own part wins, then the one with the first path; the
+// others get a suffix hashed from their path.
+func (g *goGenerator) resolve() {
+	sort.Slice(g.claims, func(i, j int) bool {
+		a, b := g.claims[i], g.claims[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.own) != len(b.own) {
+			return len(a.own) < len(b.own)
+		}
+		return a.path < b.path
+	})
+
+	g.names = map[string]string{}
+	g.taken = map[string]bool{"Track": true}
+	for i, c := range g.claims {
+		name := c.name
+		if (i > 0 && g.claims[i-1].name == c.name) || g.taken[name] {
+			name += pathSuffix(c.path)
+		}
+		g.names[c.path] = name
+		g.taken[name] = true
+	}
+}
+
+// unique returns a top level identifier based on name that is not taken yet.
+func (g *goGenerator) unique(name string) string {
+	unique := name
+	for i := 2; g.taken[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	g.taken[unique] = true
+	return unique
+}
+
+// pathSuffix returns the hash of a property path as an identifier suffix.
+func pathSuffix(path string) string {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return fmt.Sprintf("%08X", h.Sum32())
+}
+
+// eventTypeName returns the name of the type of e before clashes are
+// resolved, e.g. "OrderCompletedV2".
+func eventTypeName(e Event) string {
+	name := goName(e.Name, "Event")
+	if v := eventVersion(e); v > 1 {
+		name = fmt.Sprintf("%sV%d", name, v)
+	}
+	return name
+}
+
+// eventPath returns the root of the property paths of e, e.g.
+// "Order Completed@2".
+func eventPath(e Event) string {
+	if v := eventVersion(e); v > 1 {
+		return fmt.Sprintf("%s@%d", e.Name, v)
+	}
+	return e.Name
+}
+
+// reserve adds a placeholder declaration, so that the types of a struct are
+// written after the struct itself.
+func (g *goGenerator) reserve() int {
+	g.decls = append(g.decls, "")
+	return len(g.decls) - 1
+}
+
+func (g *goGenerator) event(e Event, typeName, constructor string) {
+	props := e.Rules.Properties.Properties
+	doc := fmt.Sprintf("%s holds the properties of the %q event", typeName, e.Name)
+	if e.Description != "" {
+		doc += "\n\n" + e.Description
+	}
+	g.structType(typeName, eventTypeName(e), eventPath(e), doc, Property{Properties: props.Properties, Required: props.Required})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s returns the track call of the %q event\n", constructor, e.Name)
+	fmt.Fprintf(&b, "func %s(properties %s) Track {\n", constructor, typeName)
+	fmt.Fprintf(&b, "return Track{\nType: \"track\",\nEvent: %q,\nProperties: properties,\n", e.Name)
+	if v := eventVersion(e); v > 1 {
+		fmt.Fprintf(&b, "Context: map[string]interface{}{\"protocols\": map[string]interface{}{\"event_version\": %d}},\n", v)
+	}
+	b.WriteString("}\n}\n")
+	g.decls = append(g.decls, b.String())
+}
+
+// structType declares the struct name for p, the property at path. The
+// nested types are named after natural, the name of the struct before
+// clashes are resolved.
+func (g *goGenerator) structType(name, natural, path, doc string, p Property) {
+	slot := g.reserve()
+
+	required := stringSet(p.Required)
+	fields := map[string]bool{}
+	var b strings.Builder
+	writeGoComment(&b, doc, "")
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	for _, prop := range propertyNames(p.Properties) {
+		field := goName(prop, "Field")
+		for i := 2; fields[field]; i++ {
+			field = fmt.Sprintf("%s%d", goName(prop, "Field"), i)
+		}
+		fields[field] = true
+
+		schema := p.Properties[prop]
+		typ := g.fieldType(natural+field, field, path+"."+prop, prop, schema, required[prop])
+		tag := prop
+		if !required[prop] {
+			tag += ",omitempty"
+		}
+		writeGoComment(&b, schema.Description, "\t")
+		fmt.Fprintf(&b, "\t%s %s `json:%q`\n", field, typ, tag)
+	}
+	b.WriteString("}\n")
+
+	g.decls[slot] = b.String()
+}
+
+// fieldType returns the Go type of the property prop at path, declaring the
+// struct and enum types it needs under names derived from typeName, which
+// adds own to the name of the parent type.
+func (g *goGenerator) fieldType(typeName, own, path, prop string, p Property, required bool) string {
+	var types []string
+	nullable := false
+	for _, t := range propertyTypes(p.Type) {
+		if t == "null" {
+			nullable = true
+		} else {
+			types = append(types, t)
+		}
+	}
+	if len(types) != 1 {
+		return "interface{}"
+	}
+
+	var typ string
+	switch types[0] {
+	case "string":
+		switch {
+		case len(p.Enum) > 0:
+			typ = g.enumType(typeName, own, path, prop, p)
+		case p.Format != nil && *p.Format == "date-time":
+			g.usesTime = true
+			typ = "time.Time"
+		default:
+			typ = "string"
+		}
+	case "integer":
+		typ = "int64"
+	case "number":
+		typ = "float64"
+	case "boolean":
+		typ = "bool"
+	case "object":
+		if len(p.Properties) == 0 {
+			return "map[string]interface{}"
+		}
+		typ = g.name(typeName, own, path)
+		g.structType(typ, typeName, path, fmt.Sprintf("%s is the value of the %s property", typ, prop), p)
+	case "array":
+		if p.Items == nil {
+			return "[]interface{}"
+		}
+		return "[]" + g.fieldType(typeName+"Item", "Item", path+"[]", prop, *p.Items, true)
+	default:
+		return "interface{}"
+	}
+
+	if !required || nullable {
+		return "*" + typ
+	}
+	return typ
+}
+
+// enumType declares a string type with a constant per non-null enum value.
+func (g *goGenerator) enumType(typeName, own, path, prop string, p Property) string {
+	name := g.name(typeName, own, path)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s is an allowed value of the %s property\n", name, prop)
+	fmt.Fprintf(&b, "type %s string\n\n", name)
+	b.WriteString("const (\n")
+	for _, v := range p.Enum {
+		if v == nil {
+			continue
+		}
+		value := goName(*v, "Empty")
+		fmt.Fprintf(&b, "%s %s = %q\n", g.name(typeName+value, value, path+"="+*v), name, *v)
+	}
+	b.WriteString(")\n")
+	g.decls = append(g.decls, b.String())
+	return name
+}
+
+// goName converts a tracking plan name such as "Order Completed" or
+// "product_id" into an exported Go identifier, e.g. "OrderCompleted" or
+// "ProductID". fallback is used when name has no letters or digits.
+func goName(name, fallback string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+	var prev rune
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+		prev = r
+	}
+	flush()
+
+	var b strings.Builder
+	for _, w := range words {
+		lower := strings.ToLower(w)
+		if goInitialisms[lower] {
+			b.WriteString(strings.ToUpper(lower))
+			continue
+		}
+		runes := []rune(w)
+		b.WriteRune(unicode.ToUpper(runes[0]))
+		b.WriteString(string(runes[1:]))
+	}
+
+	id := b.String()
+	if id == "" {
+		return fallback
+	}
+	if unicode.IsDigit([]rune(id)[0]) {
+		return fallback + id
+	}
+	return id
+}
+
+// propertyNames returns the names of props, sorted.
+func propertyNames(props map[string]Property) []string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeGoComment writes text as a line comment with the given indent.
+func writeGoComment(b *strings.Builder, text, indent string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			fmt.Fprintf(b, "%s//\n", indent)
+		} else {
+			fmt.Fprintf(b, "%s// %s\n", indent, line)
+		}
+	}
+}
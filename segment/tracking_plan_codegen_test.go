@@ -0,0 +1,120 @@
+package segment
+
+import (
+	"go/parser"
+	"go/token"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodegen_GenerateGo(t *testing.T) {
+	src, err := GenerateGo(testTrackingPlan(t), GoCodegenOptions{Package: "tracking"})
+	assert.NoError(t, err)
+
+	_, err = parser.ParseFile(token.NewFileSet(), "events.go", src, parser.ParseComments)
+	assert.NoError(t, err)
+
+	code := string(src)
+	assert.Contains(t, code, `// Code generated by segment-config-go from tracking plan "Test Tracking Plan". DO NOT EDIT.`)
+	assert.Contains(t, code, "package tracking\n")
+	assert.Contains(t, code, "import \"time\"\n")
+	assert.Contains(t, code, "// TestEventClicked holds the properties of the \"Test Event Clicked\" event\n//\n// A simple test event\ntype TestEventClicked struct {")
+	assert.Contains(t, code, "\t// unique id of the user\n\tUserID string `json:\"user_id\"`")
+	assert.Contains(t, code, "TestProp *int64 `json:\"test_prop,omitempty\"`")
+	assert.Contains(t, code, "Created *time.Time `json:\"created,omitempty\"`")
+	assert.Contains(t, code, "ArrayProp []string `json:\"array_prop,omitempty\"`")
+	assert.Contains(t, code, "PropObjNested TestEventClickedPropObjPropObjNested `json:\"prop_obj_nested\"`")
+	assert.Contains(t, collapseSpaces(code), "PropStr *string `json:\"prop_str\"`")
+	assert.Contains(t, code, "TestEventClickedEnumPropFoo TestEventClickedEnumProp = \"foo\"")
+	assert.NotContains(t, code, "Null")
+	assert.Contains(t, code, "func NewTestEventClicked(properties TestEventClicked) Track {")
+	assert.NotContains(t, code, "event_version")
+}
+
+func TestCodegen_VersionsAndNameClashes(t *testing.T) {
+	v2 := 2
+	tp := TrackingPlan{DisplayName: "Plan"}
+	tp.Rules.Events = []Event{
+		{Name: "order_completed"},
+		{Name: "Order Completed"},
+		{Name: "Order Completed", Version: &v2, Rules: Rules{Properties: RuleProperties{Properties: Properties{
+			Properties: map[string]Property{
+				"userId":  {Type: "string"},
+				"user_id": {Type: "string"},
+				"tags":    {Type: "array"},
+				"extra":   {Type: "object"},
+				"any":     {Type: []interface{}{"string", "number"}},
+			},
+		}}}},
+	}
+
+	src, err := GenerateGo(tp, GoCodegenOptions{})
+	assert.NoError(t, err)
+
+	code := collapseSpaces(string(src))
+	assert.Contains(t, code, "package events\n")
+	assert.NotContains(t, code, "import")
+	assert.Contains(t, code, "type OrderCompleted struct {")
+	assert.Contains(t, code, "type OrderCompleted2 struct {")
+	assert.Contains(t, code, "func NewOrderCompleted2(properties OrderCompleted2) Track {")
+	assert.Contains(t, code, "type OrderCompletedV2 struct {")
+	assert.Contains(t, code, `Context: map[string]interface{}{"protocols": map[string]interface{}{"event_version": 2}},`)
+	assert.Contains(t, code, "UserID *string `json:\"userId,omitempty\"`")
+	assert.Contains(t, code, "UserID2 *string `json:\"user_id,omitempty\"`")
+	assert.Contains(t, code, "Tags []interface{} `json:\"tags,omitempty\"`")
+	assert.Contains(t, code, "Extra map[string]interface{} `json:\"extra,omitempty\"`")
+	assert.Contains(t, code, "Any interface{} `json:\"any,omitempty\"`")
+}
+
+func TestCodegen_NestedNamesAreStable(t *testing.T) {
+	status := Property{Type: "string", Enum: []*string{newString("paid")}}
+	orderCompleted := Event{Name: "Order Completed", Rules: Rules{Properties: RuleProperties{Properties: Properties{
+		Properties: map[string]Property{"status": status},
+	}}}}
+	order := Event{Name: "Order", Rules: Rules{Properties: RuleProperties{Properties: Properties{
+		Properties: map[string]Property{"completed_status": status},
+	}}}}
+	orderCompletedStatus := Event{Name: "Order Completed Status"}
+
+	generate := func(events ...Event) string {
+		tp := TrackingPlan{DisplayName: "Plan"}
+		tp.Rules.Events = events
+		src, err := GenerateGo(tp, GoCodegenOptions{})
+		assert.NoError(t, err)
+		return collapseSpaces(string(src))
+	}
+
+	code := generate(orderCompleted)
+	assert.Contains(t, code, "Status *OrderCompletedStatus `json:\"status,omitempty\"`")
+	assert.Contains(t, code, "OrderCompletedStatusPaid OrderCompletedStatus = \"paid\"")
+
+	suffix := pathSuffix("Order.completed_status")
+	for _, events := range [][]Event{
+		{order, orderCompleted, orderCompletedStatus},
+		{orderCompletedStatus, orderCompleted, order},
+	} {
+		code := generate(events...)
+		assert.Contains(t, code, "Status *OrderCompletedStatus `json:\"status,omitempty\"`")
+		assert.Contains(t, code, "OrderCompletedStatusPaid OrderCompletedStatus = \"paid\"")
+		assert.Contains(t, code, "CompletedStatus *OrderCompletedStatus"+suffix+" `json:\"completed_status,omitempty\"`")
+		assert.Contains(t, code, "OrderCompletedStatusPaid"+pathSuffix("Order.completed_status=paid")+" OrderCompletedStatus"+suffix+" = \"paid\"")
+		assert.Contains(t, code, "type OrderCompletedStatus2 struct {")
+		assert.Contains(t, code, "func NewOrderCompletedStatus(properties OrderCompletedStatus2) Track {")
+	}
+}
+
+func TestCodegen_GoName(t *testing.T) {
+	assert.Equal(t, "OrderCompleted", goName("Order Completed", "Event"))
+	assert.Equal(t, "ProductID", goName("product_id", "Field"))
+	assert.Equal(t, "UserID", goName("userId", "Field"))
+	assert.Equal(t, "HTTPStatus", goName("HTTPStatus", "Field"))
+	assert.Equal(t, "Field3dSecure", goName("3d-secure", "Field"))
+	assert.Equal(t, "Empty", goName("", "Empty"))
+}
+
+// collapseSpaces removes the alignment gofmt adds between struct fields.
+func collapseSpaces(code string) string {
+	return regexp.MustCompile(` +`).ReplaceAllString(code, " ")
+}
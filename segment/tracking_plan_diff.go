@@ -0,0 +1,495 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TrackingPlanChangeType is the kind of a change between two tracking plans
+type TrackingPlanChangeType string
+
+// Types of changes reported by DiffTrackingPlans
+const (
+	EventAdded         TrackingPlanChangeType = "event_added"
+	EventRemoved       TrackingPlanChangeType = "event_removed"
+	EventRenamed       TrackingPlanChangeType = "event_renamed"
+	DescriptionChanged TrackingPlanChangeType = "description_changed"
+	PropertyAdded      TrackingPlanChangeType = "property_added"
+	PropertyRemoved    TrackingPlanChangeType = "property_removed"
+	TypeChanged        TrackingPlanChangeType = "type_changed"
+	RequiredAdded      TrackingPlanChangeType = "required_added"
+	RequiredRemoved    TrackingPlanChangeType = "required_removed"
+	EnumValueAdded     TrackingPlanChangeType = "enum_value_added"
+	EnumValueRemoved   TrackingPlanChangeType = "enum_value_removed"
+
+	// ConstraintChanged covers the other schema keywords: enum being added or
+	// dropped altogether, pattern, format, items, the numeric and length
+	// bounds, allOf, anyOf, oneOf, $ref, const and unknown keywords.
+	ConstraintChanged TrackingPlanChangeType = "constraint_changed"
+)
+
+// Sections of a RuleSet reported in TrackingPlanChange.Section
+const (
+	SectionGlobal   = "global"
+	SectionIdentify = "identify"
+	SectionGroup    = "group"
+	SectionEvent    = "event"
+)
+
+// TrackingPlanChange is a single semantic difference between two tracking plans.
+//
+// Breaking is set when the change can break downstream consumers of the
+// data: anything that removes or renames data, makes it optional, or widens
+// the set of values a consumer may receive (new types, new enum values,
+// dropped patterns). Additions and restrictions are non-breaking, except for
+// requiring a whole section such as "context" in the rules, since events
+// without it start failing validation.
+type TrackingPlanChange struct {
+	Type    TrackingPlanChangeType `json:"type"`
+	Section string                 `json:"section"`
+	// Event and Version identify the event for changes in the event section
+	Event   string `json:"event,omitempty"`
+	Version int    `json:"version,omitempty"`
+	// Path is the dotted path of the property, e.g. "properties.product.sku",
+	// or of the keyword for constraint changes, e.g. "properties.sku.pattern".
+	// It is empty for changes of the type of the rules themselves.
+	Path     string      `json:"path,omitempty"`
+	Old      interface{} `json:"old,omitempty"`
+	New      interface{} `json:"new,omitempty"`
+	Breaking bool        `json:"breaking"`
+}
+
+func (c TrackingPlanChange) String() string {
+	var b strings.Builder
+	if c.Breaking {
+		b.WriteString("[breaking] ")
+	}
+	if c.Section == SectionEvent {
+		fmt.Fprintf(&b, "event %q", c.Event)
+		if c.Version > 1 {
+			fmt.Fprintf(&b, " (v%d)", c.Version)
+		}
+	} else {
+		fmt.Fprintf(&b, "%s rules", c.Section)
+	}
+
+	switch c.Type {
+	case EventAdded:
+		b.WriteString(" added")
+	case EventRemoved:
+		b.WriteString(" removed")
+	case EventRenamed:
+		fmt.Fprintf(&b, " renamed to %q", c.New)
+	case DescriptionChanged:
+		if c.Path == "" {
+			fmt.Fprintf(&b, ": description changed from %q to %q", c.Old, c.New)
+		} else {
+			fmt.Fprintf(&b, ": description of %s changed from %q to %q", c.Path, c.Old, c.New)
+		}
+	case PropertyAdded:
+		fmt.Fprintf(&b, ": property %s added", c.Path)
+	case PropertyRemoved:
+		fmt.Fprintf(&b, ": property %s removed", c.Path)
+	case TypeChanged:
+		if c.Path == "" {
+			fmt.Fprintf(&b, ": type changed from %v to %v", c.Old, c.New)
+		} else {
+			fmt.Fprintf(&b, ": type of %s changed from %v to %v", c.Path, c.Old, c.New)
+		}
+	case RequiredAdded:
+		fmt.Fprintf(&b, ": property %s is now required", c.Path)
+	case RequiredRemoved:
+		fmt.Fprintf(&b, ": property %s is no longer required", c.Path)
+	case EnumValueAdded:
+		fmt.Fprintf(&b, ": enum value %v added to %s", c.New, c.Path)
+	case EnumValueRemoved:
+		fmt.Fprintf(&b, ": enum value %v removed from %s", c.Old, c.Path)
+	default:
+		fmt.Fprintf(&b, ": %s changed from %v to %v", c.Path, c.Old, c.New)
+	}
+	return b.String()
+}
+
+// TrackingPlanDiff lists the changes between two tracking plans
+type TrackingPlanDiff struct {
+	Changes []TrackingPlanChange `json:"changes"`
+}
+
+// HasBreakingChanges reports whether any of the changes is breaking
+func (d TrackingPlanDiff) HasBreakingChanges() bool {
+	return len(d.Breaking()) > 0
+}
+
+// Breaking returns the breaking changes of the diff
+func (d TrackingPlanDiff) Breaking() []TrackingPlanChange {
+	var changes []TrackingPlanChange
+	for _, c := range d.Changes {
+		if c.Breaking {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// DiffTrackingPlans reports the semantic changes needed to go from tracking
+// plan a to tracking plan b. Events are matched by name and version; a
+// removed event whose rules are identical to an added one is reported as a
+// rename.
+func DiffTrackingPlans(a, b TrackingPlan) TrackingPlanDiff {
+	d := &trackingPlanDiffer{}
+	d.section = SectionGlobal
+	d.rules(a.Rules.Global, b.Rules.Global)
+	d.section = SectionIdentify
+	d.rules(a.Rules.Identify, b.Rules.Identify)
+	d.section = SectionGroup
+	d.rules(a.Rules.Group, b.Rules.Group)
+	d.section = SectionEvent
+	d.events(a.Rules.Events, b.Rules.Events)
+	return TrackingPlanDiff{Changes: d.changes}
+}
+
+type trackingPlanDiffer struct {
+	section string
+	event   Event
+	changes []TrackingPlanChange
+}
+
+func (d *trackingPlanDiffer) add(t TrackingPlanChangeType, path string, old, new interface{}, breaking bool) {
+	c := TrackingPlanChange{Type: t, Section: d.section, Path: path, Old: old, New: new, Breaking: breaking}
+	if d.section == SectionEvent {
+		c.Event = d.event.Name
+		c.Version = eventVersion(d.event)
+	}
+	d.changes = append(d.changes, c)
+}
+
+// eventVersion returns the version of an event, which defaults to 1.
+func eventVersion(e Event) int {
+	if e.Version == nil {
+		return 1
+	}
+	return *e.Version
+}
+
+func eventKey(e Event) string {
+	return fmt.Sprintf("%s@%d", e.Name, eventVersion(e))
+}
+
+func (d *trackingPlanDiffer) events(a, b []Event) {
+	inB := map[string]Event{}
+	for _, e := range b {
+		inB[eventKey(e)] = e
+	}
+	inA := map[string]bool{}
+	var removed []Event
+	for _, e := range a {
+		inA[eventKey(e)] = true
+		other, ok := inB[eventKey(e)]
+		if !ok {
+			removed = append(removed, e)
+			continue
+		}
+		d.event = e
+		if e.Description != other.Description {
+			d.add(DescriptionChanged, "", e.Description, other.Description, false)
+		}
+		d.rules(e.Rules, other.Rules)
+	}
+	var added []Event
+	for _, e := range b {
+		if !inA[eventKey(e)] {
+			added = append(added, e)
+		}
+	}
+
+	for _, e := range removed {
+		d.event = e
+		if i := findRenamedEvent(e, added); i >= 0 {
+			renamed := added[i]
+			added = append(added[:i], added[i+1:]...)
+			d.add(EventRenamed, "", e.Name, renamed.Name, true)
+			if e.Description != renamed.Description {
+				d.add(DescriptionChanged, "", e.Description, renamed.Description, false)
+			}
+			continue
+		}
+		d.add(EventRemoved, "", e.Name, nil, true)
+	}
+	for _, e := range added {
+		d.event = e
+		d.add(EventAdded, "", nil, e.Name, false)
+	}
+}
+
+// findRenamedEvent returns the index of the event in candidates with the same
+// version and rules as e, or -1. Events without rules are never considered
+// renamed since any two of them would match.
+func findRenamedEvent(e Event, candidates []Event) int {
+	if reflect.DeepEqual(e.Rules, Rules{}) {
+		return -1
+	}
+	for i, c := range candidates {
+		if eventVersion(c) == eventVersion(e) && reflect.DeepEqual(c.Rules, e.Rules) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *trackingPlanDiffer) rules(a, b Rules) {
+	aTypes, bTypes := propertyTypes(a.Type), propertyTypes(b.Type)
+	if !reflect.DeepEqual(aTypes, bTypes) {
+		d.add(TypeChanged, "", a.Type, b.Type, !isSubset(bTypes, aTypes))
+	}
+	d.required("", a.Required, b.Required, true)
+	d.object("context", a.Properties.Context.Properties, b.Properties.Context.Properties, a.Properties.Context.Required, b.Properties.Context.Required)
+	d.object("properties", a.Properties.Properties.Properties, b.Properties.Properties.Properties, a.Properties.Properties.Required, b.Properties.Properties.Required)
+	d.object("traits", a.Properties.Traits.Properties, b.Properties.Traits.Properties, a.Properties.Traits.Required, b.Properties.Traits.Required)
+}
+
+func (d *trackingPlanDiffer) object(path string, a, b map[string]Property, aRequired, bRequired []string) {
+	names := map[string]bool{}
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+	for _, name := range sortedNames(names) {
+		pa, inA := a[name]
+		pb, inB := b[name]
+		switch {
+		case !inB:
+			d.add(PropertyRemoved, path+"."+name, pa, nil, true)
+		case !inA:
+			d.add(PropertyAdded, path+"."+name, nil, pb, false)
+		default:
+			d.property(path+"."+name, pa, pb)
+		}
+	}
+
+	d.required(path, aRequired, bRequired, false)
+}
+
+// required reports the properties of path that became required or optional.
+// Making a property optional is breaking, and so is making one required when
+// addBreaks is set.
+func (d *trackingPlanDiffer) required(path string, aRequired, bRequired []string, addBreaks bool) {
+	wasRequired := stringSet(aRequired)
+	isRequired := stringSet(bRequired)
+	for _, name := range sortedNames(isRequired) {
+		if !wasRequired[name] {
+			d.add(RequiredAdded, joinField(path, name), nil, name, addBreaks)
+		}
+	}
+	for _, name := range sortedNames(wasRequired) {
+		if !isRequired[name] {
+			d.add(RequiredRemoved, joinField(path, name), name, nil, true)
+		}
+	}
+}
+
+func (d *trackingPlanDiffer) property(path string, a, b Property) {
+	if a.Description != b.Description {
+		d.add(DescriptionChanged, path, a.Description, b.Description, false)
+	}
+
+	aTypes, bTypes := propertyTypes(a.Type), propertyTypes(b.Type)
+	if !reflect.DeepEqual(aTypes, bTypes) {
+		// Narrowing the types is safe for consumers, who already handle them.
+		d.add(TypeChanged, path, a.Type, b.Type, !isSubset(bTypes, aTypes))
+	}
+
+	d.enum(path, a.Enum, b.Enum)
+	d.constraint(path+".pattern", a.Pattern, b.Pattern)
+	d.constraint(path+".format", a.Format, b.Format)
+	d.keywords(path, a, b)
+
+	switch {
+	case a.Items != nil && b.Items != nil:
+		d.property(path+"[]", *a.Items, *b.Items)
+	case a.Items != nil:
+		d.add(ConstraintChanged, path+".items", a.Items, nil, true)
+	case b.Items != nil:
+		d.add(ConstraintChanged, path+".items", nil, b.Items, false)
+	}
+
+	d.object(path, a.Properties, b.Properties, a.Required, b.Required)
+}
+
+func (d *trackingPlanDiffer) enum(path string, a, b []*string) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		d.add(ConstraintChanged, path+".enum", nil, enumValues(b), false)
+		return
+	case b == nil:
+		d.add(ConstraintChanged, path+".enum", enumValues(a), nil, true)
+		return
+	}
+
+	aValues, bValues := stringSet(enumValues(a)), stringSet(enumValues(b))
+	for _, v := range enumValues(b) {
+		if !aValues[v] {
+			d.add(EnumValueAdded, path, nil, v, true)
+		}
+	}
+	for _, v := range enumValues(a) {
+		if !bValues[v] {
+			d.add(EnumValueRemoved, path, v, nil, false)
+		}
+	}
+}
+
+// constraint reports changes of a string keyword. Adding one restricts the
+// values and is safe; dropping or changing one may let new values through.
+func (d *trackingPlanDiffer) constraint(path string, a, b *string) {
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		d.add(ConstraintChanged, path, nil, *b, false)
+	case b == nil:
+		d.add(ConstraintChanged, path, *a, nil, true)
+	case *a != *b:
+		d.add(ConstraintChanged, path, *a, *b, true)
+	}
+}
+
+// keywords reports changes of the numeric, length, combinator, $ref and
+// const keywords and of the keywords kept in Extra, with the same breaking
+// rules as constraint.
+func (d *trackingPlanDiffer) keywords(path string, a, b Property) {
+	d.keyword(path+".minimum", a.Minimum, b.Minimum)
+	d.keyword(path+".maximum", a.Maximum, b.Maximum)
+	d.keyword(path+".exclusiveMinimum", a.ExclusiveMinimum, b.ExclusiveMinimum)
+	d.keyword(path+".exclusiveMaximum", a.ExclusiveMaximum, b.ExclusiveMaximum)
+	d.keyword(path+".minLength", a.MinLength, b.MinLength)
+	d.keyword(path+".maxLength", a.MaxLength, b.MaxLength)
+	d.keyword(path+".allOf", a.AllOf, b.AllOf)
+	d.keyword(path+".anyOf", a.AnyOf, b.AnyOf)
+	d.keyword(path+".oneOf", a.OneOf, b.OneOf)
+	d.keyword(path+".$ref", a.Ref, b.Ref)
+	d.keyword(path+".const", a.Const, b.Const)
+
+	names := map[string]bool{}
+	for name := range a.Extra {
+		names[name] = true
+	}
+	for name := range b.Extra {
+		names[name] = true
+	}
+	for _, name := range sortedNames(names) {
+		// Indexing a nil map gives a nil RawMessage, which is not set.
+		d.keyword(path+"."+name, a.Extra[name], b.Extra[name])
+	}
+}
+
+func (d *trackingPlanDiffer) keyword(path string, a, b interface{}) {
+	aSet, bSet := keywordSet(a), keywordSet(b)
+	aValue, bValue := keywordValue(a), keywordValue(b)
+	switch {
+	case !aSet && !bSet:
+	case !aSet:
+		d.add(ConstraintChanged, path, nil, bValue, false)
+	case !bSet:
+		d.add(ConstraintChanged, path, aValue, nil, true)
+	case !reflect.DeepEqual(aValue, bValue):
+		d.add(ConstraintChanged, path, aValue, bValue, true)
+	}
+}
+
+// keywordSet reports whether a keyword value would be encoded, i.e. it is
+// not nil or empty.
+func keywordSet(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		return !rv.IsNil()
+	case reflect.String:
+		return rv.Len() > 0
+	}
+	return true
+}
+
+// keywordValue returns a keyword value as decoded from JSON, so that pointers
+// and raw messages compare and print by value.
+func keywordValue(v interface{}) interface{} {
+	var value interface{}
+	if b, err := json.Marshal(v); err == nil {
+		_ = json.Unmarshal(b, &value)
+	}
+	return value
+}
+
+// propertyTypes returns the sorted list of JSON types allowed by the type
+// keyword, which may be a single type or a list of types.
+func propertyTypes(t interface{}) []string {
+	var types []string
+	switch t := t.(type) {
+	case string:
+		types = []string{t}
+	case []string:
+		types = append(types, t...)
+	case []interface{}:
+		for _, v := range t {
+			types = append(types, fmt.Sprint(v))
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// enumValues renders enum values as strings, with "null" for a nil value.
+func enumValues(enum []*string) []string {
+	values := make([]string, 0, len(enum))
+	for _, v := range enum {
+		if v == nil {
+			values = append(values, "null")
+		} else {
+			values = append(values, *v)
+		}
+	}
+	return values
+}
+
+// isSubset reports whether every element of a is in b. An empty list of
+// types allows anything, so it is only a subset of another empty list.
+func isSubset(a, b []string) bool {
+	if len(b) == 0 {
+		return true
+	}
+	if len(a) == 0 {
+		return false
+	}
+	set := stringSet(b)
+	for _, v := range a {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
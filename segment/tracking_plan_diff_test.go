@@ -0,0 +1,186 @@
+package segment
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func diffTestPlan() TrackingPlan {
+	return TrackingPlan{
+		DisplayName: "Test",
+		Rules: RuleSet{
+			Identify: Rules{Properties: RuleProperties{Traits: Properties{
+				Type:       "object",
+				Properties: map[string]Property{"email": {Type: "string", Format: newString("email")}},
+			}}},
+			Events: []Event{
+				{
+					Name:        "Order Completed",
+					Description: "An order was completed",
+					Rules: Rules{Properties: RuleProperties{Properties: Properties{
+						Type:     "object",
+						Required: []string{"order_id", "total"},
+						Properties: map[string]Property{
+							"order_id": {Type: "string", Description: "id of the order"},
+							"total":    {Type: "number"},
+							"currency": {Type: "string", Enum: []*string{newString("USD"), newString("EUR")}},
+							"products": {Type: "array", Items: &Property{
+								Type:       "object",
+								Properties: map[string]Property{"sku": {Type: "string", Pattern: newString("^[A-Z]+$")}},
+							}},
+						},
+					}}},
+				},
+				{Name: "Signed Up", Rules: Rules{Properties: RuleProperties{Properties: Properties{
+					Properties: map[string]Property{"plan": {Type: "string"}},
+				}}}},
+				{Name: "Logged Out"},
+			},
+		},
+	}
+}
+
+func TestDiffTrackingPlans_NoChanges(t *testing.T) {
+	diff := DiffTrackingPlans(diffTestPlan(), diffTestPlan())
+	assert.Empty(t, diff.Changes)
+	assert.False(t, diff.HasBreakingChanges())
+}
+
+func TestDiffTrackingPlans_Properties(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	order := b.Rules.Events[0].Rules.Properties.Properties
+	order.Required = []string{"order_id", "currency"}
+	order.Properties["order_id"] = Property{Type: "integer", Description: "numeric id of the order"}
+	order.Properties["total"] = Property{Type: []interface{}{"number"}}
+	order.Properties["currency"] = Property{Type: "string", Enum: []*string{newString("USD"), newString("GBP")}}
+	order.Properties["coupon"] = Property{Type: "string"}
+	order.Properties["products"] = Property{Type: "array", Items: &Property{Type: "object"}}
+	b.Rules.Events[0].Rules.Properties.Properties = order
+	b.Rules.Identify.Properties.Traits.Properties = map[string]Property{"email": {Type: []interface{}{"string", "null"}}}
+
+	diff := DiffTrackingPlans(a, b)
+	var messages []string
+	for _, c := range diff.Changes {
+		messages = append(messages, c.String())
+	}
+	assert.Equal(t, []string{
+		`[breaking] identify rules: type of traits.email changed from string to [string null]`,
+		`[breaking] identify rules: traits.email.format changed from email to <nil>`,
+		`event "Order Completed": property properties.coupon added`,
+		`[breaking] event "Order Completed": enum value GBP added to properties.currency`,
+		`event "Order Completed": enum value EUR removed from properties.currency`,
+		`event "Order Completed": description of properties.order_id changed from "id of the order" to "numeric id of the order"`,
+		`[breaking] event "Order Completed": type of properties.order_id changed from string to integer`,
+		`[breaking] event "Order Completed": property properties.products[].sku removed`,
+		`event "Order Completed": property properties.currency is now required`,
+		`[breaking] event "Order Completed": property properties.total is no longer required`,
+	}, messages)
+	assert.True(t, diff.HasBreakingChanges())
+	assert.Len(t, diff.Breaking(), 6)
+}
+
+func TestDiffTrackingPlans_TypeNarrowing(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	a.Rules.Events[1].Rules.Properties.Properties.Properties["plan"] = Property{Type: []string{"string", "null"}}
+
+	diff := DiffTrackingPlans(a, b)
+	assert.Equal(t, []TrackingPlanChange{{
+		Type:    TypeChanged,
+		Section: SectionEvent,
+		Event:   "Signed Up",
+		Version: 1,
+		Path:    "properties.plan",
+		Old:     []string{"string", "null"},
+		New:     "string",
+	}}, diff.Changes)
+}
+
+func TestDiffTrackingPlans_RulesRequiredAndType(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	a.Rules.Events[0].Rules.Type = "object"
+	a.Rules.Events[0].Rules.Required = []string{"properties"}
+	b.Rules.Events[0].Rules.Type = "array"
+	b.Rules.Events[0].Rules.Required = []string{"context"}
+	b.Rules.Identify.Required = []string{"traits"}
+
+	diff := DiffTrackingPlans(a, b)
+	assert.Equal(t, []TrackingPlanChange{
+		{Type: RequiredAdded, Section: SectionIdentify, Path: "traits", New: "traits", Breaking: true},
+		{Type: TypeChanged, Section: SectionEvent, Event: "Order Completed", Version: 1, Old: "object", New: "array", Breaking: true},
+		{Type: RequiredAdded, Section: SectionEvent, Event: "Order Completed", Version: 1, Path: "context", New: "context", Breaking: true},
+		{Type: RequiredRemoved, Section: SectionEvent, Event: "Order Completed", Version: 1, Path: "properties", Old: "properties", Breaking: true},
+	}, diff.Changes)
+	assert.Len(t, diff.Breaking(), 4)
+	assert.Equal(t, `[breaking] identify rules: property traits is now required`, diff.Changes[0].String())
+	assert.Equal(t, `[breaking] event "Order Completed": type changed from object to array`, diff.Changes[1].String())
+}
+
+func TestDiffTrackingPlans_Events(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	version := 2
+	b.Rules.Events[0].Description = "Checkout finished"
+	b.Rules.Events[1].Name = "User Signed Up"
+	b.Rules.Events[2] = Event{Name: "Order Refunded"}
+	b.Rules.Events = append(b.Rules.Events, Event{Name: "Order Completed", Version: &version})
+
+	diff := DiffTrackingPlans(a, b)
+	assert.Equal(t, []TrackingPlanChange{
+		{Type: DescriptionChanged, Section: SectionEvent, Event: "Order Completed", Version: 1, Old: "An order was completed", New: "Checkout finished"},
+		{Type: EventRenamed, Section: SectionEvent, Event: "Signed Up", Version: 1, Old: "Signed Up", New: "User Signed Up", Breaking: true},
+		{Type: EventRemoved, Section: SectionEvent, Event: "Logged Out", Version: 1, Old: "Logged Out", Breaking: true},
+		{Type: EventAdded, Section: SectionEvent, Event: "Order Refunded", Version: 1, New: "Order Refunded"},
+		{Type: EventAdded, Section: SectionEvent, Event: "Order Completed", Version: 2, New: "Order Completed"},
+	}, diff.Changes)
+	assert.Equal(t, `[breaking] event "Signed Up" renamed to "User Signed Up"`, diff.Changes[1].String())
+	assert.Equal(t, `event "Order Completed" (v2) added`, diff.Changes[4].String())
+}
+
+func TestDiffTrackingPlans_EventRemoved(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	b.Rules.Events = b.Rules.Events[:1]
+
+	diff := DiffTrackingPlans(a, b)
+	assert.Equal(t, []TrackingPlanChange{
+		{Type: EventRemoved, Section: SectionEvent, Event: "Signed Up", Version: 1, Old: "Signed Up", Breaking: true},
+		{Type: EventRemoved, Section: SectionEvent, Event: "Logged Out", Version: 1, Old: "Logged Out", Breaking: true},
+	}, diff.Changes)
+}
+
+func TestDiffTrackingPlans_EnumAddedAndDropped(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	a.Rules.Events[1].Rules.Properties.Properties.Properties["plan"] = Property{Type: "string", Enum: []*string{newString("free"), nil}}
+
+	diff := DiffTrackingPlans(a, b)
+	assert.Equal(t, []TrackingPlanChange{{
+		Type: ConstraintChanged, Section: SectionEvent, Event: "Signed Up", Version: 1,
+		Path: "properties.plan.enum", Old: []string{"free", "null"}, Breaking: true,
+	}}, diff.Changes)
+
+	diff = DiffTrackingPlans(b, a)
+	assert.False(t, diff.HasBreakingChanges())
+}
+
+func TestDiffTrackingPlans_SchemaKeywords(t *testing.T) {
+	a, b := diffTestPlan(), diffTestPlan()
+	min, max, newMax := 0.0, 100.0, 50.0
+	a.Rules.Events[0].Rules.Properties.Properties.Properties["total"] = Property{
+		Type: "number", Maximum: &max, Const: json.RawMessage(`10`),
+	}
+	b.Rules.Events[0].Rules.Properties.Properties.Properties["total"] = Property{
+		Type: "number", Minimum: &min, Maximum: &newMax, OneOf: []Property{{Type: "number"}},
+	}
+
+	diff := DiffTrackingPlans(a, b)
+	var messages []string
+	for _, c := range diff.Changes {
+		messages = append(messages, c.String())
+	}
+	assert.Equal(t, []string{
+		`event "Order Completed": properties.total.minimum changed from <nil> to 0`,
+		`[breaking] event "Order Completed": properties.total.maximum changed from 100 to 50`,
+		`event "Order Completed": properties.total.oneOf changed from <nil> to [map[type:number]]`,
+		`[breaking] event "Order Completed": properties.total.const changed from 10 to <nil>`,
+	}, messages)
+}
@@ -0,0 +1,481 @@
+package segment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// DocsFormat is the output format of the tracking plan documentation
+type DocsFormat string
+
+// Documentation formats supported by RenderTrackingPlanDocs
+const (
+	DocsFormatMarkdown DocsFormat = "markdown"
+	DocsFormatHTML     DocsFormat = "html"
+)
+
+// DocsOptions configures the documentation generated for a tracking plan
+type DocsOptions struct {
+	// Format is DocsFormatMarkdown by default
+	Format DocsFormat
+	// Sources are listed on the index page, e.g. the connections returned by
+	// ListTrackingPlanSources
+	Sources []TrackingPlanSourceConnection
+	// Previous is an older version of the plan. When set, the index page has
+	// a changelog of the changes since then.
+	Previous *TrackingPlan
+}
+
+// RenderTrackingPlanDocs generates browsable documentation for a tracking
+// plan: an index page with the sources, the global, identify and group rules,
+// the list of events and an optional changelog, and one page per event with
+// its property tables. It returns the content of each page keyed by its path
+// relative to the documentation root, e.g. "index.md" and
+// "events/order-completed.md".
+func RenderTrackingPlanDocs(tp TrackingPlan, opts DocsOptions) (map[string][]byte, error) {
+	var r docsRenderer
+	switch opts.Format {
+	case "", DocsFormatMarkdown:
+		r = markdownDocs{}
+	case DocsFormatHTML:
+		r = htmlDocs{}
+	default:
+		return nil, errors.Errorf("unknown documentation format %q", opts.Format)
+	}
+
+	index := newDocsIndex(tp, opts, r.ext())
+	pages := map[string][]byte{}
+	data, err := r.index(index)
+	if err != nil {
+		return nil, err
+	}
+	pages["index."+r.ext()] = data
+	for _, e := range index.Events {
+		if pages[e.File], err = r.event(index.Title, e); err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// WriteTrackingPlanDocs writes the documentation of RenderTrackingPlanDocs
+// to dir, creating it if needed. Event pages of the same format left from
+// events no longer in the plan are removed.
+func WriteTrackingPlanDocs(tp TrackingPlan, dir string, opts DocsOptions) error {
+	pages, err := RenderTrackingPlanDocs(tp, opts)
+	if err != nil {
+		return err
+	}
+	ext := ""
+	for name, data := range pages {
+		if path.Dir(name) == "." {
+			ext = path.Ext(name)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return errors.Wrapf(err, "creating %s failed", filepath.Dir(file))
+		}
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			return errors.Wrapf(err, "writing %s failed", file)
+		}
+	}
+
+	events := filepath.Join(dir, "events")
+	files, err := ioutil.ReadDir(events)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading %s failed", events)
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ext || pages["events/"+f.Name()] != nil {
+			continue
+		}
+		file := filepath.Join(events, f.Name())
+		if err := os.Remove(file); err != nil {
+			return errors.Wrapf(err, "removing %s failed", file)
+		}
+	}
+	return nil
+}
+
+// docsIndex is what the index page shows
+type docsIndex struct {
+	Title     string
+	Sources   []string
+	Rules     []docsRules
+	Events    []docsEvent
+	Changelog []TrackingPlanChange
+	// HasChangelog tells an empty changelog from none
+	HasChangelog bool
+}
+
+type docsRules struct {
+	Title    string
+	Sections []docsSection
+}
+
+type docsEvent struct {
+	Name        string
+	Version     int
+	Description string
+	File        string
+	// Link is the path of the event page relative to the index page
+	Link     string
+	Sections []docsSection
+}
+
+type docsSection struct {
+	Title      string
+	Properties []docsProperty
+}
+
+type docsProperty struct {
+	Path        string
+	Type        string
+	Required    bool
+	Description string
+	Constraints []string
+}
+
+func newDocsIndex(tp TrackingPlan, opts DocsOptions, ext string) docsIndex {
+	index := docsIndex{Title: tp.DisplayName}
+	if index.Title == "" {
+		index.Title = "Tracking Plan"
+	}
+	for _, s := range opts.Sources {
+		index.Sources = append(index.Sources, path.Base(s.Source))
+	}
+	sort.Strings(index.Sources)
+
+	for _, r := range []struct {
+		title string
+		rules Rules
+	}{{"Global", tp.Rules.Global}, {"Identify", tp.Rules.Identify}, {"Group", tp.Rules.Group}} {
+		if sections := docsSections(r.rules); len(sections) > 0 {
+			index.Rules = append(index.Rules, docsRules{Title: r.title, Sections: sections})
+		}
+	}
+
+	taken := map[string]bool{}
+	for _, e := range tp.Rules.Events {
+		name := eventFileName(e, taken)
+		taken[name] = true
+		link := "events/" + name + "." + ext
+		index.Events = append(index.Events, docsEvent{
+			Name:        e.Name,
+			Version:     eventVersion(e),
+			Description: e.Description,
+			File:        link,
+			Link:        link,
+			Sections:    docsSections(e.Rules),
+		})
+	}
+	sort.SliceStable(index.Events, func(i, j int) bool {
+		a, b := index.Events[i], index.Events[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+
+	if opts.Previous != nil {
+		index.HasChangelog = true
+		index.Changelog = DiffTrackingPlans(*opts.Previous, tp).Changes
+	}
+	return index
+}
+
+func docsSections(r Rules) []docsSection {
+	var sections []docsSection
+	for _, s := range ruleSections(r) {
+		var props []docsProperty
+		docsProperties(&props, "", s.p.Properties, s.p.Required)
+		if len(props) > 0 {
+			sections = append(sections, docsSection{Title: titleCase(s.name), Properties: props})
+		}
+	}
+	return sections
+}
+
+// titleCase upper-cases the first letter of each word of s
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// docsProperties flattens nested properties into rows with dotted paths
+func docsProperties(rows *[]docsProperty, prefix string, props map[string]Property, required []string) {
+	isRequired := stringSet(required)
+	for _, name := range propertyNames(props) {
+		p := props[name]
+		path := joinField(prefix, name)
+		*rows = append(*rows, docsProperty{
+			Path:        path,
+			Type:        docsType(p),
+			Required:    isRequired[name],
+			Description: p.Description,
+			Constraints: docsConstraints(p),
+		})
+		docsProperties(rows, path, p.Properties, p.Required)
+		for items := p.Items; items != nil; items = items.Items {
+			path += "[]"
+			docsProperties(rows, path, items.Properties, items.Required)
+		}
+	}
+}
+
+func docsType(p Property) string {
+	types := propertyTypes(p.Type)
+	for i, t := range types {
+		if t == "array" && p.Items != nil {
+			types[i] = "array of " + docsType(*p.Items)
+		}
+	}
+	if len(types) == 0 {
+		if p.Ref != "" {
+			return p.Ref
+		}
+		return "any"
+	}
+	return strings.Join(types, " or ")
+}
+
+func docsConstraints(p Property) []string {
+	var c []string
+	if p.Enum != nil {
+		c = append(c, "one of: "+strings.Join(enumValues(p.Enum), ", "))
+	}
+	if p.Const != nil {
+		c = append(c, "always: "+string(p.Const))
+	}
+	if p.Format != nil {
+		c = append(c, "format: "+*p.Format)
+	}
+	if p.Pattern != nil {
+		c = append(c, "pattern: "+*p.Pattern)
+	}
+	if p.Minimum != nil {
+		c = append(c, fmt.Sprintf("minimum: %v", *p.Minimum))
+	}
+	if p.Maximum != nil {
+		c = append(c, fmt.Sprintf("maximum: %v", *p.Maximum))
+	}
+	for _, b := range []struct {
+		name  string
+		value interface{}
+	}{{"exclusive minimum", p.ExclusiveMinimum}, {"exclusive maximum", p.ExclusiveMaximum}} {
+		if v, ok := b.value.(float64); ok {
+			c = append(c, fmt.Sprintf("%s: %v", b.name, v))
+		}
+	}
+	if p.MinLength != nil {
+		c = append(c, fmt.Sprintf("min length: %d", *p.MinLength))
+	}
+	if p.MaxLength != nil {
+		c = append(c, fmt.Sprintf("max length: %d", *p.MaxLength))
+	}
+	if p.MinItems != nil {
+		c = append(c, fmt.Sprintf("min items: %d", *p.MinItems))
+	}
+	for _, list := range []struct {
+		name    string
+		schemas []Property
+	}{{"all of", p.AllOf}, {"any of", p.AnyOf}, {"one of", p.OneOf}} {
+		if len(list.schemas) == 0 {
+			continue
+		}
+		schemas := make([]string, len(list.schemas))
+		for i, s := range list.schemas {
+			data, _ := json.Marshal(s)
+			schemas[i] = string(data)
+		}
+		c = append(c, list.name+": "+strings.Join(schemas, ", "))
+	}
+	return c
+}
+
+type docsRenderer interface {
+	ext() string
+	index(index docsIndex) ([]byte, error)
+	event(title string, e docsEvent) ([]byte, error)
+}
+
+type markdownDocs struct{}
+
+func (markdownDocs) ext() string { return "md" }
+
+func (m markdownDocs) index(index docsIndex) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n", index.Title)
+
+	if len(index.Sources) > 0 {
+		b.WriteString("\n## Sources\n\n")
+		for _, s := range index.Sources {
+			fmt.Fprintf(&b, "- %s\n", markdownText(s))
+		}
+	}
+
+	for _, r := range index.Rules {
+		fmt.Fprintf(&b, "\n## %s\n", r.Title)
+		m.sections(&b, "###", r.Sections)
+	}
+
+	b.WriteString("\n## Events\n\n")
+	if len(index.Events) == 0 {
+		b.WriteString("No events.\n")
+	}
+	for _, e := range index.Events {
+		fmt.Fprintf(&b, "- [%s](%s)", markdownText(docsEventTitle(e)), e.Link)
+		if e.Description != "" {
+			fmt.Fprintf(&b, ": %s", markdownText(e.Description))
+		}
+		b.WriteString("\n")
+	}
+
+	if index.HasChangelog {
+		b.WriteString("\n## Changelog\n\n")
+		if len(index.Changelog) == 0 {
+			b.WriteString("No changes.\n")
+		}
+		for _, c := range index.Changelog {
+			fmt.Fprintf(&b, "- %s\n", markdownText(c.String()))
+		}
+	}
+	return b.Bytes(), nil
+}
+
+func (m markdownDocs) event(title string, e docsEvent) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", markdownText(docsEventTitle(e)))
+	fmt.Fprintf(&b, "[%s](../index.md)\n", markdownText(title))
+	if e.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", markdownText(e.Description))
+	}
+	if len(e.Sections) == 0 {
+		b.WriteString("\nThis event has no properties.\n")
+	}
+	m.sections(&b, "##", e.Sections)
+	return b.Bytes(), nil
+}
+
+func (markdownDocs) sections(b *bytes.Buffer, heading string, sections []docsSection) {
+	for _, s := range sections {
+		fmt.Fprintf(b, "\n%s %s\n\n", heading, s.Title)
+		b.WriteString("| Property | Type | Required | Description | Constraints |\n")
+		b.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, p := range s.Properties {
+			required := ""
+			if p.Required {
+				required = "yes"
+			}
+			fmt.Fprintf(b, "| `%s` | %s | %s | %s | %s |\n",
+				p.Path, markdownCell(p.Type), required, markdownCell(p.Description), markdownCell(strings.Join(p.Constraints, "; ")))
+		}
+	}
+}
+
+// markdownText keeps text on one line
+func markdownText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// markdownCell escapes the pipes that would end a table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(markdownText(s), "|", `\|`)
+}
+
+func docsEventTitle(e docsEvent) string {
+	if e.Version > 1 {
+		return fmt.Sprintf("%s (v%d)", e.Name, e.Version)
+	}
+	return e.Name
+}
+
+type htmlDocs struct{}
+
+func (htmlDocs) ext() string { return "html" }
+
+var htmlDocsTemplates = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"eventTitle": docsEventTitle,
+	"join":       strings.Join,
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "sections"}}{{range .}}
+<h3>{{.Title}}</h3>
+<table>
+<tr><th>Property</th><th>Type</th><th>Required</th><th>Description</th><th>Constraints</th></tr>
+{{range .Properties}}<tr><td><code>{{.Path}}</code></td><td>{{.Type}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td><td>{{join .Constraints "; "}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}
+
+{{define "index"}}{{template "head" .Title}}<h1>{{.Title}}</h1>
+{{if .Sources}}<h2>Sources</h2>
+<ul>
+{{range .Sources}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}{{range .Rules}}<h2>{{.Title}}</h2>
+{{template "sections" .Sections}}{{end}}<h2>Events</h2>
+{{if .Events}}<ul>
+{{range .Events}}<li><a href="{{.Link}}">{{eventTitle .}}</a>{{if .Description}}: {{.Description}}{{end}}</li>
+{{end}}</ul>
+{{else}}<p>No events.</p>
+{{end}}{{if .HasChangelog}}<h2>Changelog</h2>
+{{if .Changelog}}<ul>
+{{range .Changelog}}<li>{{.String}}</li>
+{{end}}</ul>
+{{else}}<p>No changes.</p>
+{{end}}{{end}}</body>
+</html>
+{{end}}
+
+{{define "event"}}{{template "head" eventTitle .Event}}<h1>{{eventTitle .Event}}</h1>
+<p><a href="../index.html">{{.Title}}</a></p>
+{{if .Event.Description}}<p>{{.Event.Description}}</p>
+{{end}}{{if .Event.Sections}}{{template "sections" .Event.Sections}}{{else}}<p>This event has no properties.</p>
+{{end}}</body>
+</html>
+{{end}}
+`))
+
+func (htmlDocs) index(index docsIndex) ([]byte, error) {
+	var b bytes.Buffer
+	err := htmlDocsTemplates.ExecuteTemplate(&b, "index", index)
+	return b.Bytes(), errors.Wrap(err, "rendering index failed")
+}
+
+func (htmlDocs) event(title string, e docsEvent) ([]byte, error) {
+	var b bytes.Buffer
+	err := htmlDocsTemplates.ExecuteTemplate(&b, "event", struct {
+		Title string
+		Event docsEvent
+	}{title, e})
+	return b.Bytes(), errors.Wrapf(err, "rendering event %s failed", e.Name)
+}
@@ -0,0 +1,129 @@
+package segment
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTrackingPlanDocs_Markdown(t *testing.T) {
+	tp := diffTestPlan()
+	previous := diffTestPlan()
+	previous.Rules.Events = previous.Rules.Events[:1]
+	previous.Rules.Events = append(previous.Rules.Events, Event{Name: "Order Refunded"})
+
+	pages, err := RenderTrackingPlanDocs(tp, DocsOptions{
+		Sources:  []TrackingPlanSourceConnection{{Source: "workspaces/test-workspace/sources/web", TrackingPlanId: "rs_123"}},
+		Previous: &previous,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, pages, 4)
+
+	assert.Equal(t, "# Test\n"+
+		"\n## Sources\n\n- web\n"+
+		"\n## Identify\n\n### Traits\n\n"+
+		"| Property | Type | Required | Description | Constraints |\n"+
+		"| --- | --- | --- | --- | --- |\n"+
+		"| `email` | string |  |  | format: email |\n"+
+		"\n## Events\n\n"+
+		"- [Logged Out](events/logged-out.md)\n"+
+		"- [Order Completed](events/order-completed.md): An order was completed\n"+
+		"- [Signed Up](events/signed-up.md)\n"+
+		"\n## Changelog\n\n"+
+		"- [breaking] event \"Order Refunded\" removed\n"+
+		"- event \"Signed Up\" added\n"+
+		"- event \"Logged Out\" added\n",
+		string(pages["index.md"]))
+
+	assert.Equal(t, "# Order Completed\n\n[Test](../index.md)\n\nAn order was completed\n"+
+		"\n## Properties\n\n"+
+		"| Property | Type | Required | Description | Constraints |\n"+
+		"| --- | --- | --- | --- | --- |\n"+
+		"| `currency` | string |  |  | one of: USD, EUR |\n"+
+		"| `order_id` | string | yes | id of the order |  |\n"+
+		"| `products` | array of object |  |  |  |\n"+
+		"| `products[].sku` | string |  |  | pattern: ^[A-Z]+$ |\n"+
+		"| `total` | number | yes |  |  |\n",
+		string(pages["events/order-completed.md"]))
+
+	assert.Equal(t, "# Logged Out\n\n[Test](../index.md)\n\nThis event has no properties.\n", string(pages["events/logged-out.md"]))
+}
+
+func TestRenderTrackingPlanDocs_MarkdownEscaping(t *testing.T) {
+	version := 2
+	tp := TrackingPlan{Rules: RuleSet{Events: []Event{{
+		Name:    "Searched",
+		Version: &version,
+		Rules: Rules{Properties: RuleProperties{Properties: Properties{Properties: map[string]Property{
+			"query": {Type: []interface{}{"string", "null"}, Description: "what was\nsearched | typed", Pattern: newString("^(a|b)$")},
+		}}}},
+	}}}}
+
+	pages, err := RenderTrackingPlanDocs(tp, DocsOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(pages["index.md"]), "# Tracking Plan\n")
+	assert.Contains(t, string(pages["index.md"]), "- [Searched (v2)](events/searched-v2.md)\n")
+	assert.Contains(t, string(pages["events/searched-v2.md"]),
+		"| `query` | null or string |  | what was searched \\| typed | pattern: ^(a\\|b)$ |\n")
+}
+
+func TestRenderTrackingPlanDocs_HTML(t *testing.T) {
+	tp := diffTestPlan()
+	tp.Rules.Events[0].Description = "<b>An order</b> was completed"
+
+	pages, err := RenderTrackingPlanDocs(tp, DocsOptions{Format: DocsFormatHTML})
+	assert.NoError(t, err)
+	assert.Len(t, pages, 4)
+
+	index := string(pages["index.html"])
+	assert.Contains(t, index, "<h1>Test</h1>")
+	assert.Contains(t, index, `<li><a href="events/order-completed.html">Order Completed</a>: &lt;b&gt;An order&lt;/b&gt; was completed</li>`)
+	assert.NotContains(t, index, "Changelog")
+
+	event := string(pages["events/order-completed.html"])
+	assert.Contains(t, event, `<p><a href="../index.html">Test</a></p>`)
+	assert.Contains(t, event, "<tr><td><code>order_id</code></td><td>string</td><td>yes</td><td>id of the order</td><td></td></tr>")
+	assert.Contains(t, event, "<tr><td><code>currency</code></td><td>string</td><td></td><td></td><td>one of: USD, EUR</td></tr>")
+}
+
+func TestRenderTrackingPlanDocs_UnknownFormat(t *testing.T) {
+	_, err := RenderTrackingPlanDocs(diffTestPlan(), DocsOptions{Format: "pdf"})
+	assert.EqualError(t, err, `unknown documentation format "pdf"`)
+}
+
+func TestWriteTrackingPlanDocs(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, WriteTrackingPlanDocs(diffTestPlan(), dir, DocsOptions{}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "# Test\n")
+	assert.FileExists(t, filepath.Join(dir, "events", "order-completed.md"))
+	assert.FileExists(t, filepath.Join(dir, "events", "signed-up.md"))
+	assert.FileExists(t, filepath.Join(dir, "events", "logged-out.md"))
+}
+
+func TestWriteTrackingPlanDocs_RemovesStalePages(t *testing.T) {
+	dir := t.TempDir()
+	tp := diffTestPlan()
+	assert.NoError(t, WriteTrackingPlanDocs(tp, dir, DocsOptions{}))
+	assert.NoError(t, WriteTrackingPlanDocs(tp, dir, DocsOptions{Format: DocsFormatHTML}))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "events", "notes.txt"), []byte("kept"), 0644))
+
+	tp.Rules.Events = tp.Rules.Events[:1]
+	assert.NoError(t, WriteTrackingPlanDocs(tp, dir, DocsOptions{}))
+
+	assert.FileExists(t, filepath.Join(dir, "events", "order-completed.md"))
+	assert.NoFileExists(t, filepath.Join(dir, "events", "signed-up.md"))
+	assert.NoFileExists(t, filepath.Join(dir, "events", "logged-out.md"))
+	assert.FileExists(t, filepath.Join(dir, "events", "signed-up.html"))
+	assert.FileExists(t, filepath.Join(dir, "events", "notes.txt"))
+}
+
+func TestTitleCase(t *testing.T) {
+	assert.Equal(t, "Properties", titleCase("properties"))
+	assert.Equal(t, "Über Traits", titleCase("über traits"))
+	assert.Equal(t, "", titleCase(""))
+}
@@ -0,0 +1,103 @@
+package segment
+
+import (
+	"github.com/pkg/errors"
+)
+
+// AddTrackingPlanEvent adds an event to last, a tracking plan as the caller
+// last read it, leaving the other events as they are. It fails if the plan
+// already has an event with the same name and version, and with a
+// *ConflictError if the plan has changed since last was read.
+func (c *Client) AddTrackingPlanEvent(trackingPlanID string, last TrackingPlan, event Event) (TrackingPlan, error) {
+	return c.modifyTrackingPlanEvents(trackingPlanID, last, func(events []Event) ([]Event, error) {
+		if i := eventIndex(events, event.Name, eventVersion(event)); i >= 0 {
+			return nil, errors.Errorf("event %s already exists", eventKey(event))
+		}
+		return append(events, event), nil
+	})
+}
+
+// UpdateTrackingPlanEvent replaces the event of last with the same name and
+// version as event. It fails if there is no such event, and with a
+// *ConflictError if the plan has changed since last was read.
+func (c *Client) UpdateTrackingPlanEvent(trackingPlanID string, last TrackingPlan, event Event) (TrackingPlan, error) {
+	return c.modifyTrackingPlanEvents(trackingPlanID, last, func(events []Event) ([]Event, error) {
+		i := eventIndex(events, event.Name, eventVersion(event))
+		if i < 0 {
+			return nil, errors.Errorf("event %s does not exist", eventKey(event))
+		}
+		events[i] = event
+		return events, nil
+	})
+}
+
+// RemoveTrackingPlanEvent removes version of the named event from last.
+// Unversioned events are version 1. It fails if there is no such event, and
+// with a *ConflictError if the plan has changed since last was read.
+func (c *Client) RemoveTrackingPlanEvent(trackingPlanID string, last TrackingPlan, name string, version int) (TrackingPlan, error) {
+	if version == 0 {
+		version = 1
+	}
+	return c.modifyTrackingPlanEvents(trackingPlanID, last, func(events []Event) ([]Event, error) {
+		i := eventIndex(events, name, version)
+		if i < 0 {
+			return nil, errors.Errorf("event %s@%d does not exist", name, version)
+		}
+		return append(events[:i], events[i+1:]...), nil
+	})
+}
+
+// UpsertTrackingPlanEvents adds or replaces many events of last in a single
+// update. Events are matched by name and version; new events are appended in
+// order. It fails with a *ConflictError if the plan has changed since last
+// was read.
+func (c *Client) UpsertTrackingPlanEvents(trackingPlanID string, last TrackingPlan, events []Event) (TrackingPlan, error) {
+	return c.modifyTrackingPlanEvents(trackingPlanID, last, func(current []Event) ([]Event, error) {
+		for _, event := range events {
+			if i := eventIndex(current, event.Name, eventVersion(event)); i >= 0 {
+				current[i] = event
+			} else {
+				current = append(current, event)
+			}
+		}
+		return current, nil
+	})
+}
+
+// modifyTrackingPlanEvents applies modify to the events of last, the plan as
+// the caller read it, and writes the rules back. Like the IfUnchanged
+// methods, it returns a *ConflictError if the plan has changed since last was
+// read, so that edits made in the meantime are not overwritten. The API has
+// no conditional writes, so an edit made between that check and the write
+// can still be lost.
+func (c *Client) modifyTrackingPlanEvents(trackingPlanID string, last TrackingPlan, modify func([]Event) ([]Event, error)) (TrackingPlan, error) {
+	events := make([]Event, len(last.Rules.Events))
+	copy(events, last.Rules.Events)
+	events, err := modify(events)
+	if err != nil {
+		return last, err
+	}
+
+	if current, err := c.checkTrackingPlanUnchanged(trackingPlanID, last); err != nil {
+		return current, err
+	}
+
+	rules := last.Rules
+	rules.Events = events
+	return c.updateTrackingPlanRules(trackingPlanID, rules)
+}
+
+// updateTrackingPlanRules replaces the rules of a tracking plan without
+// touching its display name.
+func (c *Client) updateTrackingPlanRules(trackingPlanID string, rules RuleSet) (TrackingPlan, error) {
+	return c.UpdateTrackingPlanFields(trackingPlanID, TrackingPlan{Rules: rules}, TrackingPlanFieldRules)
+}
+
+func eventIndex(events []Event, name string, version int) int {
+	for i, e := range events {
+		if e.Name == name && eventVersion(e) == version {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,154 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testEventsPlanResponse = `{
+	"name": "workspaces/test/tracking-plans/rs_123abc",
+	"display_name": "Test Tracking Plan",
+	"rules": {
+		"events": [
+			{"name": "Order Completed", "description": "v1", "rules": {}},
+			{"name": "Order Completed", "version": 2, "description": "v2", "rules": {}},
+			{"name": "Signed Up", "rules": {}}
+		]
+	},
+	"update_time": "2020-01-02T03:04:05Z"
+}`
+
+// trackingPlanUpdateRequest decodes the body of tracking plan updates
+type trackingPlanUpdateRequest struct {
+	UpdateMask   UpdateMask   `json:"update_mask"`
+	TrackingPlan TrackingPlan `json:"tracking_plan"`
+}
+
+// handleEventsPlan serves testEventsPlanResponse and records the update
+// request. The update time changes after conflictAfter reads, if positive.
+func handleEventsPlan(t *testing.T, conflictAfter int) *trackingPlanUpdateRequest {
+	var update trackingPlanUpdateRequest
+	gets := 0
+	endpoint := fmt.Sprintf("/%s/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint, testTrackingPlanID)
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			gets++
+			if conflictAfter > 0 && gets > conflictAfter {
+				fmt.Fprint(w, `{"name": "workspaces/test/tracking-plans/rs_123abc", "update_time": "2020-01-02T03:04:06Z"}`)
+				return
+			}
+			fmt.Fprint(w, testEventsPlanResponse)
+		case http.MethodPut:
+			body, err := ioutil.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.NoError(t, json.Unmarshal(body, &update))
+			fmt.Fprint(w, string(body))
+		}
+	})
+	return &update
+}
+
+func eventNames(events []Event) []string {
+	var names []string
+	for _, e := range events {
+		names = append(names, fmt.Sprintf("%s %s", eventKey(e), e.Description))
+	}
+	return names
+}
+
+func TestTrackingPlanEvents_AddTrackingPlanEvent(t *testing.T) {
+	setup()
+	defer teardown()
+	update := handleEventsPlan(t, 0)
+	last, err := client.GetTrackingPlan(testTrackingPlanID)
+	assert.NoError(t, err)
+
+	_, err = client.AddTrackingPlanEvent(testTrackingPlanID, last, Event{Name: "Product Viewed", Description: "new"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tracking_plan.rules"}, update.UpdateMask.Paths)
+	assert.Empty(t, update.TrackingPlan.DisplayName)
+	assert.Equal(t, []string{"Order Completed@1 v1", "Order Completed@2 v2", "Signed Up@1 ", "Product Viewed@1 new"}, eventNames(update.TrackingPlan.Rules.Events))
+
+	_, err = client.AddTrackingPlanEvent(testTrackingPlanID, last, Event{Name: "Signed Up"})
+	assert.EqualError(t, err, "event Signed Up@1 already exists")
+}
+
+func TestTrackingPlanEvents_UpdateTrackingPlanEvent(t *testing.T) {
+	setup()
+	defer teardown()
+	update := handleEventsPlan(t, 0)
+	last, err := client.GetTrackingPlan(testTrackingPlanID)
+	assert.NoError(t, err)
+
+	version := 2
+	_, err = client.UpdateTrackingPlanEvent(testTrackingPlanID, last, Event{Name: "Order Completed", Version: &version, Description: "changed"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Order Completed@1 v1", "Order Completed@2 changed", "Signed Up@1 "}, eventNames(update.TrackingPlan.Rules.Events))
+
+	_, err = client.UpdateTrackingPlanEvent(testTrackingPlanID, last, Event{Name: "Product Viewed"})
+	assert.EqualError(t, err, "event Product Viewed@1 does not exist")
+}
+
+func TestTrackingPlanEvents_RemoveTrackingPlanEvent(t *testing.T) {
+	setup()
+	defer teardown()
+	update := handleEventsPlan(t, 0)
+	last, err := client.GetTrackingPlan(testTrackingPlanID)
+	assert.NoError(t, err)
+
+	_, err = client.RemoveTrackingPlanEvent(testTrackingPlanID, last, "Order Completed", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Order Completed@2 v2", "Signed Up@1 "}, eventNames(update.TrackingPlan.Rules.Events))
+
+	_, err = client.RemoveTrackingPlanEvent(testTrackingPlanID, last, "Order Completed", 3)
+	assert.EqualError(t, err, "event Order Completed@3 does not exist")
+}
+
+func TestTrackingPlanEvents_UpsertTrackingPlanEvents(t *testing.T) {
+	setup()
+	defer teardown()
+	update := handleEventsPlan(t, 0)
+	last, err := client.GetTrackingPlan(testTrackingPlanID)
+	assert.NoError(t, err)
+
+	_, err = client.UpsertTrackingPlanEvents(testTrackingPlanID, last, []Event{
+		{Name: "Signed Up", Description: "changed"},
+		{Name: "Product Viewed", Description: "new"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Order Completed@1 v1", "Order Completed@2 v2", "Signed Up@1 changed", "Product Viewed@1 new"}, eventNames(update.TrackingPlan.Rules.Events))
+}
+
+func TestTrackingPlanEvents_Conflict(t *testing.T) {
+	setup()
+	defer teardown()
+	update := handleEventsPlan(t, 1)
+	last, err := client.GetTrackingPlan(testTrackingPlanID)
+	assert.NoError(t, err)
+
+	_, err = client.AddTrackingPlanEvent(testTrackingPlanID, last, Event{Name: "Product Viewed"})
+	assert.True(t, IsConflict(err))
+	assert.EqualError(t, err, "workspaces/test/tracking-plans/rs_123abc was modified concurrently: expected update time 2020-01-02T03:04:05Z, found 2020-01-02T03:04:06Z")
+	assert.Empty(t, update.UpdateMask.Paths)
+}
+
+func TestTrackingPlanEvents_StaleRead(t *testing.T) {
+	setup()
+	defer teardown()
+	update := handleEventsPlan(t, 0)
+	last, err := client.GetTrackingPlan(testTrackingPlanID)
+	assert.NoError(t, err)
+
+	// The plan was changed by someone else after the caller read it
+	last.UpdateTime = last.UpdateTime.Add(-time.Hour)
+	_, err = client.UpsertTrackingPlanEvents(testTrackingPlanID, last, []Event{{Name: "Signed Up", Description: "changed"}})
+	assert.True(t, IsConflict(err))
+	assert.Empty(t, update.UpdateMask.Paths)
+}
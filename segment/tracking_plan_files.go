@@ -0,0 +1,327 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// TrackingPlanFormat is the file format used when exporting a tracking plan
+type TrackingPlanFormat string
+
+const (
+	// TrackingPlanFormatYAML writes every file as YAML
+	TrackingPlanFormatYAML TrackingPlanFormat = "yaml"
+	// TrackingPlanFormatJSON writes every file as JSON Schema documents
+	TrackingPlanFormatJSON TrackingPlanFormat = "json"
+)
+
+const (
+	trackingPlanManifestName = "tracking-plan"
+	trackingPlanEventsDir    = "events"
+)
+
+var trackingPlanExtensions = []string{".yaml", ".yml", ".json"}
+
+// trackingPlanManifest is the top level file of an exported tracking plan.
+// Events lists the event files in the order of RuleSet.Events.
+type trackingPlanManifest struct {
+	Name        string   `json:"name,omitempty"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Events      []string `json:"events,omitempty"`
+}
+
+// eventFile is the on-disk form of an Event: a JSON Schema document whose
+// title and description hold the event name and description. Unknown fields
+// of the rules are kept at the top level of the document, those of the event
+// under x-event.
+type eventFile struct {
+	Schema      string                     `json:"$schema,omitempty"`
+	Title       string                     `json:"title"`
+	Description string                     `json:"description,omitempty"`
+	Version     *int                       `json:"version,omitempty"`
+	Type        string                     `json:"type,omitempty"`
+	Properties  RuleProperties             `json:"properties,omitempty"`
+	Required    []string                   `json:"required,omitempty"`
+	EventExtra  map[string]json.RawMessage `json:"x-event,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (f *eventFile) UnmarshalJSON(data []byte) error {
+	type file eventFile
+	extra, err := unmarshalWithExtra(data, (*file)(f))
+	f.Extra = extra
+	return err
+}
+
+func (f eventFile) MarshalJSON() ([]byte, error) {
+	type file eventFile
+	return marshalWithExtra(file(f), f.Extra)
+}
+
+func newEventFile(e Event) eventFile {
+	return eventFile{
+		Schema:      e.Rules.Schema,
+		Title:       e.Name,
+		Description: e.Description,
+		Version:     e.Version,
+		Type:        e.Rules.Type,
+		Properties:  e.Rules.Properties,
+		Required:    e.Rules.Required,
+		EventExtra:  e.Extra,
+		Extra:       e.Rules.Extra,
+	}
+}
+
+func (f eventFile) event() Event {
+	return Event{
+		Name:        f.Title,
+		Description: f.Description,
+		Version:     f.Version,
+		Extra:       f.EventExtra,
+		Rules: Rules{
+			Schema:     f.Schema,
+			Type:       f.Type,
+			Properties: f.Properties,
+			Required:   f.Required,
+			Extra:      f.Extra,
+		},
+	}
+}
+
+// ExportTrackingPlan writes a tracking plan to dir so that it can be kept in
+// version control. The directory contains a tracking-plan manifest, one file
+// each for the global, identify and group rules and one JSON Schema file per
+// event in the events directory. Stale files of a previous export are removed.
+func ExportTrackingPlan(tp TrackingPlan, dir string, format TrackingPlanFormat) error {
+	if format != TrackingPlanFormatYAML && format != TrackingPlanFormatJSON {
+		return errors.Errorf("unknown tracking plan format %q", format)
+	}
+	eventsDir := filepath.Join(dir, trackingPlanEventsDir)
+	if err := os.MkdirAll(eventsDir, 0755); err != nil {
+		return errors.Wrap(err, "creating tracking plan directory failed")
+	}
+
+	manifest := trackingPlanManifest{Name: tp.Name, DisplayName: tp.DisplayName}
+	written := map[string]bool{}
+	for _, e := range tp.Rules.Events {
+		name := eventFileName(e, written)
+		written[name] = true
+		file := trackingPlanEventsDir + "/" + name + "." + string(format)
+		manifest.Events = append(manifest.Events, file)
+		if err := writeTrackingPlanFile(filepath.Join(dir, file), format, newEventFile(e)); err != nil {
+			return err
+		}
+	}
+
+	rules := map[string]Rules{"global": tp.Rules.Global, "identify": tp.Rules.Identify, "group": tp.Rules.Group}
+	for name, r := range rules {
+		if err := removeTrackingPlanFiles(dir, name); err != nil {
+			return err
+		}
+		if reflect.DeepEqual(r, Rules{}) {
+			continue
+		}
+		if err := writeTrackingPlanFile(filepath.Join(dir, name+"."+string(format)), format, r); err != nil {
+			return err
+		}
+	}
+
+	if err := removeTrackingPlanFiles(dir, trackingPlanManifestName); err != nil {
+		return err
+	}
+	if err := writeTrackingPlanFile(filepath.Join(dir, trackingPlanManifestName+"."+string(format)), format, manifest); err != nil {
+		return err
+	}
+
+	// Remove the event files of events that no longer exist.
+	keep := map[string]bool{}
+	for _, file := range manifest.Events {
+		keep[filepath.Join(dir, file)] = true
+	}
+	stale, err := trackingPlanFiles(eventsDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range stale {
+		if !keep[file] {
+			if err := os.Remove(file); err != nil {
+				return errors.Wrapf(err, "removing stale event file %s failed", file)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ImportTrackingPlan reads a tracking plan written by ExportTrackingPlan. YAML
+// and JSON files may be mixed. Event files missing from the manifest are
+// appended in file name order, so new events only need a new file.
+func ImportTrackingPlan(dir string) (TrackingPlan, error) {
+	var tp TrackingPlan
+	var manifest trackingPlanManifest
+	found, err := readTrackingPlanFile(dir, trackingPlanManifestName, &manifest)
+	if err != nil {
+		return tp, err
+	}
+	if !found {
+		return tp, errors.Errorf("no %s.yaml or %s.json found in %s", trackingPlanManifestName, trackingPlanManifestName, dir)
+	}
+	tp.Name = manifest.Name
+	tp.DisplayName = manifest.DisplayName
+
+	for name, r := range map[string]*Rules{"global": &tp.Rules.Global, "identify": &tp.Rules.Identify, "group": &tp.Rules.Group} {
+		if _, err := readTrackingPlanFile(dir, name, r); err != nil {
+			return tp, err
+		}
+	}
+
+	files := make([]string, 0, len(manifest.Events))
+	listed := map[string]bool{}
+	for _, file := range manifest.Events {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		files = append(files, path)
+		listed[path] = true
+	}
+	others, err := trackingPlanFiles(filepath.Join(dir, trackingPlanEventsDir))
+	if err != nil {
+		return tp, err
+	}
+	for _, path := range others {
+		if !listed[path] {
+			files = append(files, path)
+		}
+	}
+
+	for _, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return tp, errors.Wrap(err, "reading event file failed")
+		}
+		var f eventFile
+		if err := decodeTrackingPlanFile(path, data, &f); err != nil {
+			return tp, err
+		}
+		if f.Title == "" {
+			return tp, errors.Errorf("event file %s has no title", path)
+		}
+		tp.Rules.Events = append(tp.Rules.Events, f.event())
+	}
+
+	return tp, nil
+}
+
+// eventFileName returns a file name for an event that is not in taken, e.g.
+// "order-completed" or "order-completed-v2".
+func eventFileName(e Event, taken map[string]bool) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(e.Name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		name = "event"
+	}
+	if e.Version != nil && *e.Version > 1 {
+		name = fmt.Sprintf("%s-v%d", name, *e.Version)
+	}
+
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	return unique
+}
+
+func writeTrackingPlanFile(path string, format TrackingPlanFormat, v interface{}) error {
+	var data []byte
+	var err error
+	if format == TrackingPlanFormatYAML {
+		data, err = MarshalYAML(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return errors.Wrapf(err, "encoding %s failed", path)
+	}
+	return errors.Wrapf(ioutil.WriteFile(path, data, 0644), "writing %s failed", path)
+}
+
+// readTrackingPlanFile decodes the file named base in dir, whatever its
+// extension, into v. It reports whether such a file exists.
+func readTrackingPlanFile(dir, base string, v interface{}) (bool, error) {
+	for _, ext := range trackingPlanExtensions {
+		path := filepath.Join(dir, base+ext)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "reading %s failed", path)
+		}
+		return true, decodeTrackingPlanFile(path, data, v)
+	}
+	return false, nil
+}
+
+func decodeTrackingPlanFile(path string, data []byte, v interface{}) error {
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, v)
+	} else {
+		err = UnmarshalYAML(data, v)
+	}
+	return errors.Wrapf(err, "decoding %s failed", path)
+}
+
+func removeTrackingPlanFiles(dir, base string) error {
+	for _, ext := range trackingPlanExtensions {
+		path := filepath.Join(dir, base+ext)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "removing %s failed", path)
+		}
+	}
+	return nil
+}
+
+// trackingPlanFiles lists the YAML and JSON files in dir, sorted by name.
+func trackingPlanFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s failed", dir)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		for _, ext := range trackingPlanExtensions {
+			if strings.EqualFold(filepath.Ext(entry.Name()), ext) {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,169 @@
+package segment
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTrackingPlan returns the plan of testTrackingPlanResponse as it is sent
+// back to the API, i.e. without the empty lists dropped by omitempty.
+func testTrackingPlan(t *testing.T) TrackingPlan {
+	var tp TrackingPlan
+	assert.NoError(t, json.Unmarshal([]byte(testTrackingPlanResponse), &tp))
+	data, err := json.Marshal(tp)
+	assert.NoError(t, err)
+	tp = TrackingPlan{}
+	assert.NoError(t, json.Unmarshal(data, &tp))
+	return tp
+}
+
+func TestTrackingPlanFiles_RoundTrip(t *testing.T) {
+	for _, format := range []TrackingPlanFormat{TrackingPlanFormatYAML, TrackingPlanFormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			expected := testTrackingPlan(t)
+			version := 2
+			v2 := expected.Rules.Events[0]
+			v2.Version = &version
+			expected.Rules.Events = append(expected.Rules.Events, v2)
+
+			assert.NoError(t, ExportTrackingPlan(expected, dir, format))
+
+			files, err := trackingPlanFiles(filepath.Join(dir, "events"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{
+				filepath.Join(dir, "events", "test-event-clicked-v2."+string(format)),
+				filepath.Join(dir, "events", "test-event-clicked."+string(format)),
+			}, files)
+			assert.FileExists(t, filepath.Join(dir, "global."+string(format)))
+			assert.NoFileExists(t, filepath.Join(dir, "identify."+string(format)))
+
+			actual, err := ImportTrackingPlan(dir)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestTrackingPlanFiles_EventFileIsJSONSchema(t *testing.T) {
+	dir := t.TempDir()
+	tp := TrackingPlan{
+		DisplayName: "Test",
+		Rules: RuleSet{Events: []Event{{
+			Name:        "Order Completed",
+			Description: "An order was completed",
+			Rules: Rules{
+				Schema: "http://json-schema.org/draft-07/schema#",
+				Type:   "object",
+				Properties: RuleProperties{
+					Properties: Properties{
+						Type:       "object",
+						Properties: map[string]Property{"order_id": {Type: "string"}},
+						Required:   []string{"order_id"},
+					},
+				},
+			},
+		}}},
+	}
+	assert.NoError(t, ExportTrackingPlan(tp, dir, TrackingPlanFormatJSON))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "events", "order-completed.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "Order Completed",
+		"description": "An order was completed",
+		"type": "object",
+		"properties": {
+			"context": {},
+			"properties": {
+				"type": "object",
+				"properties": {"order_id": {"type": "string"}},
+				"required": ["order_id"]
+			},
+			"traits": {}
+		}
+	}`, string(data))
+
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, "tracking-plan.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"display_name": "Test", "events": ["events/order-completed.json"]}`, string(manifest))
+}
+
+func TestTrackingPlanFiles_RemovesStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	tp := TrackingPlan{DisplayName: "Test", Rules: RuleSet{Events: []Event{{Name: "A"}, {Name: "B"}}}}
+	assert.NoError(t, ExportTrackingPlan(tp, dir, TrackingPlanFormatJSON))
+
+	tp.Rules.Events = tp.Rules.Events[1:]
+	assert.NoError(t, ExportTrackingPlan(tp, dir, TrackingPlanFormatYAML))
+
+	files, err := trackingPlanFiles(filepath.Join(dir, "events"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "events", "b.yaml")}, files)
+	assert.NoFileExists(t, filepath.Join(dir, "tracking-plan.json"))
+
+	actual, err := ImportTrackingPlan(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, tp, actual)
+}
+
+func TestTrackingPlanFiles_ImportUnlistedEvents(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "events"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tracking-plan.yaml"), []byte("display_name: Test\nevents:\n  - events/z.yaml\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "events", "z.yaml"), []byte("title: Z\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "events", "a.json"), []byte(`{"title": "A", "description": "new"}`), 0644))
+
+	tp, err := ImportTrackingPlan(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{{Name: "Z"}, {Name: "A", Description: "new"}}, tp.Rules.Events)
+}
+
+func TestTrackingPlanFiles_ImportErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := ImportTrackingPlan(dir)
+	assert.EqualError(t, err, "no tracking-plan.yaml or tracking-plan.json found in "+dir)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "events"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tracking-plan.yaml"), []byte("display_name: Test\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "events", "a.yaml"), []byte("description: untitled\n"), 0644))
+	_, err = ImportTrackingPlan(dir)
+	assert.EqualError(t, err, "event file "+filepath.Join(dir, "events", "a.yaml")+" has no title")
+}
+
+func TestTrackingPlanFiles_UnknownFormat(t *testing.T) {
+	assert.EqualError(t, ExportTrackingPlan(TrackingPlan{}, t.TempDir(), "xml"), `unknown tracking plan format "xml"`)
+}
+
+func TestTrackingPlanFiles_EventFileName(t *testing.T) {
+	taken := map[string]bool{"order-completed": true}
+	version := 3
+
+	assert.Equal(t, "order-completed-2", eventFileName(Event{Name: "Order Completed"}, taken))
+	assert.Equal(t, "order-completed-v3", eventFileName(Event{Name: "Order Completed", Version: &version}, taken))
+	assert.Equal(t, "user-signed-up", eventFileName(Event{Name: " User  Signed-Up! "}, nil))
+	assert.Equal(t, "event", eventFileName(Event{Name: "!!!"}, nil))
+}
+
+func TestTrackingPlanFiles_UnknownFields(t *testing.T) {
+	var expected TrackingPlan
+	assert.NoError(t, json.Unmarshal([]byte(testUnknownFieldsPlan), &expected))
+	expected.Name = ""
+
+	for _, format := range []TrackingPlanFormat{TrackingPlanFormatYAML, TrackingPlanFormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			assert.NoError(t, ExportTrackingPlan(expected, dir, format))
+
+			actual, err := ImportTrackingPlan(dir)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
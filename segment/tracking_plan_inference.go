@@ -0,0 +1,337 @@
+package segment
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// InferOptions tunes the schemas inferred by a TrackingPlanInferrer
+type InferOptions struct {
+	// MaxEnumValues is the number of distinct values up to which a string
+	// property gets an enum. Defaults to 10; a negative value disables enums.
+	MaxEnumValues int
+	// MinEnumSamples is the number of values a string property needs before
+	// an enum is inferred, so that a few samples do not make an enum of
+	// every value. Defaults to 20.
+	MinEnumSamples int
+	// RequiredRatio is the share of the objects that must have a property
+	// for it to be required. Defaults to 1, i.e. present in all of them.
+	RequiredRatio float64
+}
+
+// Defaults of InferOptions
+const (
+	DefaultMaxEnumValues  = 10
+	DefaultMinEnumSamples = 20
+)
+
+// formats detected on strings, in order of preference
+var inferredFormats = []string{"date-time", "email"}
+
+// TrackingPlanInferrer infers a tracking plan from sample track, identify and
+// group calls. Track calls make one event per name and version, with the
+// schema of their properties; identify and group calls make the schema of
+// the identify and group traits. Context and other calls, such as page, are
+// not considered.
+type TrackingPlanInferrer struct {
+	opts     InferOptions
+	events   map[string]*inferredEvent
+	identify *inferredSchema
+	group    *inferredSchema
+}
+
+type inferredEvent struct {
+	name       string
+	version    int
+	properties *inferredSchema
+}
+
+// NewTrackingPlanInferrer returns an inferrer without samples
+func NewTrackingPlanInferrer(opts InferOptions) *TrackingPlanInferrer {
+	if opts.MaxEnumValues == 0 {
+		opts.MaxEnumValues = DefaultMaxEnumValues
+	}
+	if opts.MinEnumSamples == 0 {
+		opts.MinEnumSamples = DefaultMinEnumSamples
+	}
+	if opts.RequiredRatio == 0 {
+		opts.RequiredRatio = 1
+	}
+	return &TrackingPlanInferrer{opts: opts, events: map[string]*inferredEvent{}}
+}
+
+// AddEvent adds a sample call. It fails for calls without a type and track
+// calls without an event name.
+func (inf *TrackingPlanInferrer) AddEvent(event map[string]interface{}) error {
+	callType, _ := event["type"].(string)
+	switch callType {
+	case "":
+		return errors.New("event has no type")
+	case "track":
+		name, _ := event["event"].(string)
+		if name == "" {
+			return errors.New("track event has no event name")
+		}
+		version := requestedEventVersion(event)
+		key := eventKey(Event{Name: name, Version: &version})
+		e, ok := inf.events[key]
+		if !ok {
+			e = &inferredEvent{name: name, version: version, properties: newInferredSchema()}
+			inf.events[key] = e
+		}
+		e.properties.add(inf.opts, sectionValue(event, "properties"))
+	case "identify":
+		if inf.identify == nil {
+			inf.identify = newInferredSchema()
+		}
+		inf.identify.add(inf.opts, sectionValue(event, "traits"))
+	case "group":
+		if inf.group == nil {
+			inf.group = newInferredSchema()
+		}
+		inf.group.add(inf.opts, sectionValue(event, "traits"))
+	}
+	return nil
+}
+
+// AddEvents adds the calls read from a stream of JSON values, each a single
+// call or an array of calls.
+func (inf *TrackingPlanInferrer) AddEvents(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	n := 0
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "decoding events failed")
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, value := range values {
+			event, ok := value.(map[string]interface{})
+			if !ok {
+				return errors.Errorf("event %d is not an object", n)
+			}
+			if err := inf.AddEvent(event); err != nil {
+				return errors.Wrapf(err, "event %d", n)
+			}
+			n++
+		}
+	}
+}
+
+// TrackingPlan returns the plan inferred from the samples added so far, with
+// events sorted by name and version
+func (inf *TrackingPlanInferrer) TrackingPlan(displayName string) TrackingPlan {
+	tp := TrackingPlan{DisplayName: displayName}
+	if inf.identify != nil {
+		tp.Rules.Identify = inferredRules(RuleProperties{Traits: inf.identify.section(inf.opts)})
+	}
+	if inf.group != nil {
+		tp.Rules.Group = inferredRules(RuleProperties{Traits: inf.group.section(inf.opts)})
+	}
+
+	keys := make([]string, 0, len(inf.events))
+	for key := range inf.events {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := inf.events[keys[i]], inf.events[keys[j]]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return a.version < b.version
+	})
+	for _, key := range keys {
+		e := inf.events[key]
+		event := Event{
+			Name:  e.name,
+			Rules: inferredRules(RuleProperties{Properties: e.properties.section(inf.opts)}),
+		}
+		if e.version > 1 {
+			version := e.version
+			event.Version = &version
+		}
+		tp.Rules.Events = append(tp.Rules.Events, event)
+	}
+	return tp
+}
+
+// InferTrackingPlan infers a tracking plan from a stream of sample calls.
+// See TrackingPlanInferrer.
+func InferTrackingPlan(displayName string, r io.Reader, opts InferOptions) (TrackingPlan, error) {
+	inf := NewTrackingPlanInferrer(opts)
+	if err := inf.AddEvents(r); err != nil {
+		return TrackingPlan{}, err
+	}
+	return inf.TrackingPlan(displayName), nil
+}
+
+func inferredRules(props RuleProperties) Rules {
+	return Rules{Schema: string(DefaultSchemaDraft), Type: "object", Properties: props}
+}
+
+// sectionValue returns the properties or traits of a call, treating a
+// missing section as an empty object
+func sectionValue(event map[string]interface{}, section string) interface{} {
+	if v, ok := event[section]; ok && v != nil {
+		return v
+	}
+	return map[string]interface{}{}
+}
+
+// inferredSchema accumulates the values seen at one place of the samples
+type inferredSchema struct {
+	count int
+	types map[string]int
+
+	// strings counts the string values, formats those matching each format
+	// and values the distinct strings until there are too many for an enum.
+	strings int
+	formats map[string]int
+	values  map[string]bool
+	tooMany bool
+
+	// objects counts the object values and present how many of them have
+	// each property.
+	objects int
+	present map[string]int
+	props   map[string]*inferredSchema
+	items   *inferredSchema
+}
+
+func newInferredSchema() *inferredSchema {
+	return &inferredSchema{types: map[string]int{}, formats: map[string]int{}, values: map[string]bool{}}
+}
+
+func (s *inferredSchema) add(opts InferOptions, value interface{}) {
+	s.count++
+	t := jsonType(value)
+	s.types[t]++
+
+	switch value := value.(type) {
+	case string:
+		s.strings++
+		for _, f := range inferredFormats {
+			if matchesFormat(f, value) {
+				s.formats[f]++
+			}
+		}
+		if !s.tooMany {
+			s.values[value] = true
+			if len(s.values) > opts.MaxEnumValues {
+				s.tooMany = true
+				s.values = nil
+			}
+		}
+	case map[string]interface{}:
+		s.objects++
+		if s.props == nil {
+			s.props = map[string]*inferredSchema{}
+			s.present = map[string]int{}
+		}
+		for name, v := range value {
+			p, ok := s.props[name]
+			if !ok {
+				p = newInferredSchema()
+				s.props[name] = p
+			}
+			p.add(opts, v)
+			s.present[name]++
+		}
+	case []interface{}:
+		for _, v := range value {
+			if s.items == nil {
+				s.items = newInferredSchema()
+			}
+			s.items.add(opts, v)
+		}
+	}
+}
+
+// section returns the schema of a properties or traits section
+func (s *inferredSchema) section(opts InferOptions) Properties {
+	p := s.property(opts)
+	return Properties{Type: "object", Properties: p.Properties, Required: p.Required}
+}
+
+func (s *inferredSchema) property(opts InferOptions) Property {
+	var p Property
+
+	types := make([]string, 0, len(s.types))
+	for t := range s.types {
+		// Integers are numbers too.
+		if t == "integer" && s.types["number"] > 0 {
+			continue
+		}
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	switch len(types) {
+	case 0:
+	case 1:
+		p.Type = types[0]
+	default:
+		list := make([]interface{}, len(types))
+		for i, t := range types {
+			list[i] = t
+		}
+		p.Type = list
+	}
+
+	if s.strings > 0 {
+		for _, f := range inferredFormats {
+			if s.formats[f] == s.strings {
+				format := f
+				p.Format = &format
+				break
+			}
+		}
+		onlyStrings := s.strings+s.types["null"] == s.count
+		if p.Format == nil && onlyStrings && !s.tooMany && opts.MaxEnumValues > 0 && s.strings >= opts.MinEnumSamples {
+			values := make([]string, 0, len(s.values))
+			for v := range s.values {
+				values = append(values, v)
+			}
+			sort.Strings(values)
+			for i := range values {
+				p.Enum = append(p.Enum, &values[i])
+			}
+			if s.types["null"] > 0 {
+				p.Enum = append(p.Enum, nil)
+			}
+		}
+	}
+
+	if s.objects > 0 {
+		p.Properties = map[string]Property{}
+		for _, name := range sortedInferredNames(s.props) {
+			p.Properties[name] = s.props[name].property(opts)
+			if float64(s.present[name]) >= opts.RequiredRatio*float64(s.objects) {
+				p.Required = append(p.Required, name)
+			}
+		}
+	}
+	if s.items != nil {
+		items := s.items.property(opts)
+		p.Items = &items
+	}
+	return p
+}
+
+func sortedInferredNames(m map[string]*inferredSchema) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
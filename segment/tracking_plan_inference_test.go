@@ -0,0 +1,117 @@
+package segment
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackingPlanInference_Events(t *testing.T) {
+	var events []string
+	for i := 0; i < 20; i++ {
+		coupon := `, "coupon": null`
+		if i%2 == 0 {
+			coupon = fmt.Sprintf(`, "coupon": "C%d"`, i)
+		}
+		events = append(events, fmt.Sprintf(`{
+			"type": "track",
+			"event": "Order Completed",
+			"properties": {
+				"order_id": "o_%d",
+				"total": %d.5,
+				"quantity": %d,
+				"currency": "%s",
+				"placed_at": "2020-01-0%dT10:00:00Z",
+				"products": [{"sku": "A", "price": 1}, {"sku": "B"}]
+				%s
+			}
+		}`, i, i, i, []string{"USD", "EUR"}[i%2], i%9+1, coupon))
+	}
+	stream := "[" + strings.Join(events, ",") + "]\n" + `
+		{"type": "track", "event": "Order Completed", "context": {"protocols": {"event_version": 2}}, "properties": {"id": 1}}
+		{"type": "identify", "traits": {"email": "jane@example.com", "age": 30}}
+		{"type": "identify", "traits": {"email": "joe@example.com"}}
+		{"type": "group", "traits": {"name": "Acme"}}
+		{"type": "page", "name": "Home"}
+	`
+
+	tp, err := InferTrackingPlan("Inferred", strings.NewReader(stream), InferOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Inferred", tp.DisplayName)
+
+	assert.Equal(t, Rules{Schema: string(Draft07), Type: "object", Properties: RuleProperties{Traits: Properties{
+		Type:     "object",
+		Required: []string{"email"},
+		Properties: map[string]Property{
+			"age":   {Type: "integer"},
+			"email": {Type: "string", Format: newString("email")},
+		},
+	}}}, tp.Rules.Identify)
+	assert.Equal(t, []string{"name"}, tp.Rules.Group.Properties.Traits.Required)
+
+	assert.Len(t, tp.Rules.Events, 2)
+	assert.Equal(t, "Order Completed", tp.Rules.Events[0].Name)
+	assert.Nil(t, tp.Rules.Events[0].Version)
+	assert.Equal(t, 2, *tp.Rules.Events[1].Version)
+
+	props := tp.Rules.Events[0].Rules.Properties.Properties
+	assert.Equal(t, []string{"coupon", "currency", "order_id", "placed_at", "products", "quantity", "total"}, props.Required)
+	assert.Equal(t, Property{Type: "string"}, props.Properties["order_id"])
+	assert.Equal(t, Property{Type: "number"}, props.Properties["total"])
+	assert.Equal(t, Property{Type: "integer"}, props.Properties["quantity"])
+	assert.Equal(t, Property{Type: "string", Enum: []*string{newString("EUR"), newString("USD")}}, props.Properties["currency"])
+	assert.Equal(t, Property{Type: "string", Format: newString("date-time")}, props.Properties["placed_at"])
+	assert.Equal(t, Property{Type: []interface{}{"null", "string"}}, props.Properties["coupon"])
+	assert.Equal(t, Property{Type: "array", Items: &Property{
+		Type:     "object",
+		Required: []string{"sku"},
+		Properties: map[string]Property{
+			"price": {Type: "integer"},
+			"sku":   {Type: "string", Enum: []*string{newString("A"), newString("B")}},
+		},
+	}}, props.Properties["products"])
+
+	assert.NoError(t, ValidateTrackingPlanSchema(tp))
+	for _, e := range events {
+		violations, err := ValidateEventJSON(tp, []byte(e))
+		assert.NoError(t, err)
+		assert.Empty(t, violations)
+	}
+}
+
+func TestTrackingPlanInference_Options(t *testing.T) {
+	inf := NewTrackingPlanInferrer(InferOptions{MaxEnumValues: 2, MinEnumSamples: 3, RequiredRatio: 0.5})
+	for _, plan := range []interface{}{"free", "pro", "free", nil} {
+		assert.NoError(t, inf.AddEvent(map[string]interface{}{
+			"type": "track", "event": "Signed Up", "properties": map[string]interface{}{"plan": plan},
+		}))
+	}
+	assert.NoError(t, inf.AddEvent(map[string]interface{}{"type": "track", "event": "Signed Up"}))
+
+	props := inf.TrackingPlan("Test").Rules.Events[0].Rules.Properties.Properties
+	assert.Equal(t, Property{Type: []interface{}{"null", "string"}, Enum: []*string{newString("free"), newString("pro"), nil}}, props.Properties["plan"])
+	assert.Equal(t, []string{"plan"}, props.Required)
+
+	// A third value is too many for an enum.
+	assert.NoError(t, inf.AddEvent(map[string]interface{}{
+		"type": "track", "event": "Signed Up", "properties": map[string]interface{}{"plan": "team"},
+	}))
+	props = inf.TrackingPlan("Test").Rules.Events[0].Rules.Properties.Properties
+	assert.Nil(t, props.Properties["plan"].Enum)
+}
+
+func TestTrackingPlanInference_Errors(t *testing.T) {
+	_, err := InferTrackingPlan("Test", strings.NewReader(`{"event": "Signed Up"}`), InferOptions{})
+	assert.EqualError(t, err, "event 0: event has no type")
+
+	_, err = InferTrackingPlan("Test", strings.NewReader(`{"type": "identify"} [{"type": "track"}]`), InferOptions{})
+	assert.EqualError(t, err, "event 1: track event has no event name")
+
+	_, err = InferTrackingPlan("Test", strings.NewReader(`[1]`), InferOptions{})
+	assert.EqualError(t, err, "event 0 is not an object")
+
+	_, err = InferTrackingPlan("Test", strings.NewReader(`{`), InferOptions{})
+	assert.EqualError(t, err, "decoding events failed: unexpected EOF")
+}
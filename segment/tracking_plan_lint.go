@@ -0,0 +1,334 @@
+package segment
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LintSeverity is the severity of a lint finding
+type LintSeverity string
+
+// Severities of lint findings, from most to least severe
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+	LintInfo    LintSeverity = "info"
+)
+
+// PropertyNamingConvention is the expected case of property names
+type PropertyNamingConvention string
+
+// Property naming conventions supported by PropertyNamingRule
+const (
+	SnakeCase PropertyNamingConvention = "snake_case"
+	CamelCase PropertyNamingConvention = "camelCase"
+)
+
+// Names of the built-in lint rules
+const (
+	LintRuleEventNaming         = "event-naming"
+	LintRulePropertyNaming      = "property-naming"
+	LintRulePropertyDescription = "property-description"
+	LintRulePropertyType        = "property-type"
+	LintRuleEmptyEnum           = "empty-enum"
+	LintRuleUndeclaredRequired  = "undeclared-required"
+	LintRuleDuplicateEvent      = "duplicate-event"
+)
+
+// LintFinding is a problem found in a tracking plan by a lint rule
+type LintFinding struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	// Section, Event and Version locate the finding like in TrackingPlanChange
+	Section string `json:"section"`
+	Event   string `json:"event,omitempty"`
+	Version int    `json:"version,omitempty"`
+	// Path is the dotted path of the property, e.g. "properties.products[].sku"
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: ", f.Severity)
+	if f.Section == SectionEvent {
+		fmt.Fprintf(&b, "event %q", f.Event)
+		if f.Version > 1 {
+			fmt.Fprintf(&b, " (v%d)", f.Version)
+		}
+	} else {
+		fmt.Fprintf(&b, "%s rules", f.Section)
+	}
+	if f.Path != "" {
+		fmt.Fprintf(&b, ", %s", f.Path)
+	}
+	fmt.Fprintf(&b, ": %s (%s)", f.Message, f.Rule)
+	return b.String()
+}
+
+// LintFunc checks a tracking plan and returns its findings. The rule name
+// and severity of the findings are filled in by LintTrackingPlan.
+type LintFunc func(tp TrackingPlan) []LintFinding
+
+// LintRule is a named check with the severity of its findings
+type LintRule struct {
+	Name     string
+	Severity LintSeverity
+	Check    LintFunc
+}
+
+// DefaultLintRules returns the built-in rules, expecting Object Action event
+// names and snake_case property names
+func DefaultLintRules() []LintRule {
+	return []LintRule{
+		EventNamingRule(),
+		PropertyNamingRule(SnakeCase),
+		{Name: LintRulePropertyDescription, Severity: LintWarning, Check: lintPropertyDescriptions},
+		{Name: LintRulePropertyType, Severity: LintError, Check: lintPropertyTypes},
+		{Name: LintRuleEmptyEnum, Severity: LintError, Check: lintEmptyEnums},
+		{Name: LintRuleUndeclaredRequired, Severity: LintError, Check: lintUndeclaredRequired},
+		{Name: LintRuleDuplicateEvent, Severity: LintError, Check: lintDuplicateEvents},
+	}
+}
+
+// LintTrackingPlan runs lint rules over a tracking plan and returns the
+// findings sorted by location. The default rules are used when none are
+// given; custom rules can be added to or replace them:
+//
+//	rules := append(segment.DefaultLintRules(), segment.LintRule{
+//		Name: "no-pii", Severity: segment.LintError, Check: noPII,
+//	})
+//	findings := segment.LintTrackingPlan(tp, rules...)
+func LintTrackingPlan(tp TrackingPlan, rules ...LintRule) []LintFinding {
+	if len(rules) == 0 {
+		rules = DefaultLintRules()
+	}
+
+	var findings []LintFinding
+	for _, rule := range rules {
+		for _, f := range rule.Check(tp) {
+			f.Rule = rule.Name
+			f.Severity = rule.Severity
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Section != b.Section {
+			return sectionOrder(a.Section) < sectionOrder(b.Section)
+		}
+		if a.Event != b.Event {
+			return a.Event < b.Event
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Path < b.Path
+	})
+	return findings
+}
+
+// HasLintErrors reports whether any finding has the error severity
+func HasLintErrors(findings []LintFinding) bool {
+	for _, f := range findings {
+		if f.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+func sectionOrder(section string) int {
+	for i, s := range []string{SectionGlobal, SectionIdentify, SectionGroup, SectionEvent} {
+		if s == section {
+			return i
+		}
+	}
+	return -1
+}
+
+var (
+	titleCaseWord = regexp.MustCompile(`^[A-Z0-9][A-Za-z0-9]*$`)
+	snakeCaseName = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	camelCaseName = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+)
+
+// EventNamingRule checks that event names follow the Object Action
+// convention in Title Case, e.g. "Order Completed"
+func EventNamingRule() LintRule {
+	return LintRule{Name: LintRuleEventNaming, Severity: LintWarning, Check: func(tp TrackingPlan) []LintFinding {
+		var findings []LintFinding
+		for _, e := range tp.Rules.Events {
+			words := strings.Split(e.Name, " ")
+			ok := len(words) >= 2
+			for _, w := range words {
+				ok = ok && titleCaseWord.MatchString(w)
+			}
+			if !ok {
+				f := eventFinding(e, "")
+				f.Message = fmt.Sprintf("event name %q is not Object Action in Title Case, e.g. \"Order Completed\"", e.Name)
+				findings = append(findings, f)
+			}
+		}
+		return findings
+	}}
+}
+
+// specTraits are the paths of the traits reserved by the Segment spec for
+// identify and group calls. They are named in camelCase by the spec, so they
+// are exempt from the property naming convention.
+var specTraits = map[string]map[string]bool{
+	SectionIdentify: stringSet([]string{
+		"traits.address", "traits.address.city", "traits.address.country", "traits.address.postalCode",
+		"traits.address.state", "traits.address.street", "traits.age", "traits.avatar", "traits.birthday",
+		"traits.company", "traits.company.employee_count", "traits.company.id", "traits.company.industry",
+		"traits.company.name", "traits.company.plan", "traits.createdAt", "traits.description",
+		"traits.email", "traits.firstName", "traits.gender", "traits.id", "traits.lastName", "traits.name",
+		"traits.phone", "traits.title", "traits.username", "traits.website",
+	}),
+	SectionGroup: stringSet([]string{
+		"traits.address", "traits.address.city", "traits.address.country", "traits.address.postalCode",
+		"traits.address.state", "traits.address.street", "traits.avatar", "traits.createdAt",
+		"traits.description", "traits.email", "traits.employees", "traits.id", "traits.industry",
+		"traits.name", "traits.phone", "traits.plan", "traits.website",
+	}),
+}
+
+// PropertyNamingRule checks that all property names follow a convention,
+// except for the traits reserved by the Segment spec, e.g. "firstName"
+func PropertyNamingRule(convention PropertyNamingConvention) LintRule {
+	re := snakeCaseName
+	if convention == CamelCase {
+		re = camelCaseName
+	}
+	return LintRule{Name: LintRulePropertyNaming, Severity: LintWarning, Check: func(tp TrackingPlan) []LintFinding {
+		var findings []LintFinding
+		walkTrackingPlan(tp, func(loc LintFinding, name string, p Property) {
+			if name != "" && !re.MatchString(name) && !specTraits[loc.Section][loc.Path] {
+				loc.Message = fmt.Sprintf("property name %q is not %s", name, convention)
+				findings = append(findings, loc)
+			}
+		}, nil)
+		return findings
+	}}
+}
+
+func lintPropertyDescriptions(tp TrackingPlan) []LintFinding {
+	var findings []LintFinding
+	walkTrackingPlan(tp, func(loc LintFinding, name string, p Property) {
+		if name != "" && strings.TrimSpace(p.Description) == "" {
+			loc.Message = "property has no description"
+			findings = append(findings, loc)
+		}
+	}, nil)
+	return findings
+}
+
+func lintPropertyTypes(tp TrackingPlan) []LintFinding {
+	var findings []LintFinding
+	walkTrackingPlan(tp, func(loc LintFinding, name string, p Property) {
+		// Combinators, references and constants constrain the type themselves.
+		untyped := p.Ref == "" && p.Const == nil && len(p.OneOf) == 0 && len(p.AnyOf) == 0 && len(p.AllOf) == 0
+		if untyped && len(propertyTypes(p.Type)) == 0 {
+			loc.Message = "property has no type"
+			findings = append(findings, loc)
+		}
+	}, nil)
+	return findings
+}
+
+func lintEmptyEnums(tp TrackingPlan) []LintFinding {
+	var findings []LintFinding
+	walkTrackingPlan(tp, func(loc LintFinding, name string, p Property) {
+		if p.Enum != nil && len(p.Enum) == 0 {
+			loc.Message = "enum has no values, so no value is valid"
+			findings = append(findings, loc)
+		}
+	}, nil)
+	return findings
+}
+
+func lintUndeclaredRequired(tp TrackingPlan) []LintFinding {
+	var findings []LintFinding
+	walkTrackingPlan(tp, nil, func(loc LintFinding, properties map[string]Property, required []string) {
+		for _, name := range required {
+			if _, ok := properties[name]; !ok {
+				f := loc
+				f.Path = joinField(loc.Path, name)
+				f.Message = fmt.Sprintf("required property %q is not declared", name)
+				findings = append(findings, f)
+			}
+		}
+	})
+	return findings
+}
+
+func lintDuplicateEvents(tp TrackingPlan) []LintFinding {
+	var findings []LintFinding
+	seen := map[string]bool{}
+	for _, e := range tp.Rules.Events {
+		if seen[eventKey(e)] {
+			f := eventFinding(e, "")
+			f.Message = "event is defined more than once"
+			findings = append(findings, f)
+		}
+		seen[eventKey(e)] = true
+	}
+	return findings
+}
+
+func eventFinding(e Event, path string) LintFinding {
+	return LintFinding{Section: SectionEvent, Event: e.Name, Version: eventVersion(e), Path: path}
+}
+
+// walkTrackingPlan calls property for every property of the plan, with its
+// name ("" for array items), and object for every object with its declared
+// and required properties. The LintFinding passed holds the location.
+func walkTrackingPlan(tp TrackingPlan, property func(loc LintFinding, name string, p Property), object func(loc LintFinding, properties map[string]Property, required []string)) {
+	w := lintWalker{property: property, object: object}
+	w.rules(LintFinding{Section: SectionGlobal}, tp.Rules.Global)
+	w.rules(LintFinding{Section: SectionIdentify}, tp.Rules.Identify)
+	w.rules(LintFinding{Section: SectionGroup}, tp.Rules.Group)
+	for _, e := range tp.Rules.Events {
+		w.rules(eventFinding(e, ""), e.Rules)
+	}
+}
+
+type lintWalker struct {
+	property func(loc LintFinding, name string, p Property)
+	object   func(loc LintFinding, properties map[string]Property, required []string)
+}
+
+func (w lintWalker) rules(loc LintFinding, r Rules) {
+	for _, s := range ruleSections(r) {
+		loc.Path = s.name
+		w.properties(loc, s.p.Properties, s.p.Required)
+	}
+}
+
+func (w lintWalker) properties(loc LintFinding, properties map[string]Property, required []string) {
+	if w.object != nil {
+		w.object(loc, properties, required)
+	}
+	for _, name := range propertyNames(properties) {
+		child := loc
+		child.Path = joinField(loc.Path, name)
+		w.value(child, name, properties[name])
+	}
+}
+
+func (w lintWalker) value(loc LintFinding, name string, p Property) {
+	if w.property != nil {
+		w.property(loc, name, p)
+	}
+	if p.Items != nil {
+		items := loc
+		items.Path += "[]"
+		w.value(items, "", *p.Items)
+	}
+	if len(p.Properties) > 0 || len(p.Required) > 0 {
+		w.properties(loc, p.Properties, p.Required)
+	}
+}
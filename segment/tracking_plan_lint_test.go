@@ -0,0 +1,113 @@
+package segment
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lintTestPlan() TrackingPlan {
+	return TrackingPlan{Rules: RuleSet{
+		Identify: Rules{Properties: RuleProperties{Traits: Properties{
+			Properties: map[string]Property{"email": {Type: "string", Description: "email address"}},
+		}}},
+		Events: []Event{{
+			Name: "Order Completed",
+			Rules: Rules{Properties: RuleProperties{Properties: Properties{
+				Required: []string{"order_id"},
+				Properties: map[string]Property{
+					"order_id": {Type: "string", Description: "id of the order"},
+					"products": {Type: "array", Description: "products in the order", Items: &Property{
+						Type:       "object",
+						Properties: map[string]Property{"sku": {Type: "string", Description: "sku of the product"}},
+						Required:   []string{"sku"},
+					}},
+				},
+			}}},
+		}},
+	}}
+}
+
+func lintMessages(findings []LintFinding) []string {
+	var messages []string
+	for _, f := range findings {
+		messages = append(messages, f.String())
+	}
+	return messages
+}
+
+func TestLint_CleanPlan(t *testing.T) {
+	assert.Empty(t, LintTrackingPlan(lintTestPlan()))
+	assert.Empty(t, LintTrackingPlan(testTrackingPlan(t), LintRule{Name: LintRuleDuplicateEvent, Severity: LintError, Check: lintDuplicateEvents}))
+}
+
+func TestLint_DefaultRules(t *testing.T) {
+	tp := lintTestPlan()
+	tp.Rules.Identify.Properties.Traits.Properties["favoriteColor"] = Property{Type: "string", Description: "favorite color"}
+	order := tp.Rules.Events[0].Rules.Properties.Properties
+	order.Required = append(order.Required, "total")
+	order.Properties["currency"] = Property{Type: "string", Enum: []*string{}}
+	order.Properties["coupon"] = Property{Description: "coupon code"}
+	order.Properties["products"].Items.Properties["Name"] = Property{Type: "string", Description: "name"}
+	tp.Rules.Events[0].Rules.Properties.Properties = order
+	tp.Rules.Events = append(tp.Rules.Events, Event{Name: "signup"}, Event{Name: "Order Completed"})
+
+	findings := LintTrackingPlan(tp)
+	assert.Equal(t, []string{
+		`warning: identify rules, traits.favoriteColor: property name "favoriteColor" is not snake_case (property-naming)`,
+		`error: event "Order Completed": event is defined more than once (duplicate-event)`,
+		`error: event "Order Completed", properties.coupon: property has no type (property-type)`,
+		`warning: event "Order Completed", properties.currency: property has no description (property-description)`,
+		`error: event "Order Completed", properties.currency: enum has no values, so no value is valid (empty-enum)`,
+		`warning: event "Order Completed", properties.products[].Name: property name "Name" is not snake_case (property-naming)`,
+		`error: event "Order Completed", properties.total: required property "total" is not declared (undeclared-required)`,
+		`warning: event "signup": event name "signup" is not Object Action in Title Case, e.g. "Order Completed" (event-naming)`,
+	}, lintMessages(findings))
+	assert.True(t, HasLintErrors(findings))
+}
+
+func TestLint_SpecTraits(t *testing.T) {
+	tp := lintTestPlan()
+	traits := tp.Rules.Identify.Properties.Traits.Properties
+	traits["firstName"] = Property{Type: "string", Description: "first name"}
+	traits["createdAt"] = Property{Type: "string", Description: "signup date"}
+	traits["address"] = Property{Type: "object", Description: "postal address", Properties: map[string]Property{
+		"postalCode": {Type: "string", Description: "postal code"},
+		"buildingNo": {Type: "string", Description: "building number"},
+	}}
+	tp.Rules.Group.Properties.Traits.Properties = map[string]Property{
+		"createdAt": {Type: "string", Description: "creation date"},
+		"firstName": {Type: "string", Description: "first name"},
+	}
+	tp.Rules.Events[0].Rules.Properties.Properties.Properties["createdAt"] = Property{Type: "string", Description: "creation date"}
+
+	assert.Equal(t, []string{
+		`warning: identify rules, traits.address.buildingNo: property name "buildingNo" is not snake_case (property-naming)`,
+		`warning: group rules, traits.firstName: property name "firstName" is not snake_case (property-naming)`,
+		`warning: event "Order Completed", properties.createdAt: property name "createdAt" is not snake_case (property-naming)`,
+	}, lintMessages(LintTrackingPlan(tp, PropertyNamingRule(SnakeCase))))
+}
+
+func TestLint_CustomRules(t *testing.T) {
+	tp := lintTestPlan()
+	tp.Rules.Identify.Properties.Traits.Properties["firstName"] = Property{Type: "string", Description: "first name"}
+
+	noEmail := LintRule{Name: "no-pii", Severity: LintInfo, Check: func(tp TrackingPlan) []LintFinding {
+		var findings []LintFinding
+		walkTrackingPlan(tp, func(loc LintFinding, name string, p Property) {
+			if strings.Contains(name, "email") {
+				loc.Message = "property may contain PII"
+				findings = append(findings, loc)
+			}
+		}, nil)
+		return findings
+	}}
+
+	findings := LintTrackingPlan(tp, PropertyNamingRule(CamelCase), noEmail)
+	assert.Equal(t, []string{
+		`info: identify rules, traits.email: property may contain PII (no-pii)`,
+		`warning: event "Order Completed", properties.order_id: property name "order_id" is not camelCase (property-naming)`,
+	}, lintMessages(findings))
+	assert.False(t, HasLintErrors(findings))
+}
@@ -3,6 +3,7 @@ package segment
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -62,11 +63,6 @@ type SourceConfig struct {
 	CommonGroupEventOnViolations        CommonEventSettings `json:"common_group_event_on_violations,omitempty"`
 }
 
-type sourceConfigUpdateRequest struct {
-	Config     SourceConfig `json:"schema_config,omitempty"`
-	UpdateMask UpdateMask   `json:"update_mask,omitempty"`
-}
-
 // LibraryConfig contains information about a source's library
 type LibraryConfig struct {
 	MetricsEnabled       bool   `json:"metrics_enabled,omitempty"`
@@ -109,6 +105,29 @@ type destinationFilterCRURequest struct {
 	UpdateMask UpdateMask        `json:"update_mask"`
 }
 
+// DestinationFilterField is a field of a DestinationFilter that can be
+// updated, named as in the API
+type DestinationFilterField string
+
+// Fields of a DestinationFilter that can be updated
+const (
+	DestinationFilterFieldConditions  DestinationFilterField = "if"
+	DestinationFilterFieldActions     DestinationFilterField = "actions"
+	DestinationFilterFieldTitle       DestinationFilterField = "title"
+	DestinationFilterFieldDescription DestinationFilterField = "description"
+	DestinationFilterFieldEnabled     DestinationFilterField = "enabled"
+)
+
+// DestinationFilterFields lists every field of a DestinationFilter that can
+// be updated
+var DestinationFilterFields = []DestinationFilterField{
+	DestinationFilterFieldConditions,
+	DestinationFilterFieldActions,
+	DestinationFilterFieldTitle,
+	DestinationFilterFieldDescription,
+	DestinationFilterFieldEnabled,
+}
+
 type DestinationFilter struct {
 	Name        string `json:"name"`
 	Title       string `json:"title"`
@@ -273,9 +292,24 @@ type destinationCreateRequest struct {
 	Destination Destination `json:"destination,omitempty"`
 }
 
-type destinationUpdateRequest struct {
-	Destination Destination `json:"destination,omitempty"`
-	UpdateMask  UpdateMask  `json:"update_mask,omitempty"`
+// DestinationField is a field of a Destination that can be updated, named as
+// in the API
+type DestinationField string
+
+// Fields of a Destination that can be updated
+const (
+	DestinationFieldEnabled        DestinationField = "enabled"
+	DestinationFieldConfig         DestinationField = "config"
+	DestinationFieldDisplayName    DestinationField = "display_name"
+	DestinationFieldConnectionMode DestinationField = "connection_mode"
+)
+
+// DestinationFields lists every field of a Destination that can be updated
+var DestinationFields = []DestinationField{
+	DestinationFieldEnabled,
+	DestinationFieldConfig,
+	DestinationFieldDisplayName,
+	DestinationFieldConnectionMode,
 }
 
 // TrackingPlans is a list of tracking plans
@@ -306,6 +340,8 @@ type Rules struct {
 	Type       string         `json:"type,omitempty"`
 	Properties RuleProperties `json:"properties,omitempty"`
 	Required   []string       `json:"required,omitempty"`
+	// Extra holds the fields not modeled above, see Property
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // RuleProperties contains the different properties of a specific type of rules
@@ -320,9 +356,20 @@ type Properties struct {
 	Properties map[string]Property `json:"properties,omitempty"`
 	Required   []string            `json:"required,omitempty"`
 	Type       string              `json:"type,omitempty"`
-}
-
-// Property contains information of a single property
+	// Extra holds the fields not modeled above, see Property
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Property contains information of a single property.
+//
+// ExclusiveMinimum and ExclusiveMaximum are booleans qualifying Minimum and
+// Maximum in draft-04 and numbers in later drafts. Const is kept as raw JSON
+// so that any value, including null, survives a round trip.
+//
+// Extra holds the JSON Schema keywords not modeled by the other fields, such
+// as examples or dependencies. They are decoded and encoded as they are, so
+// that reading and updating a tracking plan keeps the ones set in the Segment
+// UI. Extra is nil when there are none.
 type Property struct {
 	Description          string              `json:"description,omitempty"`
 	Type                 interface{}         `json:"type,omitempty"`
@@ -336,6 +383,19 @@ type Property struct {
 	AdditionalProperties interface{}         `json:"additionalProperties,omitempty"`
 	Required             []string            `json:"required,omitempty"`
 	Enum                 []*string           `json:"enum,omitempty"`
+	Minimum              *float64            `json:"minimum,omitempty"`
+	Maximum              *float64            `json:"maximum,omitempty"`
+	ExclusiveMinimum     interface{}         `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     interface{}         `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int                `json:"minLength,omitempty"`
+	MaxLength            *int                `json:"maxLength,omitempty"`
+	OneOf                []Property          `json:"oneOf,omitempty"`
+	AnyOf                []Property          `json:"anyOf,omitempty"`
+	AllOf                []Property          `json:"allOf,omitempty"`
+	Ref                  string              `json:"$ref,omitempty"`
+	Const                json.RawMessage     `json:"const,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // Event contains information about a single event of the tracking plan
@@ -344,16 +404,26 @@ type Event struct {
 	Description string `json:"description,omitempty"`
 	Rules       Rules  `json:"rules,omitempty"`
 	Version     *int   `json:"version,omitempty"`
+	// Extra holds the fields not modeled above, see Property
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type trackingPlanCreateRequest struct {
 	TrackingPlan TrackingPlan `json:"tracking_plan,omitempty"`
 }
 
-type trackingPlanUpdateRequest struct {
-	UpdateMask   UpdateMask   `json:"update_mask,omitempty"`
-	TrackingPlan TrackingPlan `json:"tracking_plan,omitempty"`
-}
+// TrackingPlanField is a field of a TrackingPlan that can be updated, named
+// as in the API
+type TrackingPlanField string
+
+// Fields of a TrackingPlan that can be updated
+const (
+	TrackingPlanFieldDisplayName TrackingPlanField = "display_name"
+	TrackingPlanFieldRules       TrackingPlanField = "rules"
+)
+
+// TrackingPlanFields lists every field of a TrackingPlan that can be updated
+var TrackingPlanFields = []TrackingPlanField{TrackingPlanFieldDisplayName, TrackingPlanFieldRules}
 
 type TrackingPlanSourceConnections struct {
 	Connections []TrackingPlanSourceConnection `json:"connections,omitempty"`
@@ -370,6 +440,76 @@ type trackingPlanSourceConnectionCreateRequest struct {
 	Name string `json:"source_name"`
 }
 
+type trackingPlanSourceConnectionBatchCreateRequest struct {
+	Requests []trackingPlanSourceConnectionCreateRequest `json:"requests"`
+}
+
+// DestinationRecord is a destination of a workspace along with its source
+type DestinationRecord struct {
+	// Source is the name of the source, without the workspace path
+	Source string
+	// Type is the catalog name of the destination, e.g. "amplitude"
+	Type           string
+	Enabled        bool
+	ConnectionMode string
+	Destination    Destination
+}
+
+// DestinationQuery selects destinations in ListAllDestinations. Zero fields
+// match every destination.
+type DestinationQuery struct {
+	// Type is the catalog name of the destinations, e.g. "amplitude"
+	Type string
+	// Enabled, when set, matches destinations that are enabled or disabled
+	Enabled *bool
+	// Config maps setting names, e.g. "apiKey", to the values the
+	// destinations must have
+	Config map[string]interface{}
+}
+
+// SourceTrackingPlans maps the sources of a workspace to the tracking plans
+// they are connected to
+type SourceTrackingPlans struct {
+	// Plans maps the name of each connected source, without the workspace
+	// path, to its tracking plan. Plans are as returned by ListTrackingPlans.
+	Plans map[string]TrackingPlan
+	// Unconnected are the names of the sources without a tracking plan
+	Unconnected []string
+}
+
+// TrackingPlanSourceConnectionResult is the outcome of connecting a source to,
+// or disconnecting it from, a tracking plan
+type TrackingPlanSourceConnectionResult struct {
+	// Source is the name of the source, without the workspace path
+	Source string
+	// Connection is set when the source was connected
+	Connection *TrackingPlanSourceConnection
+	Err        error
+}
+
+// TrackingPlanSourcesSync summarizes the changes made by SyncTrackingPlanSources
+type TrackingPlanSourcesSync struct {
+	Connected    []string
+	Disconnected []string
+	Failed       []TrackingPlanSourceConnectionResult
+}
+
+// BatchConnectionError is returned when some of the sources of a batch could
+// not be connected or disconnected
+type BatchConnectionError struct {
+	// Total is the number of sources in the batch
+	Total  int
+	Failed []TrackingPlanSourceConnectionResult
+}
+
+func (err *BatchConnectionError) Error() string {
+	failures := make([]string, len(err.Failed))
+	for i, r := range err.Failed {
+		failures[i] = fmt.Sprintf("%s: %v", r.Source, r.Err)
+	}
+	return fmt.Sprintf("%d of %d sources failed: %s", len(err.Failed), err.Total, strings.Join(failures, "; "))
+}
+
 type SegmentApiError struct {
 	Message string `json:"error,omitempty"`
 	Code    int    `json:"code,omitempty"`
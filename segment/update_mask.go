@@ -0,0 +1,146 @@
+package segment
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// updateFields selects the fields of v, a struct, by their JSON names for an
+// update request. Only the allowed names can be updated. The values are kept
+// even when zero, where omitempty would drop them, so that updates can turn
+// settings off and clear them. The mask has the path of each field under
+// prefix.
+func updateFields(kind, prefix string, v interface{}, names, allowed []string) (map[string]interface{}, UpdateMask, error) {
+	var mask UpdateMask
+	if len(names) == 0 {
+		return nil, mask, errors.Errorf("no %s fields to update", kind)
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	index := jsonFieldIndex(rv.Type())
+	isAllowed := stringSet(allowed)
+	fields := map[string]interface{}{}
+	for _, name := range names {
+		i, ok := index[name]
+		if !ok || !isAllowed[name] {
+			return nil, mask, errors.Errorf("unknown %s field %q", kind, name)
+		}
+		if _, ok := fields[name]; ok {
+			continue
+		}
+		fields[name] = rv.Field(i).Interface()
+		mask.Paths = append(mask.Paths, joinField(prefix, name))
+	}
+	return fields, mask, nil
+}
+
+// DiffUpdateMask returns the update mask of the fields that differ between
+// original and modified, two structs of the same type, with paths made of
+// their JSON names under prefix, e.g. "destination.enabled". Fields are
+// compared by their JSON encoding, with null and empty values being equal.
+// The Update methods derive their update masks this way.
+func DiffUpdateMask(prefix string, original, modified interface{}) (UpdateMask, error) {
+	names, err := changedFields(original, modified, nil)
+	if err != nil {
+		return UpdateMask{}, err
+	}
+	mask := UpdateMask{}
+	for _, name := range names {
+		mask.Paths = append(mask.Paths, joinField(prefix, name))
+	}
+	return mask, nil
+}
+
+// changedFields returns the JSON names of the fields that differ between two
+// structs of the same type, in field order. With allowed, only those fields
+// are compared.
+func changedFields(original, modified interface{}, allowed []string) ([]string, error) {
+	a, b := reflect.Indirect(reflect.ValueOf(original)), reflect.Indirect(reflect.ValueOf(modified))
+	if a.Kind() != reflect.Struct || a.Type() != b.Type() {
+		return nil, errors.Errorf("cannot diff %T and %T", original, modified)
+	}
+
+	index := jsonFieldIndex(a.Type())
+	names := make([]string, 0, len(index))
+	for name := range index {
+		if allowed == nil || stringSet(allowed)[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return index[names[i]] < index[names[j]] })
+
+	var changed []string
+	for _, name := range names {
+		equal, err := jsonEqual(a.Field(index[name]).Interface(), b.Field(index[name]).Interface())
+		if err != nil {
+			return nil, errors.Wrapf(err, "comparing field %s failed", name)
+		}
+		if !equal {
+			changed = append(changed, name)
+		}
+	}
+	return changed, nil
+}
+
+// jsonEqual compares the JSON encodings of two values, treating null, empty
+// arrays and empty objects as equal
+func jsonEqual(a, b interface{}) (bool, error) {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(x, y) || (emptyJSON(x) && emptyJSON(y)), nil
+}
+
+func emptyJSON(data []byte) bool {
+	switch string(data) {
+	case "null", "[]", "{}":
+		return true
+	}
+	return false
+}
+
+// fieldNames converts a slice of field names of a string type, such as
+// []DestinationField, to strings
+func fieldNames(fields interface{}) []string {
+	v := reflect.ValueOf(fields)
+	names := make([]string, v.Len())
+	for i := range names {
+		names[i] = v.Index(i).String()
+	}
+	return names
+}
+
+// updateRequest is the body of an update request: the updated fields of a
+// resource under key, e.g. "destination", and their update mask
+func updateRequest(key string, fields map[string]interface{}, mask UpdateMask) map[string]interface{} {
+	return map[string]interface{}{key: fields, "update_mask": mask}
+}
+
+// jsonFieldIndex maps the JSON names of the fields of a struct type to their
+// index
+func jsonFieldIndex(t reflect.Type) map[string]int {
+	index := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		index[name] = i
+	}
+	return index
+}
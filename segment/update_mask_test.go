@@ -0,0 +1,189 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateMask_UpdateFields(t *testing.T) {
+	dest := Destination{Name: "js/ga", Enabled: false, Configs: []DestinationConfig{{Name: "sampleRate", Value: 0}}}
+	allowed := fieldNames(DestinationFields)
+
+	fields, mask, err := updateFields("destination", "destination", dest, []string{"enabled", "config", "enabled"}, allowed)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"enabled": false, "config": dest.Configs}, fields)
+	assert.Equal(t, UpdateMask{Paths: []string{"destination.enabled", "destination.config"}}, mask)
+
+	data, err := json.Marshal(updateRequest("destination", fields, mask))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"destination": {"enabled": false, "config": [{"name": "sampleRate", "value": 0}]},
+		"update_mask": {"paths": ["destination.enabled", "destination.config"]}
+	}`, string(data))
+
+	_, _, err = updateFields("destination", "destination", dest, []string{"name"}, allowed)
+	assert.EqualError(t, err, `unknown destination field "name"`)
+	_, _, err = updateFields("destination", "destination", dest, []string{"enabled_"}, allowed)
+	assert.EqualError(t, err, `unknown destination field "enabled_"`)
+	_, _, err = updateFields("destination", "destination", dest, nil, allowed)
+	assert.EqualError(t, err, "no destination fields to update")
+
+	_, mask, err = updateFields("destination filter", "", DestinationFilter{}, []string{"if"}, fieldNames(DestinationFilterFields))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"if"}, mask.Paths)
+}
+
+// recordRequest registers a handler that decodes request bodies into body
+// and replies with response. GET requests are answered without touching body.
+func recordRequest(endpoint, response string, body *map[string]interface{}) {
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, response)
+			return
+		}
+		*body = nil
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, response)
+	})
+}
+
+func TestUpdateMask_DisableDestination(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var body map[string]interface{}
+	recordRequest(fmt.Sprintf("/%s/%s/%s/%s/js/%s/google-analytics", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint),
+		`{"name": "workspaces/test-workspace/sources/js/destinations/google-analytics", "enabled": true}`, &body)
+
+	// Only the enabled flag differs from the stored destination
+	_, err := client.UpdateDestination("js", "google-analytics", false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"destination": map[string]interface{}{
+			"name":    "workspaces/test-workspace/sources/js/destinations/google-analytics",
+			"enabled": false,
+		},
+		"update_mask": map[string]interface{}{"paths": []interface{}{"destination.enabled"}},
+	}, body)
+
+	// Nothing is sent when nothing differs
+	body = nil
+	_, err = client.UpdateDestination("js", "google-analytics", true, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, body)
+
+	_, err = client.UpdateDestinationFields("js", "google-analytics", Destination{Enabled: false}, DestinationFieldEnabled)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"destination": map[string]interface{}{
+			"name":    "workspaces/test-workspace/sources/js/destinations/google-analytics",
+			"enabled": false,
+		},
+		"update_mask": map[string]interface{}{"paths": []interface{}{"destination.enabled"}},
+	}, body)
+}
+
+func TestUpdateMask_DisableDestinationFilter(t *testing.T) {
+	setup()
+	defer teardown()
+
+	name := fmt.Sprintf("%s/%s/%s/js/%s/google-analytics/%s/df_123", WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint, DestinationFiltersEndpoint)
+	var body map[string]interface{}
+	recordRequest(fmt.Sprintf("/%s/%s", apiVersion, name), `{"enabled": false}`, &body)
+
+	filter, err := client.UpdateDestinationFilterFields("js", "google-analytics", DestinationFilter{Name: name, IsEnabled: false}, DestinationFilterFieldEnabled)
+	assert.NoError(t, err)
+	assert.False(t, filter.IsEnabled)
+	assert.Equal(t, map[string]interface{}{
+		"filter":      map[string]interface{}{"name": name, "enabled": false},
+		"update_mask": map[string]interface{}{"paths": []interface{}{"enabled"}},
+	}, body)
+}
+
+func TestUpdateMask_RenameTrackingPlan(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var body map[string]interface{}
+	recordRequest(fmt.Sprintf("/%s/%s/%s/%s/%s", apiVersion, WorkspacesEndpoint, testWorkspace, TrackingPlanEndpoint, testTrackingPlanID),
+		`{"display_name": "Renamed"}`, &body)
+
+	tp, err := client.UpdateTrackingPlanFields(testTrackingPlanID, TrackingPlan{DisplayName: "Renamed"}, TrackingPlanFieldDisplayName)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", tp.DisplayName)
+	assert.Equal(t, map[string]interface{}{
+		"tracking_plan": map[string]interface{}{"display_name": "Renamed"},
+		"update_mask":   map[string]interface{}{"paths": []interface{}{"tracking_plan.display_name"}},
+	}, body)
+
+	_, err = client.UpdateTrackingPlanFields(testTrackingPlanID, TrackingPlan{}, "update_time")
+	assert.EqualError(t, err, `unknown tracking plan field "update_time"`)
+}
+
+func TestUpdateMask_DiffUpdateMask(t *testing.T) {
+	original := Destination{Name: "js/ga", Enabled: true, Configs: []DestinationConfig{{Name: "sampleRate", Value: 10}}}
+
+	modified := original
+	modified.Enabled = false
+	mask, err := DiffUpdateMask("destination", original, modified)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"destination.enabled"}, mask.Paths)
+
+	modified.Configs = []DestinationConfig{{Name: "sampleRate", Value: 20}}
+	mask, err = DiffUpdateMask("", original, &modified)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"enabled", "config"}, mask.Paths)
+
+	// Missing and empty lists are the same to the API
+	mask, err = DiffUpdateMask("destination", Destination{}, Destination{Configs: []DestinationConfig{}})
+	assert.NoError(t, err)
+	assert.Empty(t, mask.Paths)
+
+	_, err = DiffUpdateMask("destination", original, TrackingPlan{})
+	assert.EqualError(t, err, "cannot diff segment.Destination and segment.TrackingPlan")
+}
+
+func TestUpdateMask_IfUnchangedSendsChangedFields(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var body map[string]interface{}
+	updates := 0
+	mux.HandleFunc(fmt.Sprintf("/%s/%s/%s/%s/js/%s/google-analytics", apiVersion, WorkspacesEndpoint, testWorkspace, SourceEndpoint, DestinationEndpoint),
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPatch {
+				updates++
+				body = nil
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			}
+			fmt.Fprint(w, `{
+				"name": "workspaces/test-workspace/sources/js/destinations/google-analytics",
+				"enabled": true,
+				"config": [{"name": "sampleRate", "value": 10}],
+				"update_time": "2020-01-02T03:04:05Z"
+			}`)
+		})
+
+	last := Destination{UpdateTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	configs := []DestinationConfig{{Name: "sampleRate", Value: 10}}
+	_, err := client.UpdateDestinationIfUnchanged("js", "google-analytics", last, true, configs)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updates)
+
+	_, err = client.UpdateDestinationIfUnchanged("js", "google-analytics", last, false, configs)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+	assert.Equal(t, map[string]interface{}{"paths": []interface{}{"destination.enabled"}}, body["update_mask"])
+	assert.Equal(t, map[string]interface{}{
+		"name":    "workspaces/test-workspace/sources/js/destinations/google-analytics",
+		"enabled": false,
+	}, body["destination"])
+}
@@ -0,0 +1,61 @@
+package segment
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalYAML encodes v as block style YAML. The value is encoded to JSON
+// first so that the json struct tags and custom marshalers of this package
+// are honoured.
+func MarshalYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "json encoding data for yaml failed")
+	}
+
+	// Decoding into a node keeps the key order of the JSON document.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, errors.Wrap(err, "converting json to yaml failed")
+	}
+	resetYAMLStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, errors.Wrap(err, "yaml encoding failed")
+	}
+	if err := enc.Close(); err != nil {
+		return nil, errors.Wrap(err, "yaml encoding failed")
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalYAML decodes a YAML or JSON document into v. YAML is converted to
+// JSON first so that the json struct tags and custom unmarshalers of this
+// package apply to both formats.
+func UnmarshalYAML(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	j, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, v)
+}
+
+// resetYAMLStyle drops the flow and quoting styles inherited from the JSON
+// source so that the document is written in block style.
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
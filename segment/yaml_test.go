@@ -0,0 +1,35 @@
+package segment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYAML_RoundTrip(t *testing.T) {
+	filter := DestinationFilter{
+		Title:      "Drop identify",
+		Conditions: `type = "identify"`,
+		Actions:    DestinationFilterActions{NewDropEventAction()},
+		IsEnabled:  true,
+	}
+
+	data, err := MarshalYAML(filter)
+	assert.NoError(t, err)
+	assert.Equal(t, `name: ""
+title: Drop identify
+description: ""
+if: type = "identify"
+actions:
+  - type: drop_event
+enabled: true
+`, string(data))
+
+	var decoded DestinationFilter
+	assert.NoError(t, UnmarshalYAML(data, &decoded))
+	assert.Equal(t, filter, decoded)
+
+	assert.NoError(t, UnmarshalYAML([]byte(`{"title": "From JSON"}`), &decoded))
+	assert.Equal(t, "From JSON", decoded.Title)
+	assert.Error(t, UnmarshalYAML([]byte("title: [unterminated"), &decoded))
+}